@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// agentSample is what bench agent reports every interval about its host.
+type agentSample struct {
+	Time       time.Time `json:"time"`
+	CPUPercent float64   `json:"cpu_pct"`
+	MemUsed    uint64    `json:"mem_used_bytes"`
+	MemTotal   uint64    `json:"mem_total_bytes"`
+	NetRx      float64   `json:"net_rx_bytes_per_s"`
+	NetTx      float64   `json:"net_tx_bytes_per_s"`
+	DiskRead   float64   `json:"disk_read_bytes_per_s"`
+	DiskWrite  float64   `json:"disk_write_bytes_per_s"`
+	Load1      float64   `json:"load1"`
+}
+
+// hostCounters are the cumulative /proc counters that samples are the rate of.
+type hostCounters struct {
+	at                  time.Time
+	cpuBusy, cpuTotal   uint64
+	netRx, netTx        uint64
+	diskRead, diskWrite uint64
+}
+
+func readHostCounters() (hostCounters, error) {
+	c := hostCounters{at: time.Now()}
+	stat, err := os.ReadFile("/proc/stat")
+
+	if err != nil {
+		return c, err
+	}
+	line, _, _ := strings.Cut(string(stat), "\n")
+	fields := strings.Fields(line)
+
+	for i, f := range fields[1:] {
+		n, _ := strconv.ParseUint(f, 10, 64)
+		c.cpuTotal += n
+
+		// idle and iowait
+		if i != 3 && i != 4 {
+			c.cpuBusy += n
+		}
+	}
+	if dev, err := os.ReadFile("/proc/net/dev"); err == nil {
+		for _, line := range strings.Split(string(dev), "\n")[2:] {
+			name, rest, ok := strings.Cut(line, ":")
+
+			if !ok || strings.TrimSpace(name) == "lo" {
+				continue
+			}
+			f := strings.Fields(rest)
+			rx, _ := strconv.ParseUint(f[0], 10, 64)
+			tx, _ := strconv.ParseUint(f[8], 10, 64)
+			c.netRx += rx
+			c.netTx += tx
+		}
+	}
+	// Whole disks only, partitions would count twice.
+	disks, _ := filepath.Glob("/sys/block/*/stat")
+
+	for _, path := range disks {
+		name := filepath.Base(filepath.Dir(path))
+
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") {
+			continue
+		}
+		data, err := os.ReadFile(path)
+
+		if err != nil {
+			continue
+		}
+		f := strings.Fields(string(data))
+
+		if len(f) < 7 {
+			continue
+		}
+		read, _ := strconv.ParseUint(f[2], 10, 64)
+		written, _ := strconv.ParseUint(f[6], 10, 64)
+		c.diskRead += read * 512
+		c.diskWrite += written * 512
+	}
+	return c, nil
+}
+
+func sampleHost(prev, cur hostCounters) agentSample {
+	s := agentSample{Time: cur.at}
+	secs := cur.at.Sub(prev.at).Seconds()
+
+	if total := cur.cpuTotal - prev.cpuTotal; total > 0 {
+		s.CPUPercent = 100 * float64(cur.cpuBusy-prev.cpuBusy) / float64(total)
+	}
+	if secs > 0 {
+		s.NetRx = float64(cur.netRx-prev.netRx) / secs
+		s.NetTx = float64(cur.netTx-prev.netTx) / secs
+		s.DiskRead = float64(cur.diskRead-prev.diskRead) / secs
+		s.DiskWrite = float64(cur.diskWrite-prev.diskWrite) / secs
+	}
+	if meminfo, err := os.ReadFile("/proc/meminfo"); err == nil {
+		var available uint64
+
+		for _, line := range strings.Split(string(meminfo), "\n") {
+			f := strings.Fields(line)
+
+			if len(f) < 2 {
+				continue
+			}
+			n, _ := strconv.ParseUint(f[1], 10, 64)
+
+			switch f[0] {
+			case "MemTotal:":
+				s.MemTotal = n << 10
+			case "MemAvailable:":
+				available = n << 10
+			}
+		}
+		s.MemUsed = s.MemTotal - available
+	}
+	if load, err := os.ReadFile("/proc/loadavg"); err == nil {
+		if f := strings.Fields(string(load)); len(f) > 0 {
+			s.Load1, _ = strconv.ParseFloat(f[0], 64)
+		}
+	}
+	return s
+}
+
+func agentCommand(args []string) error {
+	fs := flag.NewFlagSet("agent", flag.ExitOnError)
+	fs.Usage = func() { usage(fs, "agent [flags]") }
+	listen := fs.String("listen", ":9100", "Address to listen on")
+	interval := fs.Duration("interval", time.Second, "Sampling interval")
+	fs.Parse(args)
+
+	if *interval <= 0 {
+		return errors.New("interval must be positive")
+	}
+	if _, err := readHostCounters(); err != nil {
+		return fmt.Errorf("agent needs Linux /proc: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/samples", func(w http.ResponseWriter, r *http.Request) {
+		streamSamples(w, r, *interval)
+	})
+	slog.Info("agent listening", "addr", *listen, "interval", *interval)
+	return http.ListenAndServe(*listen, mux)
+}
+
+// streamSamples writes a JSON sample per line every interval until the
+// client goes away.
+func streamSamples(w http.ResponseWriter, r *http.Request, interval time.Duration) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	prev, _ := readHostCounters()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+		cur, err := readHostCounters()
+
+		if err != nil {
+			return
+		}
+		if err := enc.Encode(sampleHost(prev, cur)); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		prev = cur
+	}
+}
+
+// agentClient collects the samples of a bench agent for the length of the
+// run. Samples are placed by the time they arrive, so the clocks of the two
+// hosts need not agree.
+type agentClient struct {
+	url    string
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu      sync.Mutex
+	start   time.Time
+	samples []agentSample
+	arrived []time.Duration
+	err     error
+}
+
+func newAgentClient(url string) *agentClient {
+	return &agentClient{url: strings.TrimSuffix(url, "/") + "/samples"}
+}
+
+func (a *agentClient) begin(start time.Time) {
+	ctx, cancel := context.WithCancel(context.Background())
+	a.start, a.cancel, a.done = start, cancel, make(chan struct{})
+
+	go func() {
+		defer close(a.done)
+		a.setErr(a.collect(ctx))
+	}()
+}
+
+func (a *agentClient) collect(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.url, nil)
+
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("agent responded %s", resp.Status)
+	}
+	sc := bufio.NewScanner(resp.Body)
+
+	for sc.Scan() {
+		var s agentSample
+
+		if err := json.Unmarshal(sc.Bytes(), &s); err != nil {
+			return err
+		}
+		a.mu.Lock()
+		a.samples = append(a.samples, s)
+		a.arrived = append(a.arrived, time.Since(a.start))
+		a.mu.Unlock()
+	}
+	return sc.Err()
+}
+
+func (a *agentClient) setErr(err error) {
+	if err != nil && !errors.Is(err, context.Canceled) {
+		slog.Warn("agent stream failed", "url", a.url, "err", err)
+		a.mu.Lock()
+		a.err = err
+		a.mu.Unlock()
+	}
+}
+
+func (a *agentClient) stop() {
+	if a.cancel != nil {
+		a.cancel()
+		<-a.done
+	}
+}
+
+func (a *agentClient) report(t *timeline) string {
+	a.stop()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.samples) == 0 {
+		if a.err != nil {
+			return fmt.Sprintf("\n\t\tTarget resources (%s): no samples, %s\n", a.url, a.err)
+		}
+		return fmt.Sprintf("\n\t\tTarget resources (%s): no samples\n", a.url)
+	}
+	var (
+		cpu, load, rx, tx, read, write float64
+		peakCPU, peakLoad              float64
+		peakMem                        uint64
+	)
+	for _, s := range a.samples {
+		cpu += s.CPUPercent
+		load += s.Load1
+		rx += s.NetRx
+		tx += s.NetTx
+		read += s.DiskRead
+		write += s.DiskWrite
+		peakCPU = max(peakCPU, s.CPUPercent)
+		peakLoad = max(peakLoad, s.Load1)
+		peakMem = max(peakMem, s.MemUsed)
+	}
+	n := float64(len(a.samples))
+	mb := func(v float64) float64 { return v / (1 << 20) }
+	last := a.samples[len(a.samples)-1]
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `
+		Target resources (%s, %d samples):
+		CPU: avg %.1f%%, peak %.1f%%
+		Load: avg %.2f, peak %.2f
+		Memory: peak %.0f MB of %.0f MB
+		Network: avg rx %.2f MB/s, tx %.2f MB/s
+		Disk: avg read %.2f MB/s, write %.2f MB/s
+`,
+		a.url, len(a.samples),
+		cpu/n, peakCPU,
+		load/n, peakLoad,
+		mb(float64(peakMem)), mb(float64(last.MemTotal)),
+		mb(rx/n), mb(tx/n),
+		mb(read/n), mb(write/n),
+	)
+	if t != nil {
+		sb.WriteString(a.correlate(t))
+	}
+	return sb.String()
+}
+
+// correlate lines up every second of client latency with the sample that
+// covered it and reports how p99 follows the target's CPU.
+func (a *agentClient) correlate(t *timeline) string {
+	slots := t.snapshot()
+	var p99s, cpus []float64
+	var sb strings.Builder
+	sb.WriteString("\n\t\tsecond  requests       p99    cpu   load   rx MB/s   tx MB/s\n")
+
+	for i := range slots {
+		n := slotCount(&slots[i])
+		s, ok := a.sampleAt(time.Duration(i)*timelineSlot + timelineSlot/2)
+
+		if n == 0 || !ok {
+			continue
+		}
+		p99 := slotPercentile(&slots[i], 99)
+		p99s = append(p99s, float64(p99))
+		cpus = append(cpus, s.CPUPercent)
+		fmt.Fprintf(&sb, "\t\t%6d %9d %9s %5.1f%% %6.2f %9.2f %9.2f\n", i, n, formatLatency(p99),
+			s.CPUPercent, s.Load1, s.NetRx/(1<<20), s.NetTx/(1<<20))
+	}
+	if r, ok := pearson(p99s, cpus); ok {
+		fmt.Fprintf(&sb, "\n\t\tCorrelation of p99 with target CPU: %+.2f\n", r)
+	}
+	return sb.String()
+}
+
+// sampleAt returns the first sample that arrived after at, the one whose
+// interval covered it.
+func (a *agentClient) sampleAt(at time.Duration) (agentSample, bool) {
+	for i, arrived := range a.arrived {
+		if arrived >= at {
+			return a.samples[i], true
+		}
+	}
+	return agentSample{}, false
+}
+
+func pearson(x, y []float64) (float64, bool) {
+	n := float64(len(x))
+
+	if n < 3 {
+		return 0, false
+	}
+	var sx, sy, sxx, syy, sxy float64
+
+	for i := range x {
+		sx += x[i]
+		sy += y[i]
+		sxx += x[i] * x[i]
+		syy += y[i] * y[i]
+		sxy += x[i] * y[i]
+	}
+	d := math.Sqrt(n*sxx-sx*sx) * math.Sqrt(n*syy-sy*sy)
+
+	if d == 0 {
+		return 0, false
+	}
+	return (n*sxy - sx*sy) / d, true
+}
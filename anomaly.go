@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	anomalyWindow     = 10
+	anomalyMinSamples = 10
+	anomalyRatio      = 2.0
+)
+
+type slotSummary struct {
+	at    time.Duration
+	count uint64
+	p50   time.Duration
+	p99   time.Duration
+}
+
+func (b *bench) anomalyReport() string {
+	var sb strings.Builder
+	sb.WriteString("\n\t\tAnomalies:\n")
+
+	q1, q3 := b.stats.Delays.percentile(25), b.stats.Delays.percentile(75)
+	fence := q3 + 3*(q3-q1)
+	outliers := b.stats.Delays.countAbove(fence)
+	var share float64
+
+	if n := b.stats.Delays.count(); n > 0 {
+		share = 100 * float64(outliers) / float64(n)
+	}
+	fmt.Fprintf(&sb, "\t\tLatency outliers (> Q3+3*IQR = %s): %d (%.2f%%)\n", fence, outliers, share)
+
+	events := changePoints(summarizeSlots(b.timeline.snapshot()))
+
+	if len(events) == 0 {
+		sb.WriteString("\t\tNo change points detected\n")
+	}
+	for _, e := range events {
+		fmt.Fprintf(&sb, "\t\t%s\n", e)
+	}
+	return sb.String()
+}
+
+func summarizeSlots(slots [][timelineBuckets]uint32) []slotSummary {
+	// The last slot is usually partial and would look like a throughput drop.
+	if len(slots) > 1 {
+		slots = slots[:len(slots)-1]
+	}
+	out := make([]slotSummary, 0, len(slots))
+
+	for i := range slots {
+		out = append(out, slotSummary{
+			at:    time.Duration(i) * timelineSlot,
+			count: slotCount(&slots[i]),
+			p50:   slotPercentile(&slots[i], 50),
+			p99:   slotPercentile(&slots[i], 99),
+		})
+	}
+	return out
+}
+
+// changePoints compares the median of each metric over the windows before and
+// after every slot and reports where it moved by anomalyRatio or more.
+func changePoints(slots []slotSummary) []string {
+	w := min(anomalyWindow, len(slots)/4)
+
+	if w < 2 {
+		return nil
+	}
+	metrics := []struct {
+		name  string
+		value func(s slotSummary) float64
+		show  func(v float64) string
+	}{
+		{"p99", func(s slotSummary) float64 { return float64(s.p99) }, func(v float64) string { return time.Duration(v).String() }},
+		{"p50", func(s slotSummary) float64 { return float64(s.p50) }, func(v float64) string { return time.Duration(v).String() }},
+		{"throughput", func(s slotSummary) float64 { return float64(s.count) }, func(v float64) string { return fmt.Sprintf("%.0f/s", v) }},
+	}
+	var events []string
+
+	for _, m := range metrics {
+		ratioAt := func(t int) float64 {
+			before, after := windowMedian(slots[t-w:t], m.value), windowMedian(slots[t:t+w], m.value)
+
+			if before <= 0 || after <= 0 {
+				return 1
+			}
+			return after / before
+		}
+		for t := w; t+w <= len(slots); t++ {
+			ratio := ratioAt(t)
+
+			if ratio < anomalyRatio && ratio > 1/anomalyRatio {
+				continue
+			}
+			// The ratio crosses the threshold before the windows straddle the
+			// actual change; move to where it peaks.
+			for next := t + 1; next < t+w && next+w <= len(slots); next++ {
+				if r := ratioAt(next); math.Abs(math.Log(r)) > math.Abs(math.Log(ratio)) {
+					t, ratio = next, r
+				}
+			}
+			verb := "rose"
+
+			if ratio < 1 {
+				verb = "fell"
+			}
+			before, after := windowMedian(slots[t-w:t], m.value), windowMedian(slots[t:t+w], m.value)
+			events = append(events, fmt.Sprintf("%s %s %.1fx at t=%s (%s -> %s)",
+				m.name, verb, max(ratio, 1/ratio), slots[t].at, m.show(before), m.show(after)))
+			t += w - 1
+		}
+	}
+	return events
+}
+
+func windowMedian(slots []slotSummary, value func(slotSummary) float64) float64 {
+	values := make([]float64, 0, len(slots))
+
+	for _, s := range slots {
+		if s.count >= anomalyMinSamples {
+			values = append(values, value(s))
+		}
+	}
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	return values[len(values)/2]
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+type apdex struct {
+	threshold time.Duration
+
+	satisfied  uint32
+	tolerating uint32
+	frustrated uint32
+}
+
+func (a *apdex) add(status int, err error, delay time.Duration) {
+	switch {
+	case err != nil || status >= 500 || delay > 4*a.threshold:
+		atomic.AddUint32(&a.frustrated, 1)
+	case delay > a.threshold:
+		atomic.AddUint32(&a.tolerating, 1)
+	default:
+		atomic.AddUint32(&a.satisfied, 1)
+	}
+}
+
+func (a *apdex) score() float64 {
+	s := float64(atomic.LoadUint32(&a.satisfied))
+	t := float64(atomic.LoadUint32(&a.tolerating))
+	f := float64(atomic.LoadUint32(&a.frustrated))
+
+	if s+t+f == 0 {
+		return 0
+	}
+	return (s + t/2) / (s + t + f)
+}
+
+func (a *apdex) report() string {
+	return fmt.Sprintf(`
+		Apdex (T=%s): %.3f
+		Satisfied: %d
+		Tolerating: %d
+		Frustrated: %d
+	`,
+		a.threshold,
+		a.score(),
+		atomic.LoadUint32(&a.satisfied),
+		atomic.LoadUint32(&a.tolerating),
+		atomic.LoadUint32(&a.frustrated),
+	)
+}
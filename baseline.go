@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// regression tells how much worse cur is than base in a metric: a relative
+// change in percent, except for errors where it is the change of the error
+// rate in percentage points.
+func regression(metric string, base, cur *result) float64 {
+	get := resultMetrics[metric]
+	a, b := get(base), get(cur)
+
+	switch {
+	case metric == "errors":
+		return b - a
+	case a == 0:
+		return 0
+	case metric == "rps":
+		return 100 * (a - b) / a
+	}
+	return 100 * (b - a) / a
+}
+
+// regressionLimits maps a metric to the regression it tolerates, in percent,
+// and implements flag.Value for -max-regression p99=10%,rps=5%.
+type regressionLimits map[string]float64
+
+func (l regressionLimits) String() string {
+	keys := make([]string, 0, len(l))
+
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for i, k := range keys {
+		keys[i] = fmt.Sprintf("%s=%g%%", k, l[k])
+	}
+	return strings.Join(keys, ",")
+}
+
+func (l regressionLimits) Set(s string) error {
+	for _, part := range strings.Split(s, ",") {
+		metric, limit, ok := strings.Cut(strings.TrimSpace(part), "=")
+
+		if !ok {
+			return fmt.Errorf("expected metric=percent, got %q", part)
+		}
+		if _, ok := resultMetrics[metric]; !ok {
+			return fmt.Errorf("unknown metric %q, expected one of %s", metric, strings.Join(resultMetricNames(), ", "))
+		}
+		pct, err := strconv.ParseFloat(strings.TrimSuffix(limit, "%"), 64)
+
+		if err != nil || pct < 0 {
+			return fmt.Errorf("invalid tolerance %q for %s", limit, metric)
+		}
+		l[metric] = pct
+	}
+	return nil
+}
+
+type baseline struct {
+	path   string
+	base   *result
+	limits regressionLimits
+}
+
+func newBaseline(path string, limits regressionLimits) (*baseline, error) {
+	base, err := readResult(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("baseline: %w", err)
+	}
+	return &baseline{path: path, base: base, limits: limits}, nil
+}
+
+func (bl *baseline) install(b *bench) {
+	for _, metric := range bl.metrics() {
+		metric := metric
+		b.thresholds = append(b.thresholds, threshold{
+			name: fmt.Sprintf("%s regression <= %g%%", metric, bl.limits[metric]),
+			check: func() error {
+				cur := b.result()
+				return bl.check(metric, &cur)
+			},
+		})
+	}
+}
+
+func (bl *baseline) check(metric string, cur *result) error {
+	if v := regression(metric, bl.base, cur); v > bl.limits[metric] {
+		return fmt.Errorf("%s regressed %.1f%% against baseline %s (max %g%%)", metric, v, bl.path, bl.limits[metric])
+	}
+	return nil
+}
+
+func (bl *baseline) metrics() []string {
+	metrics := make([]string, 0, len(bl.limits))
+
+	for metric := range bl.limits {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+	return metrics
+}
+
+func (bl *baseline) report(cur *result) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\n\t\tBaseline %s:\n", bl.path)
+	writePrefixed(&sb, "\t\t", []byte(compareResults(bl.base, cur)))
+
+	if len(bl.limits) > 0 {
+		sb.WriteString("\n\t\tRegression gates:\n")
+	}
+	for _, metric := range bl.metrics() {
+		v, limit := regression(metric, bl.base, cur), bl.limits[metric]
+		verdict := paint(colorGreen, "ok")
+
+		if v > limit {
+			verdict = paint(colorRed, "FAIL")
+		}
+		fmt.Fprintf(&sb, "\t\t%s: %+.1f%% (max %g%%) %s\n", metric, v, limit, verdict)
+	}
+	return sb.String()
+}
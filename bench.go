@@ -2,69 +2,541 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/http/httptrace"
+	"net/http/httputil"
 	"net/url"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
+
+	"github.com/valyala/fasthttp"
+
+	"bench/plugins"
 )
 
 type bench struct {
 	requests    uint
 	concurrency uint
-	timeout     uint
+	timeout     time.Duration
+	retries     uint
+	inflight    *inflightLimit
+	failures    *failureLatency
+	open        bool
+	arrivals    uint64
+	dropped     uint64
+	network     string
+	preconnect  bool
+	engine      string
 
 	host   string
 	method string
 	params url.Values
+	header http.Header
 	data   map[string]any
 
-	stats  stats
-	client http.Client
-}
+	compressBody   string
+	acceptEncoding string
+	decompress     bool
+	decodeTime     *int64
+	encodings      *encodingMix
+
+	stats       stats
+	client      *http.Client
+	transport   *http.Transport
+	dialer      *dialer
+	fastClient  *fasthttp.Client
+	clients     []*http.Client
+	fastClients []*fasthttp.Client
+
+	script         scriptEngine
+	conditional    *conditional
+	capture        *headerCapture
+	cdn            *cdnStats
+	byteRange      *byteRange
+	stream         *streamStats
+	upload         *upload
+	expectContinue *expectContinue
+	verifyHash     *hashVerifier
+	echo           *echoVerifier
+	idempotency    *idempotency
+	contention     *contention
+	mix            *requestMix
+	phases         *phaseStats
+	churn          *churnStats
+	slow           *slowClient
+	bodyLimit      *bodyLimit
+	h2             *h2Pool
+	classes        *statusClasses
+	timeouts       *timeoutStats
+	phasesChart    string
+	schema         *schemaValidator
+	checkSample    float64
+	apdex          *apdex
+	monitor        *monitor
+	interim        time.Duration
+	heartbeat      time.Duration
+	ready          *readiness
+	perWorker      bool
+	timeline       *timeline
+	heatmap        string
+	output         string
+	anomalies      bool
+	autoWarmup     bool
+	warmup         *warmup
+	cooldown       *cooldown
+	pacer          pacer
+	burst          *burstPacer
+	schedule       *ratePacer
+
+	ctx         context.Context
+	aborted     chan struct{}
+	maxDuration time.Duration
+	dry         bool
+	preflight   bool
+	debug       *debugSampler
+	failFast    *failFast
+	quiet       bool
+	meta        plugins.Metadata
+	summaryOnly bool
+
+	thresholds          []threshold
+	exitZeroOnThreshold bool
+	gha                 bool
+	baseline            *baseline
+	history             string
+	agent               *agentClient
+
+	// delegate runs the load in place of Run, e.g. as a sweep of runs.
+	delegate interface{ run() error }
 
-type stats struct {
-	LaunchTime time.Time
-	Runtime    time.Duration
+	name      string
+	scenarios []scenario
+	children  []*bench
+	perConn   *keyedStats
+	segments  *segmenter
+	vhosts    *vhostRotator
 
-	RequestsPerSecond uint32
-	RequestsTotal     uint32
-	RequestsSuccess   uint32
-	RequestsFail      uint32
-	RequestsTimeout   uint32
+	protocol   plugins.Protocol
+	reporters  []plugins.Reporter
+	dataSource plugins.DataSource
 
-	DelayMin time.Duration
-	DelayAvg time.Duration
-	DelayMax time.Duration
+	beforeRequest []func(*http.Request)
+	afterResponse []func(*http.Response, error, time.Duration)
 }
 
+const reservedDescriptors = 32
+
+const (
+	engineNetHTTP  = "net/http"
+	engineFastHTTP = "fasthttp"
+)
+
 type task struct {
+	worker uint
 	url    string
 	method string
-	data   io.Reader
+	header http.Header
+	data   []byte
 }
 
 func NewBench() bench {
-	return bench{}
+	return bench{aborted: make(chan struct{}, 1)}
 }
 
-func (b *bench) ParseArgs() error {
-	numRequest := flag.Uint("n", 1000, "Number of requests")
-	concurrency := flag.Uint("c", 1, "Concurrency")
-	timeout := flag.Uint("t", 100, "Request timeout, ms")
-	host := flag.String("h", "", "Target URL address")
-	method := flag.String("m", "GET", "Request method")
-	params := flag.String("p", "", "Request params")
-	flag.Parse()
+// abort stops the run from another goroutine: the workers stop before their
+// next request and Run returns.
+func (b *bench) abort() {
+	select {
+	case b.aborted <- struct{}{}:
+	default:
+	}
+}
 
+func (b *bench) ParseArgs(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), commandsUsage, "\nRun flags:\n")
+		fs.PrintDefaults()
+		fmt.Fprint(fs.Output(), exitUsage)
+	}
+	numRequest := fs.Uint("n", 1000, "Number of requests")
+	concurrency := fs.Uint("c", 1, "Concurrency")
+	concurrencySweep := fs.String("concurrency-sweep", "", "Run once per concurrency level, e.g. 1,2,4,...,512, chart throughput and latency by level and report where throughput stops scaling")
+	model := fs.String("model", modelClosed, "Load model: closed (a fixed pool of -c workers) or open (a goroutine per arrival, at most -c in flight)")
+	rate := fs.Float64("rate", 0, "Send requests at this constant total rate per second")
+	execSegment := fs.String("execution-segment", "", "Run this instance's share of -n, -c and the -rate, -shape, -profile or -burst load, as k6 does: from:to fractions of the whole such as 1/4:1/2, or 1/4 for 0:1/4")
+	execSequence := fs.String("execution-segment-sequence", "", "All execution segments of the run, e.g. 0,1/4,1/2,3/4,1, to spread the rounding of small shares evenly")
+	maxInflight := fs.Uint("max-inflight", 0, "Cap the requests in flight across all workers and scenarios")
+	timeout := msDuration(100 * time.Millisecond)
+	fs.Var(&timeout, "t", "Request timeout, e.g. 250ms or 2s; a bare number is milliseconds")
+	retries := fs.Uint("retries", 0, "Retry requests failing with a transport error or 502, 503 or 504 up to this many times")
+	idempotencyKey := fs.String("idempotency-key", "", "Send a unique key in this header (e.g. Idempotency-Key) with every request")
+	idempotencyDup := fs.String("idempotency-dup", "", "Re-send this fraction of requests with the same idempotency key after they complete, and report the outcome")
+	mix := fs.String("mix", "", "Pick the method of every request by weight, e.g. GET:80,POST:20, and report per method")
+	mixBodies := make(mixData)
+	fs.Var(mixBodies, "mix-data", `Request body for a -mix method, "METHOD:{json}"; may be repeated`)
+	contend := fs.Uint("contention", 0, "Send every request as a batch of this many identical requests released together, and report conflicts")
+	host := fs.String("h", "", "Target URL address; URLs can also be given as arguments")
+	method := fs.String("m", "GET", "Request method")
+	header := make(headerValue)
+	fs.Var(header, "H", "Request header, Name: value; may be repeated")
+	params := make(queryValue)
+	fs.Var(params, "p", "Request params, a=1&b=2; may be repeated")
+	data := fs.String("d", "", "Request body, JSON object")
+	bodyEncoding := fs.String("compress-body", "", "Compress the request body: gzip, deflate, br or zstd")
+	decompress := fs.Bool("decompress", true, "Decode -accept-encoding responses and measure the time it takes; with -decompress=false only wire bytes are counted")
+	maxBodyRead := fs.String("max-body-read", "full", "Read at most this much of every response body, e.g. 4KB (none reads nothing); truncated bodies cost the connection")
+	acceptEncoding := fs.String("accept-encoding", "", "Accept-Encoding header; responses are decoded by bench and both wire and decoded bytes reported. Without it none is sent")
+	ipv4 := fs.Bool("4", false, "Force IPv4 connections")
+	ipv6 := fs.Bool("6", false, "Force IPv6 connections")
+	dnsCache := fs.String("dns-cache", "", "Resolve target hosts per connection (none), per record TTL (ttl) or once (forever), and report lookups")
+	waitReady := fs.Duration("wait-ready", 0, "Before the run, probe the target until it is healthy for up to this long, e.g. 60s")
+	readyURL := fs.String("ready-url", "", "URL that -wait-ready probes with GET (default the target)")
+	readyStatus := fs.String("ready-status", "2xx", "Statuses that -wait-ready takes as healthy: codes such as 200 or classes such as 2xx, comma-separated")
+	preconnect := fs.Bool("preconnect", false, "Establish all connections before measurement starts")
+	engine := fs.String("engine", engineNetHTTP, "HTTP client engine: net/http or fasthttp")
+	pluginPaths := fs.String("plugin", "", "Comma-separated Go plugins (.so) to load")
+	reporterNames := fs.String("reporter", "", "Comma-separated plugin reporters to run after the summary")
+	dataSource := fs.String("datasource", "", "Plugin data source supplying requests, name[:arg]")
+	oauth2TokenURL := fs.String("oauth2-token-url", "", "OAuth2 token endpoint for the client credentials flow")
+	clientID := fs.String("client-id", "", "OAuth2 client ID")
+	clientSecret := fs.String("client-secret", "", "OAuth2 client secret")
+	scope := fs.String("scope", "", "OAuth2 scopes, comma-separated")
+	digest := fs.String("digest", "", "Digest authentication credentials, user:password")
+	hmacSpec := fs.String("hmac", "", "Sign requests with HMAC: header=...,alg=sha256,fields=method+path+body,encoding=hex")
+	hmacSecret := fs.String("hmac-secret", "", "HMAC signing secret")
+	stream := fs.Bool("stream", false, "Stream large bodies, report TTFB and per-connection throughput; -t limits time to headers only")
+	var uploadSize byteSize
+	fs.Var(&uploadSize, "upload-size", "Upload a generated body of this size, e.g. 512, 4KiB or 1.5MB")
+	agentURL := fs.String("agent", "", "Stream CPU, memory, network and disk samples from a bench agent on the target host, e.g. http://target:9100, and correlate them with latency")
+	bodySizeSweep := fs.String("body-size-sweep", "", "Run once per generated body size, e.g. 1KB,10KB,100KB,1MB, and table latency and throughput by size")
+	uploadFile := fs.String("upload-file", "", "Upload the contents of this file as the body")
+	chunked := fs.Bool("chunked", false, "Send uploads with chunked transfer encoding")
+	verifyHash := fs.String("verify-hash", "", "Fail responses whose body hash differs: alg:hex, or alg:first to match the first 2xx response")
+	verifyEcho := fs.Bool("verify-echo", false, "Check that an echo endpoint, such as selftest-server /echo or httpbin /anything, received the requests as sent")
+	schemaPath := fs.String("validate-schema", "", "Fail JSON responses that do not match this JSON Schema file")
+	checkSample := fs.String("check-sample", "100%", "Fraction of responses to verify and validate, e.g. 1% or 0.01")
+	apdexT := fs.Duration("apdex-t", 0, "Report the Apdex score for this satisfied threshold, e.g. 100ms")
+	expect := fs.Bool("expect-continue", false, "Send Expect: 100-continue with request bodies and measure time to the interim response")
+	rangeSpec := fs.String("range", "", "Send a Range header: bytes=start-end, or random:size for random windows")
+	userAgent := fs.String("user-agent", "", "Send this User-Agent header")
+	userAgentFile := fs.String("user-agent-file", "", "Rotate the User-Agent header per request across the lines of a file")
+	uaProfile := fs.String("ua-profile", "", "Emulate a client (chrome, mobile or bot) with its User-Agent and Accept headers; a comma-separated list rotates per request")
+	churn := fs.Bool("churn", false, "Open a new connection for every request and report connection setup")
+	churnReset := fs.Bool("churn-reset", false, "With -churn, close connections with a RST instead of a FIN")
+	h2 := fs.Bool("h2", false, "Speak HTTP/2 over bench's own connections: h2 for https://, h2c with prior knowledge for http://; flow-control windows are fixed by x/net/http2 at 4MB per stream and 1GB per connection")
+	h2Conns := fs.Uint("h2-conns", 1, "With -h2, the number of connections per host that requests are spread over")
+	h2MaxStreams := fs.Uint("h2-max-streams", 0, "With -h2, cap the concurrent streams per connection below the server's limit")
+	var h2MaxFrame byteSize
+	fs.Var(&h2MaxFrame, "h2-max-frame-size", "With -h2, the largest frame the server may send, 16KB to 16MB less one byte")
+	var slowSend byteSize
+	fs.Var(&slowSend, "slow-send", "Send requests at only this many bytes per second per connection, e.g. 1KB, to test server timeouts for slow clients")
+	vhosts := fs.String("vhosts", "", "Rotate the Host header round-robin across a comma-separated list of virtual hosts and report per vhost")
+	vhostSNI := fs.Bool("vhost-sni", false, "Also send the rotated virtual host as the TLS server name (SNI)")
+	cacheBust := fs.String("cache-bust", "", "Add a unique query parameter (name) or header (header:Name) to every request")
+	revalidate := fs.Bool("conditional", false, "Revalidate with If-None-Match/If-Modified-Since using captured ETag/Last-Modified")
+	awsSigV4 := fs.String("aws-sigv4", "", "Sign requests with AWS SigV4, region/service")
+	scriptPath := fs.String("script", "", "JavaScript or wrk-style Lua (.lua) file defining request() and/or response()")
+	gomaxprocs := fs.Int("gomaxprocs", 0, "Set GOMAXPROCS for the generator (0 keeps the default)")
+	shards := fs.Int("shards", 1, "Split workers across this many independent clients/transports (0 means one per P)")
+	pprofAddr := fs.String("pprof", "", "Serve net/http/pprof for the generator on this address, e.g. :6060")
+	interim := fs.Duration("interim", 0, "Print interim throughput and percentiles to stderr at this interval, e.g. 10s")
+	perWorker := fs.Bool("per-worker", false, "Report requests, RPS and latency for each worker")
+	perConn := fs.Bool("per-conn", false, "Report latency for each keep-alive connection")
+	segment := fs.String("segment", "", "Split latency by backend: ip, or header:Name such as header:X-Served-By")
+	captureHeader := fs.String("capture-header", "", "Tally distinct values of these response headers, comma-separated, e.g. X-Cache,X-Backend")
+	cdn := fs.Bool("cdn", false, "Report CDN hit ratio and edge vs origin latency from X-Cache, CF-Cache-Status and Age")
+	phases := fs.Bool("phases", false, "Report percentiles of the DNS, connect, TLS, wait and transfer phases, and their share per latency band")
+	phasesChart := fs.String("phases-chart", "", "Write the phase share per latency band as a stacked bar chart to this .svg or .html file")
+	heatmap := fs.String("heatmap", "", "Write a latency-over-time heatmap to this .svg or .html file")
+	keepTimeline := fs.Bool("timeline", false, "Include the latency histogram of every second in the -o results, kept when results are merged")
+	output := fs.String("o", "", "Write the results as versioned JSON to this file, or gha for GitHub Actions annotations and a step summary")
+	baselinePath := fs.String("baseline", "", "Compare the results with this stored result file")
+	maxRegression := make(regressionLimits)
+	fs.Var(maxRegression, "max-regression", "Fail the run when a metric regressed against -baseline beyond a tolerance, e.g. p99=10%,rps=5%; errors is in percentage points; may be repeated")
+	anomalies := fs.Bool("anomalies", false, "Flag latency outliers and change points over time in the report")
+	autoWarmup := fs.Bool("auto-warmup", false, "Exclude requests until latency stabilizes; warm-up requests count toward -n")
+	cooldownFor := fs.Duration("cooldown", 0, "After the load, probe for up to this long and report when latency returns to baseline")
+	burst := fs.String("burst", "", "Send bursts of count requests every interval, e.g. 500@10s")
+	shape := fs.String("shape", "", "Vary the request rate periodically: sine, square or sawtooth:period=5m,min=100,max=1000")
+	profile := fs.String("profile", "", "Replay a timestamp,rate schedule from a CSV or JSON file")
+	profileScale := fs.Float64("profile-scale", 1, "Multiply the rates from -profile by this factor")
+	scenarioPath := fs.String("scenarios", "", "Run the scenarios from this JSON file concurrently, each with its own load model")
+	maxDuration := fs.Duration("max-duration", 0, "Stop the run after this long and report partial results, e.g. 15m")
+	dry := fs.Bool("dry-run", false, "Send one request per target or scenario, print the exchange and run the checks, without load")
+	preflight := fs.Bool("preflight", false, "Before the load, send one request per target or scenario with every check applied, and abort the run if any fails")
+	failFirst := fs.Bool("fail-fast", false, "Abort the run at the first failed request or check, print the exchange and exit with status 1")
+	exitZero := fs.Bool("exit-zero-on-threshold-fail", false, "Exit with status 0 when thresholds fail, only reporting them")
+	debugSample := fs.String("debug-sample", "", "Print the full exchange to stderr for the first N requests, or a fraction such as 1%")
+	verbose := fs.Bool("v", false, fmt.Sprintf("Print the full exchange for the first %d requests (same as -debug-sample %d)", debugVerbose, debugVerbose))
+	quiet := fs.Bool("q", false, "Suppress progress output such as -interim reports")
+	summaryOnly := fs.Bool("summary-only", false, "Print a single key=value summary line instead of the full report")
+	logLevel := fs.String("log-level", "info", "Log level: debug, info, warn or error")
+	logFormat := fs.String("log-format", "text", "Log format: text or json")
+	latencyUnitFlag := fs.String("latency-unit", "", "Print latencies in this unit: ns, us, ms or s (default the unit that suits each value)")
+	noColor := fs.Bool("no-color", false, "Print reports without colors, which are on only when stdout is a terminal and NO_COLOR is unset")
+	latencyPrecisionFlag := fs.Int("latency-precision", -1, "Decimals of printed latencies (default 3 with -latency-unit, else exact or rounded per report)")
+	tags := make(tagValue)
+	fs.Var(tags, "tag", "Attach key=value metadata to the results, e.g. service=checkout,env=staging; may be repeated")
+	history := fs.String("history", "", "Add the results to this SQLite history database, see bench history")
+	k8sWorkerCount := fs.Uint("k8s-workers", 0, "Run the load from this many Kubernetes worker pods, each sending the full load, and merge their results")
+	k8sImage := fs.String("k8s-image", "", "Container image of the -k8s-workers pods, with bench as its entrypoint")
+	k8sNamespace := fs.String("k8s-namespace", "", "Namespace of the -k8s-workers pods (default the controller's own namespace, or default)")
+	k8sAPI := fs.String("k8s-api", "", "Kubernetes API server URL, e.g. http://127.0.0.1:8001 for kubectl proxy (default the in-cluster API)")
+	k8sTimeout := fs.Duration("k8s-timeout", 30*time.Minute, "Give up on -k8s-workers pods that have not finished after this long")
+	k8sHeartbeat := fs.Duration("k8s-heartbeat", 5*time.Second, fmt.Sprintf("Heartbeat interval of -k8s-workers pods; a worker missing %d is lost and left out of the results", k8sLostBeats))
+	heartbeat := fs.Duration("heartbeat", 0, "Print a progress line to stdout at this interval, as -k8s-workers pods do for the controller")
+	addLongFlags(fs)
+	if len(args) == 1 && (args[0] == "-h" || args[0] == "--h") {
+		fs.Usage()
+		os.Exit(0)
+	}
+	fs.Parse(args)
+
+	b.meta = newMetadata(fs, tags)
+	setPhase("setup")
+
+	if err := setupLogging(*logLevel, *logFormat, b.meta.RunID); err != nil {
+		return err
+	}
+	if err := setLatencyFormat(*latencyUnitFlag, *latencyPrecisionFlag); err != nil {
+		return err
+	}
+	setColor(*noColor)
+
+	// --duration runs for that long, as hey -z does, unless -n is given too.
+	var duration, requests bool
+
+	fs.Visit(func(f *flag.Flag) {
+		duration = duration || f.Name == "duration"
+		requests = requests || f.Name == "n" || f.Name == "requests"
+	})
+	if duration && !requests {
+		*numRequest = unlimitedRequests
+	}
+	var share *executionSegment
+
+	if *execSegment != "" {
+		if s, err := parseExecutionSegment(*execSegment, *execSequence); err != nil {
+			return err
+		} else {
+			share = s
+			*numRequest, *concurrency = uint(s.scale(uint64(*numRequest))), uint(s.scale(uint64(*concurrency)))
+			*rate = s.scaleRate(*rate)
+
+			if *numRequest == 0 || *concurrency == 0 {
+				return fmt.Errorf("execution segment %s gets no share of the requests or the concurrency", s)
+			}
+			slog.Info("execution segment", "segment", s, "requests", *numRequest, "concurrency", *concurrency)
+		}
+	} else if *execSequence != "" {
+		return errors.New("execution-segment-sequence requires -execution-segment")
+	}
 	b.requests = *numRequest
 	b.concurrency = *concurrency
-	b.timeout = *timeout
+
+	// Checked ahead of validate: scripts size their VM pool by it.
+	if b.concurrency == 0 {
+		return errors.New("concurrency must be at least 1, set -c")
+	}
+	b.timeout = time.Duration(timeout)
+	b.retries = *retries
+	b.failures = newFailureLatency()
+
+	if *maxInflight > 0 {
+		b.inflight = newInflightLimit(*maxInflight)
+	}
+	b.preconnect = *preconnect
+
+	if *waitReady > 0 {
+		if r, err := newReadiness(*waitReady, *readyURL, *readyStatus); err != nil {
+			return err
+		} else {
+			b.ready = r
+		}
+	}
+	b.interim = *interim
+	b.heartbeat = *heartbeat
+	b.maxDuration = *maxDuration
+
+	if b.maxDuration > 0 && b.timeout > b.maxDuration {
+		slog.Warn("request timeout is longer than the run", "t", b.timeout, "max-duration", b.maxDuration)
+	}
+	b.dry = *dry
+	b.preflight = *preflight
+	b.quiet = *quiet
+	b.summaryOnly = *summaryOnly
+	b.exitZeroOnThreshold = *exitZero
+
+	if *failFirst {
+		b.failFast = &failFast{}
+	}
+
+	if *verbose && *debugSample == "" {
+		*debugSample = strconv.Itoa(debugVerbose)
+	}
+	if *debugSample != "" {
+		if d, err := newDebugSampler(*debugSample); err != nil {
+			return err
+		} else {
+			b.debug = d
+		}
+	}
+	b.perWorker = *perWorker
+	b.heatmap = *heatmap
+	b.output = *output
+	b.history = *history
+
+	if *output == "gha" {
+		b.output, b.gha = "", true
+	}
+
+	if *baselinePath != "" {
+		if bl, err := newBaseline(*baselinePath, maxRegression); err != nil {
+			return err
+		} else {
+			b.baseline = bl
+			bl.install(b)
+		}
+	} else if len(maxRegression) > 0 {
+		return errors.New("max-regression requires -baseline")
+	}
+	b.anomalies = *anomalies
+	b.autoWarmup = *autoWarmup
+
+	if *scenarioPath != "" {
+		scenarios, err := loadScenarios(*scenarioPath)
+
+		if err != nil {
+			return err
+		}
+		b.scenarios = scenarios
+
+		if *host == "" {
+			*host = scenarios[0].URL
+		}
+	}
+	if *burst != "" {
+		if p, err := newBurstPacer(*burst); err != nil {
+			return err
+		} else {
+			b.burst, b.pacer = p, p
+		}
+	}
+	if *rate > 0 {
+		if b.pacer != nil {
+			return errors.New("only one of -burst, -rate, -shape and -profile can be used")
+		}
+		p := newConstantPacer(*rate)
+		b.schedule, b.pacer = p, p
+	}
+	if *shape != "" {
+		if b.pacer != nil {
+			return errors.New("only one of -burst, -rate, -shape and -profile can be used")
+		}
+		if p, err := newShapePacer(*shape); err != nil {
+			return err
+		} else {
+			b.schedule, b.pacer = p, p
+		}
+	}
+	if b.scenarios != nil && (*burst != "" || *shape != "" || *rate > 0) {
+		return errors.New("set burst, rate and shape per scenario when using -scenarios")
+	}
+	if err := b.positionalTargets(fs.Args(), host, params, *burst, *shape, *rate); err != nil {
+		return err
+	}
+	if *profile != "" {
+		if b.pacer != nil || b.scenarios != nil {
+			return errors.New("only one of -burst, -rate, -shape and -profile can be used")
+		}
+		if p, err := newProfilePacer(*profile, *profileScale); err != nil {
+			return err
+		} else {
+			b.schedule, b.pacer = p, p
+		}
+	}
+	if share != nil {
+		if b.scenarios != nil {
+			return errors.New("execution-segment cannot be combined with scenarios or several URLs")
+		}
+		if err := share.scaleLoad(b, *shape != "" || *profile != ""); err != nil {
+			return err
+		}
+	}
+	switch *model {
+	case modelClosed:
+	case modelOpen:
+		if b.pacer == nil && b.scenarios == nil {
+			return errors.New("the open model needs an arrival rate: -rate, -shape, -profile or -burst")
+		}
+		b.open = true
+	default:
+		return fmt.Errorf("unknown model %q, expected closed or open", *model)
+	}
+	if *cooldownFor > 0 {
+		b.cooldown = &cooldown{duration: *cooldownFor}
+	}
+
+	if *agentURL != "" {
+		b.agent = newAgentClient(*agentURL)
+	}
+	if b.heatmap != "" || b.anomalies || b.agent != nil || *keepTimeline {
+		b.timeline = &timeline{}
+	}
+
+	b.classes = newStatusClasses()
+	b.timeouts = &timeoutStats{}
+
+	if *perConn {
+		b.perConn = newKeyedStats()
+	}
+	if *phases || *phasesChart != "" {
+		b.phases = newPhaseStats()
+		b.phasesChart = *phasesChart
+	}
+	if *segment != "" {
+		if s, err := newSegmenter(*segment); err != nil {
+			return err
+		} else {
+			b.segments = s
+		}
+	}
+
+	if err := b.checkFileLimit(); err != nil {
+		return err
+	}
+	if *gomaxprocs > 0 {
+		runtime.GOMAXPROCS(*gomaxprocs)
+	}
+	if *pprofAddr != "" {
+		if err := startPprof(*pprofAddr); err != nil {
+			return fmt.Errorf("pprof: %w", err)
+		}
+	}
+
+	switch {
+	case *ipv4 && *ipv6:
+		return errors.New("flags -4 and -6 are mutually exclusive")
+	case *ipv4:
+		b.network = "tcp4"
+	case *ipv6:
+		b.network = "tcp6"
+	}
 
 	switch *method {
 	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
@@ -78,74 +550,901 @@ func (b *bench) ParseArgs() error {
 	} else {
 		b.host = u.String()
 	}
-	if p, err := url.ParseQuery(*params); err == nil {
-		b.params = p
+	if len(header) > 0 {
+		b.header = http.Header(header)
+	}
+	if t, err := newHeaderTemplates(b.header); err != nil {
+		return err
+	} else if t != nil {
+		b.onRequest(t.render)
+	}
+	if u, err := newUserAgents(*uaProfile, *userAgent, *userAgentFile); err != nil {
+		return err
+	} else if u != nil {
+		u.install(b)
+	}
+	if len(params) > 0 {
+		b.params = url.Values(params)
+	}
+	if *data != "" {
+		if err := json.Unmarshal([]byte(*data), &b.data); err != nil {
+			return errors.New("invalid request data, expected JSON object")
+		}
+	}
+	if *bodyEncoding != "" {
+		if _, err := compressBody(nil, *bodyEncoding); err != nil {
+			return err
+		}
+		b.compressBody = *bodyEncoding
+	}
+	b.acceptEncoding = *acceptEncoding
+	b.decompress = *decompress
+	b.decodeTime = new(int64)
+
+	if b.acceptEncoding != "" {
+		b.encodings = &encodingMix{}
+	}
+	timeoutDuration := b.timeout
+
+	if *pluginPaths != "" {
+		if err := plugins.Load(strings.Split(*pluginPaths, ",")...); err != nil {
+			return err
+		}
+	}
+	if b.client = plugins.Client(); b.client == nil {
+		b.client = &http.Client{}
+	}
+	if b.client.Timeout == 0 {
+		b.client.Timeout = timeoutDuration
+	}
+	if b.client.Transport == nil {
+		b.transport = b.newTransport(timeoutDuration)
+		b.client.Transport = b.transport
+	} else if b.preconnect {
+		return errors.New("preconnect requires the built-in transport")
+	}
+	if *churn {
+		if b.dialer == nil {
+			return errors.New("churn requires the built-in transport")
+		}
+		if b.preconnect {
+			return errors.New("churn cannot be combined with preconnect")
+		}
+		b.churn = &churnStats{reset: *churnReset}
+		b.dialer.churn = b.churn
+		b.transport.DisableKeepAlives = true
+	} else if *churnReset {
+		return errors.New("churn-reset requires -churn")
+	}
+	if slowSend > 0 {
+		if b.dialer == nil {
+			return errors.New("slow-send requires the built-in transport")
+		}
+		if b.preconnect {
+			return errors.New("slow-send cannot be combined with preconnect")
+		}
+		b.slow = &slowClient{rate: uint(slowSend)}
+		b.dialer.slow = b.slow
+	}
+	if *vhosts != "" {
+		if v, err := newVhostRotator(*vhosts, *vhostSNI); err != nil {
+			return err
+		} else {
+			b.vhosts = v
+		}
+		if *vhostSNI {
+			if b.transport == nil {
+				return errors.New("vhost-sni requires the built-in transport")
+			}
+			if b.preconnect {
+				return errors.New("vhost-sni cannot be combined with preconnect")
+			}
+			b.client.Transport = b.vhosts.wrap(b.transport)
+		}
+		b.onRequest(b.vhosts.rotate)
+	} else if *vhostSNI {
+		return errors.New("vhost-sni requires -vhosts")
+	}
+	if *dnsCache != "" {
+		if b.dialer == nil {
+			return errors.New("dns-cache requires the built-in transport")
+		}
+		if r, err := newResolver(*dnsCache); err != nil {
+			return err
+		} else {
+			b.dialer.resolver = r
+		}
+	}
+	if *h2 {
+		if b.dialer == nil {
+			return errors.New("h2 requires the built-in transport")
+		}
+		if b.preconnect || b.churn != nil || *vhostSNI {
+			return errors.New("h2 cannot be combined with preconnect, churn or vhost-sni")
+		}
+		if p, err := newH2Pool(b.dialer, *h2Conns, *h2MaxStreams, uint(h2MaxFrame)); err != nil {
+			return err
+		} else {
+			b.h2 = p
+			b.client.Transport = p
+		}
+	}
+	if *stream {
+		b.stream = newStreamStats()
+		b.client.Timeout = 0
+
+		if b.transport != nil {
+			b.transport.ResponseHeaderTimeout = timeoutDuration
+		}
+	}
+	if *digest != "" {
+		b.client.Transport = newDigestTransport(b.client.Transport, *digest)
+	}
+
+	if *scriptPath != "" {
+		s, err := loadScript(*scriptPath, b.concurrency)
+
+		if err != nil {
+			return fmt.Errorf("script: %w", err)
+		}
+		b.script = s
+		s.install(b)
+	}
+	if err := b.setupPlugins(*reporterNames, *dataSource); err != nil {
+		return err
+	}
+	if *oauth2TokenURL != "" {
+		a, err := newOAuth2(*oauth2TokenURL, *clientID, *clientSecret, *scope)
+
+		if err != nil {
+			return fmt.Errorf("oauth2: %w", err)
+		}
+		b.onRequest(a.authorize)
+	}
+	if uploadSize != 0 || *uploadFile != "" {
+		u, err := newUpload(int64(uploadSize), *uploadFile, *chunked)
+
+		if err != nil {
+			return fmt.Errorf("upload: %w", err)
+		}
+		b.upload = u
+	}
+	if *idempotencyKey != "" {
+		if b.upload != nil {
+			return errors.New("idempotency-key cannot be combined with uploads")
+		}
+		if i, err := newIdempotency(*idempotencyKey, *idempotencyDup); err != nil {
+			return err
+		} else {
+			b.idempotency = i
+			i.install(b)
+		}
+	} else if *idempotencyDup != "" {
+		return errors.New("idempotency-dup requires -idempotency-key")
+	}
+	if *mix != "" {
+		if b.data != nil || b.upload != nil || b.protocol != nil {
+			return errors.New("mix takes its bodies from -mix-data and cannot be combined with -d, uploads or protocol plugins")
+		}
+		if m, err := newRequestMix(*mix, mixBodies, b.compressBody); err != nil {
+			return err
+		} else {
+			b.mix = m
+		}
+	} else if len(mixBodies) > 0 {
+		return errors.New("mix-data requires -mix")
+	}
+	if *contend > 1 {
+		if b.upload != nil || b.protocol != nil {
+			return errors.New("contention cannot be combined with uploads or protocol plugins")
+		}
+		b.contention = newContention(*contend)
+	}
+	if *verifyHash != "" {
+		v, err := newHashVerifier(*verifyHash)
+
+		if err != nil {
+			return fmt.Errorf("verify-hash: %w", err)
+		}
+		b.verifyHash = v
+	}
+	if *verifyEcho {
+		b.echo = newEchoVerifier()
+	}
+	if *schemaPath != "" {
+		v, err := newSchemaValidator(*schemaPath)
+
+		if err != nil {
+			return fmt.Errorf("validate-schema: %w", err)
+		}
+		b.schema = v
+	}
+	if l, err := newBodyLimit(*maxBodyRead); err != nil {
+		return err
+	} else if l != nil {
+		if b.verifyHash != nil || b.echo != nil || b.schema != nil || b.acceptEncoding != "" {
+			return errors.New("max-body-read cannot be combined with response checks or decoding")
+		}
+		b.bodyLimit = l
+	}
+	if f, err := parseFraction(*checkSample); err != nil {
+		return fmt.Errorf("check-sample: %w", err)
+	} else {
+		b.checkSample = f
+	}
+	if *apdexT > 0 {
+		b.apdex = &apdex{threshold: *apdexT}
+	}
+	if *expect {
+		b.expectContinue = &expectContinue{}
+
+		if b.transport != nil {
+			b.transport.ExpectContinueTimeout = timeoutDuration
+		}
+	}
+	if *rangeSpec != "" {
+		r, err := newByteRange(*rangeSpec)
+
+		if err != nil {
+			return fmt.Errorf("range: %w", err)
+		}
+		b.byteRange = r
+		r.install(b)
+	}
+	if *cdn {
+		*captureHeader = strings.Trim(*captureHeader+","+cdnHeaders, ",")
+		b.cdn = &cdnStats{}
+		b.cdn.install(b)
+	}
+	if *captureHeader != "" {
+		b.capture = newHeaderCapture(*captureHeader)
+		b.capture.install(b)
+	}
+	if *cacheBust != "" {
+		b.onRequest(newCacheBuster(*cacheBust).bust)
 	}
-	b.client = http.Client{
-		Timeout: time.Millisecond * time.Duration(b.timeout),
+	if *revalidate {
+		b.conditional = &conditional{}
+		b.conditional.install(b)
+	}
+	if *hmacSpec != "" || *hmacSecret != "" {
+		s, err := newHMACSigner(*hmacSpec, *hmacSecret)
+
+		if err != nil {
+			return fmt.Errorf("hmac: %w", err)
+		}
+		b.onRequest(s.sign)
+	}
+	if *awsSigV4 != "" {
+		s, err := newSigV4(*awsSigV4)
+
+		if err != nil {
+			return fmt.Errorf("aws-sigv4: %w", err)
+		}
+		b.onRequest(s.sign)
+	}
+	if b.cooldown != nil && b.protocol != nil {
+		return errors.New("cooldown probes require an HTTP target")
+	}
+	if b.dry && b.protocol != nil {
+		return errors.New("dry run requires an HTTP target")
+	}
+	// Checked once every hook is registered: launchProtocol runs none.
+	if b.protocol != nil && b.hasHooks() {
+		return errors.New("request hooks such as -oauth2-token-url, -hmac or -cache-bust are not supported by protocol plugins")
+	}
+
+	switch *engine {
+	case engineNetHTTP:
+	case engineFastHTTP:
+		if b.protocol != nil {
+			return errors.New("fasthttp engine does not support protocol plugins")
+		}
+		if !strings.HasPrefix(b.host, "http://") {
+			return errors.New("fasthttp engine supports plain http:// targets only")
+		}
+		if b.dialer == nil {
+			return errors.New("fasthttp engine does not support a custom client")
+		}
+		if b.hasHooks() {
+			return errors.New("fasthttp engine does not support request hooks")
+		}
+		if *stream || b.upload != nil {
+			return errors.New("fasthttp engine does not support streaming mode")
+		}
+		if *expect {
+			return errors.New("fasthttp engine does not support Expect: 100-continue")
+		}
+		if *digest != "" {
+			return errors.New("fasthttp engine does not support digest authentication")
+		}
+		if b.echo != nil {
+			return errors.New("fasthttp engine does not support echo verification")
+		}
+		if b.retries > 0 {
+			return errors.New("fasthttp engine does not support retries")
+		}
+		if b.bodyLimit != nil {
+			return errors.New("fasthttp engine always reads full bodies")
+		}
+		if b.contention != nil || b.mix != nil {
+			return errors.New("fasthttp engine does not support contention or request mixes")
+		}
+		if b.perConn != nil || b.segments != nil || b.phases != nil {
+			return errors.New("fasthttp engine does not support per-connection, per-backend or phase statistics")
+		}
+		b.fastClient = b.newFastHTTPClient(timeoutDuration)
+	default:
+		return errors.New("unsupported engine")
+	}
+	b.engine = *engine
+
+	if *shards == 0 {
+		*shards = runtime.GOMAXPROCS(0)
+	}
+	if *shards > 1 {
+		if err := b.shardClients(*shards, *digest, timeoutDuration); err != nil {
+			return err
+		}
+	}
+	if err := b.validate(fs, *rate); err != nil {
+		return err
+	}
+	if *bodySizeSweep != "" && *concurrencySweep != "" {
+		return errors.New("body-size-sweep and concurrency-sweep cannot be combined, use bench matrix")
+	}
+	if *k8sWorkerCount > 0 {
+		if *bodySizeSweep != "" || *concurrencySweep != "" {
+			return errors.New("k8s-workers cannot be combined with sweeps")
+		}
+		if k, err := newK8sWorkers(*k8sWorkerCount, *k8sImage, *k8sAPI, *k8sNamespace, *k8sTimeout, *k8sHeartbeat, args, fs); err != nil {
+			return err
+		} else {
+			k.requests, k.output, k.history, k.runID = b.requests, b.output, b.history, b.meta.RunID
+			b.delegate = k
+		}
+	}
+	if *bodySizeSweep != "" {
+		if s, err := newBodySizeSweep(*bodySizeSweep, args, fs); err != nil {
+			return err
+		} else {
+			b.delegate = s
+		}
+	}
+	if *concurrencySweep != "" {
+		if s, err := newConcurrencySweep(*concurrencySweep, args, fs); err != nil {
+			return err
+		} else {
+			b.delegate = s
+		}
+	}
+	return nil
+}
+
+func (b *bench) shardClients(n int, digest string, timeout time.Duration) error {
+	if b.fastClient != nil {
+		b.fastClients = []*fasthttp.Client{b.fastClient}
+
+		for i := 1; i < n; i++ {
+			b.fastClients = append(b.fastClients, b.newFastHTTPClient(timeout))
+		}
+		return nil
+	}
+	if b.transport == nil {
+		return errors.New("shards require the built-in transport")
+	}
+	b.clients = []*http.Client{b.client}
+
+	for i := 1; i < n; i++ {
+		var rt http.RoundTripper = b.transport.Clone()
+
+		if b.h2 != nil {
+			rt = b.h2
+		} else if b.vhosts != nil {
+			rt = b.vhosts.wrap(rt.(*http.Transport))
+		}
+
+		if digest != "" {
+			rt = newDigestTransport(rt, digest)
+		}
+		b.clients = append(b.clients, &http.Client{
+			Timeout:   b.client.Timeout,
+			Transport: rt,
+		})
 	}
 	return nil
 }
 
-func (b *bench) Run() {
+func (b *bench) clientFor(worker uint) *http.Client {
+	if len(b.clients) == 0 {
+		return b.client
+	}
+	return b.clients[worker%uint(len(b.clients))]
+}
+
+func parseFraction(s string) (float64, error) {
+	pct, isPct := strings.CutSuffix(s, "%")
+	f, err := strconv.ParseFloat(pct, 64)
+
+	if err != nil {
+		return 0, fmt.Errorf("invalid fraction %q", s)
+	}
+	if isPct {
+		f /= 100
+	}
+	if f <= 0 || f > 1 {
+		return 0, fmt.Errorf("fraction %q must be within (0, 100%%]", s)
+	}
+	return f, nil
+}
+
+func (b *bench) checkFileLimit() error {
+	need := uint64(b.concurrency) + reservedDescriptors
+	avail, err := raiseFileLimit(need)
+
+	if err != nil {
+		slog.Warn("could not read the file descriptor limit; if it is below what -c needs, requests fail with too many open files",
+			"need", need, "err", err)
+		return nil
+	}
+	if avail < need {
+		return fmt.Errorf(
+			"concurrency %d needs at least %d file descriptors, but the limit is %d (raise it with 'ulimit -n')",
+			b.concurrency, need, avail,
+		)
+	}
+	return nil
+}
+
+func (b *bench) newTransport(timeout time.Duration) *http.Transport {
+	b.dialer = newDialer(b.network, timeout, &b.stats)
+	t := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         b.dialer.DialContext,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        int(b.concurrency),
+		MaxIdleConnsPerHost: int(b.concurrency),
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: timeout,
+		// Bodies the transport gunzipped itself would be counted decoded
+		// as wire bytes; -accept-encoding has bench decode them instead.
+		DisableCompression: true,
+	}
+
+	if b.preconnect && strings.HasPrefix(b.host, "https://") {
+		t.DialTLSContext = b.dialer.DialTLSContext
+	}
+	return t
+}
+
+func (b *bench) Run() error {
+	task, err := b.newTask()
+
+	if err != nil {
+		return withExit(exitConfig, err)
+	}
+	if b.ready != nil {
+		setPhase("wait-ready")
+
+		if err := b.ready.wait(b.client, task); err != nil {
+			return withExit(exitUnreachable, err)
+		}
+	}
+	if b.preconnect {
+		u, _ := url.Parse(b.host)
+
+		if err := b.dialer.Preconnect(context.Background(), u, int(b.concurrency)); err != nil {
+			return withExit(exitUnreachable, fmt.Errorf("preconnect: %w", err))
+		}
+	}
+	if b.cooldown != nil {
+		b.cooldown.measureBaseline(b, task)
+	}
+	var cancel context.CancelFunc
+
+	if b.maxDuration > 0 {
+		b.ctx, cancel = context.WithTimeout(context.Background(), b.maxDuration)
+	} else {
+		b.ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+
+	go func(ctx context.Context) {
+		select {
+		case <-b.aborted:
+			cancel()
+		case <-ctx.Done():
+		}
+	}(b.ctx)
+
+	if b.dry {
+		setPhase("dry-run")
+		return b.dryRun(task)
+	}
+	if b.preflight {
+		setPhase("preflight")
+
+		if err := b.runPreflight(task); err != nil {
+			return err
+		}
+	}
+	b.stats.init(b.concurrency)
+	b.monitor = startMonitor(&b.stats.ConnectionsOpen)
 	b.stats.LaunchTime = time.Now()
-	numRequests := b.requests / b.concurrency
+
+	if b.timeline != nil {
+		b.timeline.start = b.stats.LaunchTime
+	}
+	if b.agent != nil {
+		b.agent.begin(b.stats.LaunchTime)
+	}
+	if b.autoWarmup {
+		b.warmup = newWarmup(b.stats.LaunchTime)
+		setPhase("warmup")
+	} else {
+		setPhase("load")
+	}
+	if b.pacer != nil {
+		b.pacer.begin(b.stats.LaunchTime)
+	}
+	if b.failFast != nil {
+		b.failFast.begin(b.stats.LaunchTime, cancel)
+	}
 	var wg sync.WaitGroup
-	task := task{
-		url: fmt.Sprintf("%s?%s", b.host, b.params.Encode()),
+	slog.Debug("load started", "requests", b.requests, "concurrency", b.concurrency, "url", task.url)
+
+	if len(b.scenarios) > 0 {
+		if err := b.launchScenarios(&wg); err != nil {
+			return withExit(exitConfig, err)
+		}
+	} else {
+		b.launchWorkers(&wg, task)
 	}
+	stop := make(chan struct{})
+	defer close(stop)
 
-	if b.data != nil {
-		data, _ := json.Marshal(b.data)
-		task.data = bytes.NewBuffer(data)
+	if b.interim > 0 && !b.quiet {
+		go b.reportInterim(stop)
+	}
+	if b.heartbeat > 0 {
+		go b.beat(stop)
+	}
+	wg.Wait()
+
+	slog.Debug("load finished", "requests", b.requests, "elapsed", time.Since(b.stats.LaunchTime))
+
+	if b.failFast != nil && b.failFast.err != nil {
+		return withExit(exitAborted, b.failFast.err)
 	}
 
+	if b.cooldown != nil && b.ctx.Err() == nil {
+		setPhase("cooldown")
+		b.cooldown.run(b, task)
+	}
+	return nil
+}
+
+func (b *bench) launchWorkers(wg *sync.WaitGroup, task task) {
+	if b.open {
+		b.launchOpen(wg, task)
+		return
+	}
+	// The first workers send the remainder, one more each, so the total
+	// comes out at -n.
+	numRequests, rest := b.requests/b.concurrency, b.requests%b.concurrency
+
 	for i := uint(0); i < b.concurrency; i++ {
 		wg.Add(1)
+		t := task
+		t.worker = i
+		n := numRequests
+
+		if i < rest {
+			n++
+		}
 		go func() {
-			b.LaunchTask(numRequests, task)
+			b.LaunchTask(n, t)
+			slog.Debug("worker finished", "worker", t.worker, "scenario", b.name)
 			wg.Done()
 		}()
 	}
-	wg.Wait()
+}
+
+func (b *bench) newTask() (task, error) {
+	t := task{
+		url:    b.targetURL(),
+		method: b.method,
+		header: b.header.Clone(),
+	}
+	if t.header == nil {
+		t.header = make(http.Header)
+	}
+
+	if b.data != nil {
+		t.data, _ = json.Marshal(b.data)
+		t.header.Set("Content-Type", "application/json")
+	}
+	if b.compressBody != "" && t.data != nil {
+		data, err := compressBody(t.data, b.compressBody)
+
+		if err != nil {
+			return t, err
+		}
+		t.data = data
+		t.header.Set("Content-Encoding", b.compressBody)
+	}
+	if b.acceptEncoding != "" {
+		t.header.Set("Accept-Encoding", b.acceptEncoding)
+	}
+	if b.expectContinue != nil {
+		t.header.Set("Expect", "100-continue")
+	}
+	return t, nil
+}
+
+func (b *bench) targetURL() string {
+	if len(b.params) == 0 {
+		return b.host
+	}
+	u, err := url.Parse(b.host)
+
+	if err != nil {
+		return b.host
+	}
+	q := u.Query()
+
+	for k, v := range b.params {
+		q[k] = append(q[k], v...)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
 }
 
 func (b *bench) LaunchTask(numRequest uint, t task) {
-	req, err := http.NewRequest(t.method, t.url, t.data)
+	if b.protocol != nil {
+		b.launchProtocol(numRequest, t)
+		return
+	}
+	if b.engine == engineFastHTTP {
+		b.launchFastHTTP(numRequest, t)
+		return
+	}
+	req, err := http.NewRequestWithContext(b.ctx, t.method, t.url, nil)
 
 	if err != nil {
 		return
 	}
-	for i := uint(0); i < numRequest; i++ {
+	req.Header = t.header.Clone()
+
+	if b.retries > 0 && t.data != nil {
+		req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(t.data)), nil }
+	}
+	client := b.clientFor(t.worker)
+	sh := b.stats.shard(t.worker)
+	var (
+		replay *replayBody
+		wire   countingReader
+	)
+	for i := uint(0); i < numRequest && !b.stopped(); i++ {
+		if !b.pace() {
+			break
+		}
+		var (
+			body  *uploadBody
+			entry *mixEntry
+			data  = t.data
+		)
+		if b.mix != nil {
+			entry = b.mix.pick()
+			data = entry.data
+		}
+		if b.upload != nil {
+			body, req.ContentLength, err = b.upload.body()
+
+			if err != nil {
+				b.record(sh, 0, err, 0)
+				continue
+			}
+			req.Body = body
+		} else if data != nil {
+			replay = replay.reuse(data)
+			req.Body = replay
+			req.ContentLength = int64(len(data))
+			atomic.AddUint64(&sh.bytesSent, uint64(len(data)))
+		}
+		r := req
+
+		if len(b.beforeRequest) > 0 || entry != nil {
+			r = req.Clone(req.Context())
+
+			if entry != nil {
+				entry.apply(r, b.retries > 0)
+			}
+			b.runBeforeRequest(r)
+		}
+		if b.echo != nil && body == nil {
+			b.echo.capture(r)
+		}
+		var trace *requestTrace
+
+		if b.tracing() {
+			trace = &requestTrace{}
+			r = r.WithContext(httptrace.WithClientTrace(r.Context(), trace.clientTrace()))
+		}
+		var (
+			debugID  uint32
+			debugReq []byte
+		)
+		if b.debug != nil {
+			var ok bool
+
+			if debugID, ok = b.debug.pick(); ok {
+				debugReq = dumpRequest(r, body != nil)
+			}
+		}
+		if !b.acquire() {
+			break
+		}
 		start := time.Now()
-		atomic.AddUint32(&b.stats.RequestsTotal, 1)
-		resp, err := b.client.Do(req)
+		var resp *http.Response
 
-		if err != nil {
-			atomic.AddUint32(&b.stats.RequestsFail, 1)
+		if b.contention != nil {
+			resp, err = b.contention.do(b.ctx, client, r, data)
+		} else {
+			resp, err = client.Do(r)
+		}
+		if b.retries > 0 {
+			resp, err = b.retry(client, r, sh, resp, err)
+		}
+		ttfb := time.Since(start)
 
-			if err == http.ErrHandlerTimeout {
-				atomic.AddUint32(&b.stats.RequestsTimeout, 1)
+		if debugReq != nil {
+			var debugResp []byte
+
+			if err == nil {
+				debugResp = dumpResponse(resp)
 			}
-		} else if resp.StatusCode == http.StatusOK {
-			atomic.AddUint32(&b.stats.RequestsSuccess, 1)
+			b.debug.print(debugID, debugReq, debugResp, err, ttfb)
+		}
+		b.runAfterResponse(resp, err, ttfb)
+		status := 0
+		var failedResp []byte
+
+		if trace != nil {
+			b.recordTrace(trace)
+		}
+
+		if body != nil {
+			b.upload.add(start, body, &sh.bytesSent)
+		}
+
+		if err == nil {
+			status = resp.StatusCode
+			sh.addTTFB(ttfb)
+
+			if b.failFast != nil && !b.succeeded(status) && b.failFast.armed() {
+				failedResp = failedResponse(resp)
+			}
+			err = b.readBody(sh, &wire, resp, start)
 		}
 		delay := time.Since(start)
+		b.release()
+		b.record(sh, status, err, delay)
 
-		if b.stats.DelayMin == 0 || delay < b.stats.DelayMin {
-			b.stats.DelayMin = delay
+		if b.failFast != nil && (err != nil || !b.succeeded(status)) && !b.stopped() {
+			if failedResp == nil && resp != nil {
+				failedResp, _ = httputil.DumpResponse(resp, false)
+			}
+			b.failFast.trip(t.worker, failedRequest(r, data), failedResp, status, err, delay)
+		}
+
+		if trace != nil {
+			b.recordSplit(trace, resp, err, delay)
+		}
+		if b.vhosts != nil {
+			b.vhosts.add(r.Host, b.succeeded(status), err, delay)
 		}
-		if delay > b.stats.DelayMax {
-			b.stats.DelayMax = delay
+		if b.mix != nil {
+			b.mix.stats.addStatus(r.Method, b.succeeded(status), err, delay)
 		}
+		if b.idempotency != nil && b.acquire() {
+			b.idempotency.duplicate(client, r, data, status)
+			b.release()
+		}
+	}
+}
+
+func (b *bench) stopped() bool {
+	return b.ctx.Err() != nil
+}
+
+// succeeded tells the statuses that count as success: any 2xx, and 304 with
+// -conditional, which revalidates to get them.
+func (b *bench) succeeded(status int) bool {
+	return status/100 == 2 || status == http.StatusNotModified && b.conditional != nil
+}
 
+func (b *bench) record(sh *statsShard, status int, err error, delay time.Duration) {
+	// Requests cut off by -max-duration are not failures of the target.
+	if err != nil && b.stopped() {
+		return
+	}
+	if b.warmup != nil && !b.warmup.finished() && !sh.warm(b.warmup, delay) {
+		return
+	}
+	atomic.AddUint32(&sh.total, 1)
+
+	if b.burst != nil {
+		b.burst.add(err, delay)
+	}
+	if err != nil {
+		atomic.AddUint32(&sh.fail, 1)
+		if clientTimeout(err) {
+			atomic.AddUint32(&sh.timeout, 1)
+		}
+		if unreachable(err) {
+			atomic.AddUint32(&sh.unreachable, 1)
+		}
+		if errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE) {
+			if atomic.AddUint32(&sh.noFile, 1) == 1 {
+				slog.Warn("out of file descriptors", "worker", sh.worker, "err", err)
+			}
+		}
+	} else if b.succeeded(status) {
+		atomic.AddUint32(&sh.success, 1)
+	} else if serverTimeout(status) {
+		atomic.AddUint32(&sh.serverTimeout, 1)
+	}
+	if b.failures != nil && (err != nil || !b.succeeded(status)) {
+		if sh.failures == nil {
+			sh.failures = newFailureLatency()
+		}
+		sh.failures.add(status, err, delay)
+	}
+	if b.apdex != nil {
+		b.apdex.add(status, err, delay)
 	}
+	sh.classes.add(status, err, delay)
+	b.timeouts.add(status, err, delay)
+	sh.addDelay(delay)
+
+	if b.timeline != nil {
+		if sh.timeline == nil {
+			sh.timeline = &timeline{start: b.timeline.start}
+		}
+		sh.timeline.add(time.Now(), delay)
+	}
+}
+
+func (b *bench) runtime() time.Duration {
+	start, end := b.stats.LaunchTime, time.Now()
+
+	if b.warmup != nil {
+		start = b.warmup.measureStart()
+	}
+	if b.cooldown != nil {
+		if t, ok := b.cooldown.ended(); ok {
+			end = t
+		}
+	}
+	return end.Sub(start)
 }
 
 func (b *bench) PrintResult() {
-	b.stats.Runtime = time.Since(b.stats.LaunchTime)
+	if b.dry {
+		return
+	}
+	setPhase("report")
+	b.stats.Runtime = b.runtime()
+	b.stats.merge()
+	b.mergeDetail()
 	rps := float64(b.stats.RequestsTotal) / b.stats.Runtime.Seconds()
-	b.stats.DelayAvg = (b.stats.DelayMax - b.stats.DelayMin) / 2
+
+	if b.summaryOnly {
+		fmt.Println(b.summaryLine(rps))
+		b.writeArtifacts()
+		return
+	}
 	res := fmt.Sprintf(`
 		Runtime: %s
 		Concurrency: %d
@@ -155,10 +1454,37 @@ func (b *bench) PrintResult() {
 		Success requests: %d
 		Fail requests: %d
 		Timeout requests: %d
+		Server timeout responses: %d
+		Out of file descriptors: %d
+
+		Sent body bytes: %d
+		Received bytes (wire): %d
+		Received bytes (decoded): %d
+
+		IPv4 connections: %d
+		IPv6 connections: %d
 
 		Min delay: %s
 		Avg delay: %s
 		Max delay: %s
+		P50 delay: %s
+		P90 delay: %s
+		P99 delay: %s
+		P99.9 delay: %s
+		Stddev delay: %s
+		Coefficient of variation: %.3f
+
+		Min jitter: %s
+		Avg jitter: %s
+		Max jitter: %s
+
+		Min TTFB: %s
+		Avg TTFB: %s
+		Max TTFB: %s
+		P50 TTFB: %s
+		P90 TTFB: %s
+		P99 TTFB: %s
+		P99.9 TTFB: %s
 	`,
 		b.stats.Runtime,
 		b.concurrency,
@@ -167,9 +1493,220 @@ func (b *bench) PrintResult() {
 		b.stats.RequestsSuccess,
 		b.stats.RequestsFail,
 		b.stats.RequestsTimeout,
-		b.stats.DelayMin,
-		b.stats.DelayAvg,
-		b.stats.DelayMax,
+		b.stats.RequestsServerTimeout,
+		b.stats.RequestsNoFile,
+		b.stats.BytesSent,
+		b.stats.BytesWire,
+		b.stats.BytesDecoded,
+		b.stats.ConnectionsIPv4,
+		b.stats.ConnectionsIPv6,
+		showLatency(b.stats.DelayMin),
+		showLatency(b.stats.DelayAvg),
+		showLatency(b.stats.DelayMax),
+		showLatency(b.stats.Delays.percentile(50)),
+		showLatency(b.stats.Delays.percentile(90)),
+		showLatency(b.stats.Delays.percentile(99)),
+		showLatency(b.stats.Delays.percentile(99.9)),
+		showLatency(b.stats.DelayStddev),
+		b.stats.DelayCV,
+		showLatency(b.stats.JitterMin),
+		showLatency(b.stats.JitterAvg),
+		showLatency(b.stats.JitterMax),
+		showLatency(b.stats.TTFBMin),
+		showLatency(b.stats.TTFBAvg),
+		showLatency(b.stats.TTFBMax),
+		showLatency(b.stats.TTFB.percentile(50)),
+		showLatency(b.stats.TTFB.percentile(90)),
+		showLatency(b.stats.TTFB.percentile(99)),
+		showLatency(b.stats.TTFB.percentile(99.9)),
 	)
+	fmt.Println(b.metadataReport())
 	fmt.Println(res)
+	fmt.Println(b.littlesLaw())
+
+	if b.retries > 0 || b.stats.Retries > 0 {
+		fmt.Println(b.retryReport())
+	}
+	if r := b.classes.report(); r != "" {
+		fmt.Println(r)
+	}
+	if b.stats.RequestsTimeout > 0 || b.stats.RequestsServerTimeout > 0 {
+		fmt.Println(b.timeouts.report())
+	}
+	if b.inflight != nil {
+		fmt.Println(b.inflight.report())
+	}
+	if b.churn != nil {
+		fmt.Println(b.churnReport())
+	}
+	if b.slow != nil {
+		fmt.Println(b.slow.report())
+	}
+	if b.h2 != nil {
+		fmt.Println(b.h2.report())
+	}
+	if b.bodyLimit != nil {
+		fmt.Println(b.bodyLimit.report())
+	}
+	if b.acceptEncoding != "" {
+		fmt.Println(b.decompressionReport())
+	}
+	if b.idempotency != nil {
+		fmt.Println(b.idempotency.report())
+	}
+	if b.contention != nil {
+		fmt.Println(b.contention.report())
+	}
+	if b.dialer != nil && b.dialer.resolver != nil {
+		fmt.Println(b.dialer.resolver.report())
+	}
+	if b.open {
+		fmt.Println(b.openReport())
+	}
+	if r := b.failures.report(); r != "" {
+		fmt.Println(r)
+	}
+
+	if b.ctx != nil && errors.Is(b.ctx.Err(), context.DeadlineExceeded) {
+		fmt.Printf("\t\tStopped by -max-duration after %s\n\n", b.maxDuration)
+	}
+
+	if b.warmup != nil {
+		fmt.Println(b.warmup.report())
+	}
+	if b.cooldown != nil {
+		fmt.Println(b.cooldown.report())
+	}
+	if b.children != nil {
+		fmt.Println(b.scenarioReport())
+	}
+	if b.burst != nil {
+		fmt.Println(b.burst.report())
+	}
+	if b.schedule != nil {
+		fmt.Println(b.scheduleReport())
+	}
+
+	if b.monitor != nil {
+		fmt.Println(b.monitor.report())
+	}
+	if b.agent != nil {
+		fmt.Println(b.agent.report(b.timeline))
+	}
+
+	if b.perWorker {
+		fmt.Println(b.workerReport())
+	}
+	if b.perConn != nil {
+		fmt.Println(b.perConn.report("Per-connection"))
+	}
+	if b.segments != nil {
+		fmt.Println(b.segments.report())
+	}
+	if b.mix != nil {
+		fmt.Println(b.mix.report())
+	}
+	if b.phases != nil {
+		fmt.Println(b.phases.report())
+	}
+	if b.vhosts != nil {
+		fmt.Println(b.vhosts.report())
+	}
+	if b.apdex != nil {
+		fmt.Println(b.apdex.report())
+	}
+	if b.capture != nil {
+		fmt.Println(b.capture.report())
+	}
+	if b.cdn != nil {
+		fmt.Println(b.cdn.report())
+	}
+	if b.conditional != nil {
+		fmt.Println(b.conditional.report())
+	}
+	if b.byteRange != nil {
+		fmt.Println(b.byteRange.report(b.stats.Runtime))
+	}
+	if b.stream != nil {
+		fmt.Println(b.stream.report())
+	}
+	if b.upload != nil {
+		fmt.Println(b.upload.report())
+	}
+	if b.expectContinue != nil {
+		fmt.Println(b.expectContinue.report())
+	}
+	if b.echo != nil {
+		fmt.Println(b.echo.report())
+	}
+	if b.verifyHash != nil {
+		fmt.Println(b.verifyHash.report())
+	}
+	if b.schema != nil {
+		fmt.Println(b.schema.report())
+	}
+	if b.script != nil {
+		fmt.Println(b.script.report(b))
+	}
+	if b.anomalies {
+		fmt.Println(b.anomalyReport())
+	}
+	if b.baseline != nil {
+		cur := b.result()
+		fmt.Println(b.baseline.report(&cur))
+	}
+	b.writeArtifacts()
+}
+
+func (b *bench) writeArtifacts() {
+	if b.output != "" {
+		if err := writeResult(b.output, b.result()); err != nil {
+			slog.Error("writing results failed", "err", err)
+		}
+	}
+	if b.history != "" {
+		if err := addHistory(b.history, b.result()); err != nil {
+			slog.Error("adding to history failed", "err", err)
+		}
+	}
+	if b.heatmap != "" {
+		if err := b.writeHeatmap(b.heatmap); err != nil {
+			slog.Error("writing heatmap failed", "err", err)
+		}
+	}
+	if b.phasesChart != "" {
+		if err := b.phases.writeChart(b.phasesChart, b); err != nil {
+			slog.Error("writing phase chart failed", "err", err)
+		}
+	}
+	b.runReporters()
+}
+
+func (b *bench) summaryLine(rps float64) string {
+	var errorPct float64
+
+	if b.stats.RequestsTotal > 0 {
+		errorPct = 100 * float64(b.stats.RequestsTotal-b.stats.RequestsSuccess) / float64(b.stats.RequestsTotal)
+	}
+	unit, precision := latencyUnit, latencyPrecision
+
+	if unit == 0 {
+		unit = time.Millisecond
+	}
+	if precision < 0 {
+		precision = 3
+	}
+	value := func(d time.Duration) string { return strconv.FormatFloat(float64(d)/float64(unit), 'f', precision, 64) }
+	key := latencyKey()
+
+	line := fmt.Sprintf("run=%s requests=%d rps=%.1f p50_%s=%s p99_%s=%s errors_pct=%.2f duration_s=%.3f",
+		b.meta.RunID, b.stats.RequestsTotal, rps, key, value(b.stats.Delays.percentile(50)), key, value(b.stats.Delays.percentile(99)),
+		errorPct, b.stats.Runtime.Seconds())
+	tags := make([]string, 0, len(b.meta.Tags))
+
+	for k, v := range b.meta.Tags {
+		tags = append(tags, " tag."+k+"="+v)
+	}
+	sort.Strings(tags)
+	return line + strings.Join(tags, "")
 }
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// BenchmarkLaunchTask measures the cost of issuing a request on one worker,
+// so that allocations per request on the hot path stay near zero. The figures
+// include those of net/http and of the in-process server.
+func BenchmarkLaunchTask(tb *testing.B) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	b := NewBench()
+
+	if err := b.ParseArgs([]string{"-n", "1", "-c", "1", "-h", srv.URL}); err != nil {
+		tb.Fatal(err)
+	}
+	t, err := b.newTask()
+
+	if err != nil {
+		tb.Fatal(err)
+	}
+	b.ctx = context.Background()
+	b.stats.init(1)
+
+	tb.ReportAllocs()
+	tb.ResetTimer()
+	b.LaunchTask(uint(tb.N), t)
+	tb.StopTimer()
+
+	if ok := atomic.LoadUint32(&b.stats.shard(0).success); ok != uint32(tb.N) {
+		tb.Fatalf("%d of %d requests succeeded", ok, tb.N)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+	"sync/atomic"
+)
+
+// replayBody sends the same request body on every iteration without
+// allocating. The transport may keep writing a body after the response
+// arrives, so it is only reused once the transport has closed it.
+type replayBody struct {
+	bytes.Reader
+
+	closed uint32
+}
+
+func (r *replayBody) reuse(data []byte) *replayBody {
+	if r == nil || atomic.LoadUint32(&r.closed) == 0 {
+		r = &replayBody{}
+	}
+	r.Reset(data)
+	atomic.StoreUint32(&r.closed, 0)
+	return r
+}
+
+func (r *replayBody) Close() error {
+	atomic.StoreUint32(&r.closed, 1)
+	return nil
+}
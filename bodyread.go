@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// bodyLimit reads at most limit bytes of every response body and closes it,
+// trading the connection reuse of drained bodies for generator throughput.
+type bodyLimit struct {
+	limit int64
+
+	truncated uint32
+	unread    uint64
+	unknown   uint32
+}
+
+func newBodyLimit(spec string) (*bodyLimit, error) {
+	switch spec {
+	case "", "full":
+		return nil, nil
+	case "none":
+		return &bodyLimit{}, nil
+	}
+	n, err := parseByteSize(spec)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid max-body-read %q, expected a size such as 4KB, none or full", spec)
+	}
+	return &bodyLimit{limit: n}, nil
+}
+
+// add accounts for the part of resp's body left unread after n bytes.
+func (l *bodyLimit) add(resp *http.Response, n int64, eof bool) {
+	if eof {
+		return
+	}
+	atomic.AddUint32(&l.truncated, 1)
+
+	if resp.ContentLength >= 0 {
+		atomic.AddUint64(&l.unread, uint64(max(resp.ContentLength-n, 0)))
+	} else {
+		atomic.AddUint32(&l.unknown, 1)
+	}
+}
+
+func (l *bodyLimit) report() string {
+	return fmt.Sprintf(`
+		Max body read: %d bytes
+		Truncated bodies: %d
+		Discarded bytes (by Content-Length): %d
+		Truncated bodies of unknown length: %d
+	`,
+		l.limit,
+		atomic.LoadUint32(&l.truncated),
+		atomic.LoadUint64(&l.unread),
+		atomic.LoadUint32(&l.unknown),
+	)
+}
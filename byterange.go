@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type byteRange struct {
+	header string
+	size   int64
+	total  int64
+
+	partial     uint32
+	full        uint32
+	unsatisfied uint32
+	bytes       int64
+}
+
+func newByteRange(spec string) (*byteRange, error) {
+	if s, ok := strings.CutPrefix(spec, "random:"); ok {
+		size, err := strconv.ParseInt(s, 10, 64)
+
+		if err != nil || size <= 0 {
+			return nil, errors.New("random range size must be a positive number of bytes")
+		}
+		return &byteRange{size: size}, nil
+	}
+	if !strings.HasPrefix(spec, "bytes=") {
+		return nil, errors.New("expected bytes=start-end or random:size")
+	}
+	return &byteRange{header: spec}, nil
+}
+
+func (r *byteRange) install(b *bench) {
+	b.onRequest(r.beforeRequest)
+	b.onResponse(r.afterResponse)
+}
+
+func (r *byteRange) beforeRequest(req *http.Request) {
+	if r.header != "" {
+		req.Header.Set("Range", r.header)
+		return
+	}
+	var start int64
+
+	if total := atomic.LoadInt64(&r.total); total > r.size {
+		start = rand.Int63n(total - r.size + 1)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, start+r.size-1))
+}
+
+func (r *byteRange) afterResponse(resp *http.Response, err error, _ time.Duration) {
+	if err != nil {
+		return
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		atomic.AddUint32(&r.partial, 1)
+		span, total, _ := strings.Cut(resp.Header.Get("Content-Range"), "/")
+
+		if n := resp.ContentLength; n >= 0 {
+			atomic.AddInt64(&r.bytes, n)
+		} else if n, ok := rangeLength(span); ok {
+			atomic.AddInt64(&r.bytes, n)
+		}
+		if n, err := strconv.ParseInt(total, 10, 64); err == nil {
+			atomic.StoreInt64(&r.total, n)
+		}
+	case http.StatusOK:
+		atomic.AddUint32(&r.full, 1)
+	case http.StatusRequestedRangeNotSatisfiable:
+		atomic.AddUint32(&r.unsatisfied, 1)
+	}
+}
+
+// rangeLength is the length of the span "bytes start-end" of a Content-Range,
+// for responses that don't state a Content-Length.
+func rangeLength(span string) (int64, bool) {
+	first, last, ok := strings.Cut(strings.TrimPrefix(span, "bytes "), "-")
+
+	if !ok {
+		return 0, false
+	}
+	start, err1 := strconv.ParseInt(first, 10, 64)
+	end, err2 := strconv.ParseInt(last, 10, 64)
+
+	if err1 != nil || err2 != nil || end < start {
+		return 0, false
+	}
+	return end - start + 1, true
+}
+
+func (r *byteRange) report(runtime time.Duration) string {
+	bytes := atomic.LoadInt64(&r.bytes)
+
+	return fmt.Sprintf(`
+		Partial content (206): %d
+		Full content (200): %d
+		Range not satisfiable (416): %d
+		Partial throughput: %.2f MiB/s
+	`,
+		atomic.LoadUint32(&r.partial),
+		atomic.LoadUint32(&r.full),
+		atomic.LoadUint32(&r.unsatisfied),
+		float64(bytes)/runtime.Seconds()/(1<<20),
+	)
+}
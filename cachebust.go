@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type cacheBuster struct {
+	param  string
+	header string
+	prefix string
+	seq    uint64
+}
+
+func newCacheBuster(spec string) *cacheBuster {
+	c := &cacheBuster{prefix: strconv.FormatInt(time.Now().UnixNano(), 36)}
+
+	if name, ok := strings.CutPrefix(spec, "header:"); ok {
+		c.header = name
+	} else {
+		c.param = spec
+	}
+	return c
+}
+
+func (c *cacheBuster) bust(req *http.Request) {
+	value := c.prefix + "-" + strconv.FormatUint(atomic.AddUint64(&c.seq, 1), 36)
+
+	if c.header != "" {
+		req.Header.Set(c.header, value)
+		return
+	}
+	q := req.URL.Query()
+	q.Set(c.param, value)
+	req.URL.RawQuery = q.Encode()
+}
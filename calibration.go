@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	calibrationRows = 20
+	// calibrationShortfall is the share of the requested load below which
+	// the generator is considered not to have sustained it.
+	calibrationShortfall = 0.95
+)
+
+// scheduleReport shows the requested against the sent rate and, when the
+// generator fell short, what held it back, so that an under-delivered load
+// is not taken for a fast server.
+func (b *bench) scheduleReport() string {
+	table, share := b.schedule.calibration()
+	var sb strings.Builder
+	sb.WriteString(b.schedule.report())
+
+	if table == "" {
+		return sb.String()
+	}
+	sb.WriteString("\n\t\tRequested vs sent rate:\n" + table)
+
+	if share >= calibrationShortfall {
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "\t\t%s the generator sent %.1f%% of the requested load; the server was not measured at the requested rate\n", paint(colorYellow, "Warning:"), 100*share)
+
+	for _, limit := range b.rateLimits() {
+		fmt.Fprintf(&sb, "\t\t  limited by %s\n", limit)
+	}
+	return sb.String()
+}
+
+// rateLimits lists what held the generator back from the requested rate.
+func (b *bench) rateLimits() []string {
+	var limits []string
+
+	if b.inflight != nil {
+		if waits := atomic.LoadUint64(&b.inflight.waits); waits > 0 {
+			limits = append(limits, fmt.Sprintf("the -max-inflight cap of %d, which made requests wait %d times", cap(b.inflight.slots), waits))
+		}
+	}
+	if b.open {
+		if dropped := atomic.LoadUint64(&b.dropped); dropped > 0 {
+			limits = append(limits, fmt.Sprintf("the -c %d cap on requests in flight, which dropped %d arrivals", b.concurrency, dropped))
+		}
+	} else if b.stats.Runtime > 0 && b.concurrency > 0 {
+		throughput := float64(b.stats.RequestsTotal) / b.stats.Runtime.Seconds()
+
+		if busy := throughput * b.stats.DelayAvg.Seconds(); busy >= 0.9*float64(b.concurrency) {
+			limits = append(limits, fmt.Sprintf("the -c %d workers, all busy waiting on responses; raise -c or use -model open", b.concurrency))
+		}
+	}
+	if n := b.stats.RequestsNoFile; n > 0 {
+		limits = append(limits, fmt.Sprintf("file descriptors, %d requests failed with too many open files (raise 'ulimit -n')", n))
+	}
+	if b.monitor != nil {
+		if util, ok := b.monitor.cpuUtil(); ok && util > 90 {
+			limits = append(limits, fmt.Sprintf("the generator CPU, %.1f%% of %d cores busy", util, runtime.NumCPU()))
+		}
+	}
+	if len(limits) == 0 {
+		limits = append(limits, "nothing bench measures; see the generator health below")
+	}
+	return limits
+}
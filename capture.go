@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	captureMaxValues = 1000
+	captureOther     = "(other)"
+	captureMissing   = "(none)"
+)
+
+type headerCapture struct {
+	names []string
+
+	mu     sync.Mutex
+	counts []map[string]uint64
+	total  uint64
+}
+
+func newHeaderCapture(spec string) *headerCapture {
+	c := &headerCapture{}
+
+	for _, name := range strings.Split(spec, ",") {
+		name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+
+		if name != "" && !slices.Contains(c.names, name) {
+			c.names = append(c.names, name)
+			c.counts = append(c.counts, make(map[string]uint64))
+		}
+	}
+	return c
+}
+
+func (c *headerCapture) install(b *bench) {
+	b.onResponse(c.afterResponse)
+}
+
+func (c *headerCapture) afterResponse(resp *http.Response, err error, delay time.Duration) {
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.total++
+
+	for i, name := range c.names {
+		v := resp.Header.Get(name)
+
+		if v == "" {
+			v = captureMissing
+		}
+		counts := c.counts[i]
+
+		if _, ok := counts[v]; !ok && len(counts) >= captureMaxValues {
+			v = captureOther
+		}
+		counts[v]++
+	}
+}
+
+func (c *headerCapture) report() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var sb strings.Builder
+
+	for i, name := range c.names {
+		counts := c.counts[i]
+		values := make([]string, 0, len(counts))
+
+		for v := range counts {
+			values = append(values, v)
+		}
+		sort.Slice(values, func(a, b int) bool {
+			if counts[values[a]] != counts[values[b]] {
+				return counts[values[a]] > counts[values[b]]
+			}
+			return values[a] < values[b]
+		})
+		fmt.Fprintf(&sb, "\n\t\t%s (%d distinct):\n", name, len(values))
+
+		for _, v := range values {
+			fmt.Fprintf(&sb, "\t\t%s: %d (%.1f%%)\n", v, counts[v], 100*float64(counts[v])/float64(c.total))
+		}
+	}
+	return sb.String()
+}
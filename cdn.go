@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const cdnHeaders = "X-Cache,CF-Cache-Status,X-Cache-Status"
+
+type cdnStats struct {
+	hit     latencyStats
+	miss    latencyStats
+	other   latencyStats
+	unknown uint32
+
+	ageSum   uint64
+	ageCount uint32
+}
+
+func (c *cdnStats) install(b *bench) {
+	b.onResponse(c.afterResponse)
+}
+
+func (c *cdnStats) afterResponse(resp *http.Response, err error, delay time.Duration) {
+	if err != nil {
+		return
+	}
+	age, _ := strconv.ParseUint(resp.Header.Get("Age"), 10, 64)
+
+	switch cdnStatus(resp.Header, age) {
+	case "hit":
+		c.hit.add(delay)
+
+		if resp.Header.Get("Age") != "" {
+			atomic.AddUint64(&c.ageSum, age)
+			atomic.AddUint32(&c.ageCount, 1)
+		}
+	case "miss":
+		c.miss.add(delay)
+	case "other":
+		c.other.add(delay)
+	default:
+		atomic.AddUint32(&c.unknown, 1)
+	}
+}
+
+// cdnStatus classifies a response as served from the edge cache or fetched
+// from origin. For chained caches (e.g. Fastly "MISS, HIT") the last value is
+// the edge closest to the client.
+func cdnStatus(h http.Header, age uint64) string {
+	for _, name := range []string{"CF-Cache-Status", "X-Cache-Status", "X-Cache"} {
+		v := h.Get(name)
+
+		if v == "" {
+			continue
+		}
+		parts := strings.Split(v, ",")
+		v = strings.ToUpper(strings.TrimSpace(parts[len(parts)-1]))
+
+		switch {
+		case strings.Contains(v, "HIT"), strings.Contains(v, "STALE"),
+			strings.Contains(v, "REVALIDATED"), strings.Contains(v, "UPDATING"):
+			return "hit"
+		case strings.Contains(v, "MISS"), strings.Contains(v, "EXPIRED"):
+			return "miss"
+		default:
+			return "other"
+		}
+	}
+	if age > 0 {
+		return "hit"
+	}
+	return ""
+}
+
+func (c *cdnStats) report() string {
+	hits, misses := c.hit.samples(), c.miss.samples()
+	var ratio float64
+
+	if hits+misses > 0 {
+		ratio = 100 * float64(hits) / float64(hits+misses)
+	}
+	var avgAge float64
+
+	if n := atomic.LoadUint32(&c.ageCount); n > 0 {
+		avgAge = float64(atomic.LoadUint64(&c.ageSum)) / float64(n)
+	}
+	edge, origin := c.hit.avg(), c.miss.avg()
+	var split string
+
+	if edge > 0 && origin > 0 {
+		split = fmt.Sprintf("%.2fx", float64(origin)/float64(edge))
+	} else {
+		split = "n/a"
+	}
+	return fmt.Sprintf(`
+		CDN hit ratio: %.1f%%
+		Edge (hit) latency: %s
+		Origin (miss) latency: %s
+		Origin/edge latency: %s
+		Uncacheable (bypass/dynamic): %s
+		No cache status: %d
+		Average Age on hits: %.0fs
+	`,
+		ratio,
+		&c.hit,
+		&c.miss,
+		split,
+		&c.other,
+		atomic.LoadUint32(&c.unknown),
+		avgAge,
+	)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// churnStats measures connection setup when every request opens a connection
+// of its own, optionally torn down with a RST instead of a FIN.
+type churnStats struct {
+	reset    bool
+	connects latencyStats
+	failed   uint32
+}
+
+func (c *churnStats) dialed(start time.Time, err error) {
+	if err != nil {
+		atomic.AddUint32(&c.failed, 1)
+		return
+	}
+	c.connects.add(time.Since(start))
+}
+
+// abort makes the following Close reset the connection.
+func (c *churnStats) abort(conn net.Conn) {
+	if slow, ok := conn.(*slowConn); ok {
+		conn = slow.Conn
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok && c.reset {
+		tcp.SetLinger(0)
+	}
+}
+
+func (b *bench) churnReport() string {
+	teardown := "FIN"
+
+	if b.churn.reset {
+		teardown = "RST"
+	}
+	n := b.churn.connects.samples()
+
+	return fmt.Sprintf(`
+		Connection churn: one connection per request, closed with %s
+		Connections opened: %d (%.0f/s)
+		Connect latency: %s
+		Failed connects: %d
+	`,
+		teardown,
+		n, float64(n)/b.stats.Runtime.Seconds(),
+		&b.churn.connects,
+		atomic.LoadUint32(&b.churn.failed),
+	)
+}
@@ -0,0 +1,32 @@
+package main
+
+import "os"
+
+const (
+	colorRed    = "31"
+	colorGreen  = "32"
+	colorYellow = "33"
+)
+
+// useColor is set when stdout is a terminal that takes ANSI colors, unless
+// -no-color, NO_COLOR (https://no-color.org) or TERM=dumb turn them off.
+var useColor bool
+
+func setColor(disabled bool) {
+	useColor = !disabled && os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb" &&
+		isTerminal(os.Stdout) && enableColor(os.Stdout)
+}
+
+// isTerminal holds for consoles on Windows as for ttys elsewhere; files and
+// pipes, such as a CI log, get plain text.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func paint(color, s string) string {
+	if !useColor {
+		return s
+	}
+	return "\x1b[" + color + "m" + s + "\x1b[0m"
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// enableColor turns on ANSI escape handling of the console, which Windows
+// 10 and later support but leave off. Older consoles get plain text.
+func enableColor(f *os.File) bool {
+	h := windows.Handle(f.Fd())
+	var mode uint32
+
+	if err := windows.GetConsoleMode(h, &mode); err != nil {
+		return false
+	}
+	return windows.SetConsoleMode(h, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING) == nil
+}
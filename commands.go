@@ -0,0 +1,240 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// commands are the subcommands besides run. Arguments that don't start with a
+// known command name are treated as run flags, so "bench -n 10 -h URL" keeps
+// working.
+var commands = map[string]func(args []string) error{
+	"agent":           agentCommand,
+	"compare":         compareCommand,
+	"history":         historyCommand,
+	"matrix":          matrixCommand,
+	"merge":           mergeCommand,
+	"selftest-server": selftestCommand,
+}
+
+const commandsUsage = `Usage: bench [run] [flags] [URL...]
+       bench [run] --compat hey|ab [their flags] URL
+       bench agent [flags]
+       bench compare [flags] base.json new.json
+       bench history [flags]
+       bench matrix [flags] -- [run flags] [URL...]
+       bench merge [flags] result.json...
+       bench selftest-server [flags]
+
+Run "bench <command> -h" for the flags of a command.
+`
+
+func usage(fs *flag.FlagSet, synopsis string) {
+	fmt.Fprintf(fs.Output(), "Usage: bench %s\n", synopsis)
+	n := 0
+	fs.VisitAll(func(*flag.Flag) { n++ })
+
+	if n > 0 {
+		fmt.Fprint(fs.Output(), "\nFlags:\n")
+		fs.PrintDefaults()
+	}
+}
+
+func compareCommand(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	fs.Usage = func() { usage(fs, "compare [flags] base.json new.json") }
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("compare needs exactly two result files")
+	}
+	base, err := readResult(fs.Arg(0))
+
+	if err != nil {
+		return err
+	}
+	cur, err := readResult(fs.Arg(1))
+
+	if err != nil {
+		return err
+	}
+	fmt.Print(compareResults(base, cur))
+	return nil
+}
+
+func compareResults(base, cur *result) string {
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "Metric\t%s\t%s\tChange\n", base.Metadata.RunID, cur.Metadata.RunID)
+
+	row := func(name string, a, b float64, format func(float64) string) {
+		change := "-"
+
+		if a != 0 {
+			change = fmt.Sprintf("%+.1f%%", 100*(b-a)/a)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", name, format(a), format(b), change)
+	}
+	number := func(v float64) string { return fmt.Sprintf("%.0f", v) }
+	percent := func(v float64) string { return fmt.Sprintf("%.2f%%", v) }
+	latency := func(v float64) string { return formatLatency(time.Duration(v)) }
+
+	row("Requests", float64(base.Requests.Total), float64(cur.Requests.Total), number)
+	row("Requests per second", base.RPS, cur.RPS, number)
+	row("Errors", base.errorRate(), cur.errorRate(), percent)
+	row("Min delay", float64(base.Latency.MinNs), float64(cur.Latency.MinNs), latency)
+	row("Avg delay", float64(base.Latency.AvgNs), float64(cur.Latency.AvgNs), latency)
+	row("P50 delay", float64(base.Latency.P50Ns), float64(cur.Latency.P50Ns), latency)
+	row("P90 delay", float64(base.Latency.P90Ns), float64(cur.Latency.P90Ns), latency)
+	row("P99 delay", float64(base.Latency.P99Ns), float64(cur.Latency.P99Ns), latency)
+	row("P99.9 delay", float64(base.Latency.P999Ns), float64(cur.Latency.P999Ns), latency)
+	row("Max delay", float64(base.Latency.MaxNs), float64(cur.Latency.MaxNs), latency)
+	row("P50 TTFB", float64(base.TTFB.P50Ns), float64(cur.TTFB.P50Ns), latency)
+	row("P99 TTFB", float64(base.TTFB.P99Ns), float64(cur.TTFB.P99Ns), latency)
+	w.Flush()
+	return sb.String()
+}
+
+func (r *result) errorRate() float64 {
+	if r.Requests.Total == 0 {
+		return 0
+	}
+	return 100 * float64(r.Requests.Total-r.Requests.Success) / float64(r.Requests.Total)
+}
+
+func mergeCommand(args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	fs.Usage = func() { usage(fs, "merge [flags] result.json...") }
+	output := fs.String("o", "", "Write the merged result to this file instead of stdout")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("merge needs at least one result file")
+	}
+	results := make([]*result, 0, fs.NArg())
+
+	for _, path := range fs.Args() {
+		r, err := readResult(path)
+
+		if err != nil {
+			return err
+		}
+		results = append(results, r)
+	}
+	merged, err := mergeResults(results)
+
+	if err != nil {
+		return err
+	}
+	if *output != "" {
+		return writeResult(*output, merged)
+	}
+	data, err := marshalResult(merged)
+
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+// mergeResults combines results of generators that ran side by side: counts
+// and rates add up, latency distributions are merged bin by bin.
+func mergeResults(results []*result) (result, error) {
+	m := result{
+		SchemaVersion: resultVersion,
+		Metadata:      results[0].Metadata,
+	}
+	m.Metadata.RunID = newRunID()
+	m.Metadata.Version = toolVersion()
+	m.Metadata.Tags = make(map[string]string)
+
+	for k, v := range results[0].Metadata.Tags {
+		m.Metadata.Tags[k] = v
+	}
+	delays, ttfb := newSketch(), newSketch()
+	var (
+		sources               []string
+		delaySum, ttfbSum     float64
+		delayCount, ttfbCount uint64
+		delayMin, ttfbMin     time.Duration
+		delayMax, ttfbMax     time.Duration
+	)
+	for i, r := range results {
+		d, err := r.Latency.sketch()
+
+		if err != nil {
+			return m, err
+		}
+		t, err := r.TTFB.sketch()
+
+		if err != nil {
+			return m, err
+		}
+		sources = append(sources, r.Metadata.RunID)
+
+		if r.Metadata.Timestamp.Before(m.Metadata.Timestamp) {
+			m.Metadata.Timestamp = r.Metadata.Timestamp
+		}
+		m.RuntimeNs = max(m.RuntimeNs, r.RuntimeNs)
+		m.Concurrency += r.Concurrency
+		m.RPS += r.RPS
+		m.Requests.Total += r.Requests.Total
+		m.Requests.Success += r.Requests.Success
+		m.Requests.Fail += r.Requests.Fail
+		m.Requests.Timeout += r.Requests.Timeout
+		m.Requests.NoFile += r.Requests.NoFile
+		m.Bytes.Sent += r.Bytes.Sent
+		m.Bytes.Wire += r.Bytes.Wire
+		m.Bytes.Decoded += r.Bytes.Decoded
+
+		if n := d.count(); n > 0 {
+			if delayCount == 0 || r.Latency.MinNs < delayMin {
+				delayMin = r.Latency.MinNs
+			}
+			delayMax = max(delayMax, r.Latency.MaxNs)
+			delaySum += float64(r.Latency.AvgNs) * float64(n)
+			delayCount += n
+		}
+		if n := t.count(); n > 0 {
+			if ttfbCount == 0 || r.TTFB.MinNs < ttfbMin {
+				ttfbMin = r.TTFB.MinNs
+			}
+			ttfbMax = max(ttfbMax, r.TTFB.MaxNs)
+			ttfbSum += float64(r.TTFB.AvgNs) * float64(n)
+			ttfbCount += n
+		}
+		delays.merge(&d)
+		ttfb.merge(&t)
+
+		if i > 0 {
+			for k, v := range m.Metadata.Tags {
+				if r.Metadata.Tags[k] != v {
+					delete(m.Metadata.Tags, k)
+				}
+			}
+		}
+	}
+	m.Metadata.Tags["merged_from"] = strings.Join(sources, ",")
+
+	var delayAvg, ttfbAvg time.Duration
+
+	if delayCount > 0 {
+		delayAvg = time.Duration(delaySum / float64(delayCount))
+	}
+	if ttfbCount > 0 {
+		ttfbAvg = time.Duration(ttfbSum / float64(ttfbCount))
+	}
+	m.Latency = newResultLatency(&delays, delayMin, delayAvg, delayMax)
+	m.TTFB = newResultLatency(&ttfb, ttfbMin, ttfbAvg, ttfbMax)
+	m.Timeline = mergeTimelines(results)
+	return m, nil
+}
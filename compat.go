@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// compatFlag maps one flag of another tool onto bench flags. Flags whose
+// behavior bench already has by default translate to nothing.
+type compatFlag struct {
+	value     bool
+	translate func(v string) ([]string, error)
+}
+
+func same(name string) func(string) ([]string, error) {
+	return func(v string) ([]string, error) { return []string{"-" + name, v}, nil }
+}
+
+func setFlag(name string) func(string) ([]string, error) {
+	return func(string) ([]string, error) { return []string{"-" + name}, nil }
+}
+
+func ignore(string) ([]string, error) { return nil, nil }
+
+func headerFlag(name string) func(string) ([]string, error) {
+	return func(v string) ([]string, error) { return []string{"-H", name + ": " + v}, nil }
+}
+
+func basicAuth(v string) ([]string, error) {
+	return []string{"-H", "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(v))}, nil
+}
+
+func seconds(v string) (time.Duration, error) {
+	s, err := strconv.ParseFloat(v, 64)
+
+	if err != nil || s < 0 {
+		return 0, fmt.Errorf("invalid number of seconds %q", v)
+	}
+	return time.Duration(s * float64(time.Second)), nil
+}
+
+func timeoutSeconds(v string) ([]string, error) {
+	d, err := seconds(v)
+
+	if err != nil {
+		return nil, err
+	}
+	return []string{"-t", strconv.FormatInt(d.Milliseconds(), 10)}, nil
+}
+
+// unlimited stands in for "no request limit" when a tool runs for a duration.
+var unlimited = strconv.FormatUint(unlimitedRequests, 10)
+
+func bodyFile(method string) func(string) ([]string, error) {
+	return func(v string) ([]string, error) { return []string{"-m", method, "-upload-file", v}, nil }
+}
+
+var compatFlags = map[string]map[string]compatFlag{
+	"hey": {
+		"n": {true, same("n")},
+		"c": {true, same("c")},
+		"m": {true, same("m")},
+		"t": {true, timeoutSeconds},
+		"z": {true, func(v string) ([]string, error) {
+			d, err := time.ParseDuration(v)
+
+			if err != nil {
+				return nil, err
+			}
+			return []string{"-n", unlimited, "-max-duration", d.String()}, nil
+		}},
+		"H":                   {true, same("H")},
+		"A":                   {true, headerFlag("Accept")},
+		"T":                   {true, headerFlag("Content-Type")},
+		"a":                   {true, basicAuth},
+		"d":                   {true, same("d")},
+		"D":                   {true, same("upload-file")},
+		"cpus":                {true, same("gomaxprocs")},
+		"h2":                  {false, ignore},
+		"disable-redirects":   {false, ignore},
+		"disable-compression": {false, func(string) ([]string, error) { return []string{"-accept-encoding", "identity"}, nil }},
+	},
+	"ab": {
+		"n": {true, same("n")},
+		"c": {true, same("c")},
+		"t": {true, func(v string) ([]string, error) {
+			d, err := seconds(v)
+
+			if err != nil {
+				return nil, err
+			}
+			return []string{"-n", "50000", "-max-duration", d.String()}, nil
+		}},
+		"s": {true, timeoutSeconds},
+		"m": {true, same("m")},
+		"p": {true, bodyFile("POST")},
+		"u": {true, bodyFile("PUT")},
+		"T": {true, headerFlag("Content-Type")},
+		"H": {true, same("H")},
+		"C": {true, headerFlag("Cookie")},
+		"A": {true, basicAuth},
+		"q": {false, setFlag("q")},
+		"k": {false, ignore},
+		"r": {false, ignore},
+	},
+}
+
+// compatDefaults are the tools' own defaults where they differ from bench's.
+var compatDefaults = map[string][]string{
+	"hey": {"-n", "200", "-c", "50"},
+	"ab":  {"-n", "1"},
+}
+
+// hey -q is a per-worker limit; it becomes one constant total rate.
+func heyRate(qps string, concurrency string) ([]string, error) {
+	q, err := strconv.ParseFloat(qps, 64)
+
+	if err != nil || q <= 0 {
+		return nil, fmt.Errorf("invalid rate %q", qps)
+	}
+	c, err := strconv.ParseFloat(concurrency, 64)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid concurrency %q", concurrency)
+	}
+	return []string{"-rate", strconv.FormatFloat(q*c, 'f', -1, 64)}, nil
+}
+
+// cutCompat recognizes a leading --compat tool or --compat=tool.
+func cutCompat(args []string) (tool string, rest []string, ok bool) {
+	if len(args) == 0 {
+		return "", nil, false
+	}
+	name, value, hasValue := strings.Cut(strings.TrimLeft(args[0], "-"), "=")
+
+	if name != "compat" || !strings.HasPrefix(args[0], "-") {
+		return "", nil, false
+	}
+	if hasValue {
+		return value, args[1:], true
+	}
+	if len(args) < 2 {
+		return "", nil, true
+	}
+	return args[1], args[2:], true
+}
+
+// compatArgs translates the command line of hey or ab into bench run flags.
+// The URL is the last positional argument, as in both tools.
+func compatArgs(tool string, args []string) ([]string, error) {
+	flags, ok := compatFlags[tool]
+
+	if !ok {
+		return nil, fmt.Errorf("unknown compat mode %q, expected hey or ab", tool)
+	}
+	var (
+		out         = append([]string(nil), compatDefaults[tool]...)
+		target      string
+		qps         string
+		concurrency = "50"
+	)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			if target != "" {
+				return nil, fmt.Errorf("%s: unexpected argument %q", tool, arg)
+			}
+			target = arg
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+
+		if tool == "hey" && name == "q" {
+			if !hasValue && i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+			qps = value
+			continue
+		}
+		f, ok := flags[name]
+
+		if !ok {
+			return nil, fmt.Errorf("%s flag -%s is not supported by bench", tool, name)
+		}
+		if f.value && !hasValue {
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("%s flag -%s needs a value", tool, name)
+			}
+			i++
+			value = args[i]
+		}
+		if name == "c" {
+			concurrency = value
+		}
+		translated, err := f.translate(value)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s flag -%s: %w", tool, name, err)
+		}
+		out = append(out, translated...)
+	}
+	if target == "" {
+		return nil, fmt.Errorf("%s: missing URL", tool)
+	}
+	if qps != "" {
+		rate, err := heyRate(qps, concurrency)
+
+		if err != nil {
+			return nil, fmt.Errorf("hey flag -q: %w", err)
+		}
+		out = append(out, rate...)
+	}
+	return append(out, "-h", target), nil
+}
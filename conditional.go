@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type conditional struct {
+	validators sync.Map
+
+	notModified   uint32
+	conditional   latencyStats
+	unconditional latencyStats
+}
+
+type validator struct {
+	etag         string
+	lastModified string
+}
+
+func (c *conditional) install(b *bench) {
+	b.onRequest(c.beforeRequest)
+	b.onResponse(c.afterResponse)
+}
+
+func (c *conditional) beforeRequest(req *http.Request) {
+	v, ok := c.validators.Load(req.URL.String())
+
+	if !ok {
+		return
+	}
+	val := v.(validator)
+
+	if val.etag != "" {
+		req.Header.Set("If-None-Match", val.etag)
+	}
+	if val.lastModified != "" {
+		req.Header.Set("If-Modified-Since", val.lastModified)
+	}
+}
+
+func (c *conditional) afterResponse(resp *http.Response, err error, delay time.Duration) {
+	if err != nil {
+		return
+	}
+	req := resp.Request
+
+	if req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		c.conditional.add(delay)
+	} else {
+		c.unconditional.add(delay)
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		atomic.AddUint32(&c.notModified, 1)
+		return
+	}
+	val := validator{
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+	}
+	if val.etag != "" || val.lastModified != "" {
+		c.validators.Store(req.URL.String(), val)
+	}
+}
+
+func (c *conditional) report() string {
+	c.conditional.mu.Lock()
+	n := c.conditional.count
+	c.conditional.mu.Unlock()
+
+	notModified := atomic.LoadUint32(&c.notModified)
+	ratio := 0.0
+
+	if n > 0 {
+		ratio = float64(notModified) / float64(n) * 100
+	}
+	return fmt.Sprintf(`
+		Conditional requests: %d
+		Not modified (304): %d (%.2f%%)
+		Conditional latency: %s
+		Unconditional latency: %s
+	`,
+		n,
+		notModified,
+		ratio,
+		&c.conditional,
+		&c.unconditional,
+	)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// contention sends every request together with n-1 identical copies released
+// at the same moment, to exercise the server's locking and conflict handling
+// for a single resource.
+type contention struct {
+	n       int
+	pending sync.WaitGroup
+
+	batches  uint32
+	single   uint32
+	multiple uint32
+	none     uint32
+	winners  latencyStats
+	losers   latencyStats
+
+	mu       sync.Mutex
+	statuses map[int]uint32
+}
+
+type contentionBatch struct {
+	wg       sync.WaitGroup
+	statuses []int
+	delays   []time.Duration
+}
+
+func newContention(n uint) *contention {
+	return &contention{n: int(n), statuses: make(map[int]uint32)}
+}
+
+// do sends r and its copies. Only r's outcome is returned; the copies are
+// drained in the background and accounted for once the whole batch is done.
+func (c *contention) do(ctx context.Context, client *http.Client, r *http.Request, data []byte) (*http.Response, error) {
+	batch := &contentionBatch{statuses: make([]int, c.n), delays: make([]time.Duration, c.n)}
+	ready := make(chan struct{})
+
+	for i := 1; i < c.n; i++ {
+		dup := r.Clone(ctx)
+
+		if data != nil {
+			dup.Body = io.NopCloser(bytes.NewReader(data))
+			dup.ContentLength = int64(len(data))
+		}
+		batch.wg.Add(1)
+
+		go func(i int) {
+			defer batch.wg.Done()
+			<-ready
+			start := time.Now()
+			resp, err := client.Do(dup)
+
+			if err == nil {
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+				batch.statuses[i] = resp.StatusCode
+			}
+			batch.delays[i] = time.Since(start)
+		}(i)
+	}
+	close(ready)
+	start := time.Now()
+	resp, err := client.Do(r)
+	batch.delays[0] = time.Since(start)
+
+	if err == nil {
+		batch.statuses[0] = resp.StatusCode
+	}
+	c.pending.Add(1)
+
+	go func() {
+		batch.wg.Wait()
+		c.add(batch)
+		c.pending.Done()
+	}()
+	return resp, err
+}
+
+func (c *contention) add(batch *contentionBatch) {
+	won := 0
+
+	for i, status := range batch.statuses {
+		if status >= 200 && status < 300 {
+			won++
+			c.winners.add(batch.delays[i])
+		} else {
+			c.losers.add(batch.delays[i])
+		}
+	}
+	switch {
+	case won == 0:
+		atomic.AddUint32(&c.none, 1)
+	case won == 1:
+		atomic.AddUint32(&c.single, 1)
+	default:
+		atomic.AddUint32(&c.multiple, 1)
+	}
+	atomic.AddUint32(&c.batches, 1)
+
+	c.mu.Lock()
+	for _, status := range batch.statuses {
+		c.statuses[status]++
+	}
+	c.mu.Unlock()
+}
+
+func (c *contention) report() string {
+	c.pending.Wait()
+	c.mu.Lock()
+	codes := make([]int, 0, len(c.statuses))
+
+	for code := range c.statuses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	var sb strings.Builder
+
+	for _, code := range codes {
+		name := fmt.Sprint(code)
+
+		if code == 0 {
+			name = "error"
+		}
+		fmt.Fprintf(&sb, "\t\t  %s: %d\n", name, c.statuses[code])
+	}
+	c.mu.Unlock()
+
+	return fmt.Sprintf(`
+		Contention: %d identical requests per batch
+		Batches: %d
+		Batches with one success: %d
+		Batches with several successes: %d
+		Batches with no success: %d
+		Success latency: %s
+		Conflict/failure latency: %s
+		Statuses:
+%s`,
+		c.n,
+		atomic.LoadUint32(&c.batches),
+		atomic.LoadUint32(&c.single),
+		atomic.LoadUint32(&c.multiple),
+		atomic.LoadUint32(&c.none),
+		&c.winners,
+		&c.losers,
+		sb.String(),
+	)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	cooldownInterval  = 200 * time.Millisecond
+	cooldownBaseline  = 10
+	cooldownSettle    = 5
+	cooldownTolerance = 1.5
+)
+
+// cooldown probes the target at a trickle after the main load and measures
+// how long latency takes to get back to the baseline taken before the load.
+type cooldown struct {
+	duration time.Duration
+	baseline time.Duration
+	loadEnd  int64
+
+	probes  latencyStats
+	failed  uint32
+	settled time.Duration
+}
+
+func (c *cooldown) measureBaseline(b *bench, t task) {
+	c.settled = -1
+	delays := make([]time.Duration, 0, cooldownBaseline)
+
+	for i := 0; i < cooldownBaseline; i++ {
+		if d, err := b.probe(t); err == nil {
+			delays = append(delays, d)
+		}
+	}
+	if len(delays) > 0 {
+		sort.Slice(delays, func(i, j int) bool { return delays[i] < delays[j] })
+		c.baseline = delays[len(delays)/2]
+	}
+}
+
+func (c *cooldown) run(b *bench, t task) {
+	end := time.Now()
+	atomic.StoreInt64(&c.loadEnd, end.UnixNano())
+	c.settled = -1
+
+	ticker := time.NewTicker(cooldownInterval)
+	defer ticker.Stop()
+	var streak time.Time
+
+	for n := 0; time.Since(end) < c.duration; <-ticker.C {
+		start := time.Now()
+		d, err := b.probe(t)
+
+		if err != nil {
+			atomic.AddUint32(&c.failed, 1)
+			n = 0
+			continue
+		}
+		c.probes.add(d)
+
+		if c.baseline == 0 || float64(d) > float64(c.baseline)*cooldownTolerance {
+			n = 0
+			continue
+		}
+		if n == 0 {
+			streak = start
+		}
+		if n++; n == cooldownSettle {
+			c.settled = streak.Sub(end)
+			return
+		}
+	}
+}
+
+func (c *cooldown) ended() (time.Time, bool) {
+	if ns := atomic.LoadInt64(&c.loadEnd); ns != 0 {
+		return time.Unix(0, ns), true
+	}
+	return time.Time{}, false
+}
+
+func (c *cooldown) report() string {
+	settled := fmt.Sprintf("not within %s", c.duration)
+
+	if _, ok := c.ended(); !ok {
+		settled = "skipped, the run was stopped"
+	} else if c.baseline == 0 {
+		settled = "unknown, baseline probes failed"
+	} else if c.settled >= 0 {
+		settled = c.settled.Round(time.Millisecond).String()
+	}
+	return fmt.Sprintf(`
+		Baseline latency (before load): %s
+		Cooldown probes: %s
+		Cooldown probe failures: %d
+		Back to baseline after: %s
+	`,
+		c.baseline,
+		&c.probes,
+		atomic.LoadUint32(&c.failed),
+		settled,
+	)
+}
+
+func (b *bench) probe(t task) (time.Duration, error) {
+	req, err := http.NewRequest(t.method, t.url, nil)
+
+	if err != nil {
+		return 0, err
+	}
+	req.Header = t.header.Clone()
+
+	if t.data != nil {
+		req.Body = io.NopCloser(bytes.NewReader(t.data))
+		req.ContentLength = int64(len(t.data))
+	}
+	start := time.Now()
+	resp, err := b.client.Do(req)
+
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return time.Since(start), nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const debugVerbose = 10
+
+// debugSampler prints full exchanges for the first count requests, or for a
+// random fraction of them.
+type debugSampler struct {
+	count    uint32
+	fraction float64
+
+	picked uint32
+	mu     sync.Mutex
+}
+
+func newDebugSampler(spec string) (*debugSampler, error) {
+	if n, err := strconv.ParseUint(spec, 10, 32); err == nil {
+		return &debugSampler{count: uint32(n)}, nil
+	}
+	f, err := parseFraction(spec)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid debug sample %q, expected a count or a fraction such as 1%%", spec)
+	}
+	return &debugSampler{fraction: f}, nil
+}
+
+func (d *debugSampler) pick() (uint32, bool) {
+	if d.fraction > 0 {
+		if rand.Float64() >= d.fraction {
+			return 0, false
+		}
+		return atomic.AddUint32(&d.picked, 1), true
+	}
+	if atomic.LoadUint32(&d.picked) >= d.count {
+		return 0, false
+	}
+	n := atomic.AddUint32(&d.picked, 1)
+	return n, n <= d.count
+}
+
+func (d *debugSampler) print(id uint32, request, response []byte, err error, delay time.Duration) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- request %d\n", id)
+	writePrefixed(&sb, "> ", request)
+
+	if err != nil {
+		fmt.Fprintf(&sb, "! %s (%s)\n", err, delay)
+	} else {
+		writePrefixed(&sb, "< ", response)
+		fmt.Fprintf(&sb, "(%s)\n", delay)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	os.Stderr.WriteString(sb.String())
+}
+
+func writePrefixed(sb *strings.Builder, prefix string, data []byte) {
+	if len(data) > dryRunBodyLimit {
+		data = append(data[:dryRunBodyLimit:dryRunBodyLimit], fmt.Sprintf("\n... %d more bytes", len(data)-dryRunBodyLimit)...)
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\r\n"), "\n") {
+		sb.WriteString(prefix)
+		sb.WriteString(strings.TrimRight(line, "\r"))
+		sb.WriteByte('\n')
+	}
+}
+
+// dumpRequest prints the request as sent. A streamed upload is left unread:
+// dumping it would buffer the whole body, which can be far larger than memory.
+func dumpRequest(req *http.Request, streamed bool) []byte {
+	dump, err := httputil.DumpRequestOut(req, !streamed)
+
+	if err != nil {
+		return []byte(err.Error())
+	}
+	if streamed && req.ContentLength > 0 {
+		dump = append(dump, fmt.Sprintf("(upload body of %s not shown)\n", formatBytes(req.ContentLength))...)
+	} else if streamed {
+		dump = append(dump, "(chunked upload body not shown)\n"...)
+	}
+	return dump
+}
+
+// dumpResponse reads the whole body for printing and puts it back so the
+// rest of the pipeline still sees it.
+func dumpResponse(resp *http.Response) []byte {
+	body := hookBody(resp)
+	dump, _ := httputil.DumpResponse(resp, false)
+	return append(dump, body...)
+}
+
+func (d *debugSampler) fastHTTP(id uint32, req *fasthttp.Request, resp *fasthttp.Response, err error, delay time.Duration) {
+	d.print(id, []byte(req.String()), []byte(resp.String()), err, delay)
+}
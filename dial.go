@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type dialer struct {
+	net.Dialer
+
+	network  string
+	stats    *stats
+	resolver *resolver
+	churn    *churnStats
+	slow     *slowClient
+
+	tlsConfig *tls.Config
+	poolAddr  string
+	pool      chan net.Conn
+}
+
+func newDialer(network string, timeout time.Duration, s *stats) *dialer {
+	return &dialer{
+		Dialer: net.Dialer{
+			Timeout:   timeout,
+			KeepAlive: 30 * time.Second,
+		},
+		network: network,
+		stats:   s,
+	}
+}
+
+func (d *dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if conn := d.pooled(addr); conn != nil {
+		return conn, nil
+	}
+	return d.dial(ctx, network, addr)
+}
+
+func (d *dialer) DialTLSContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if conn := d.pooled(addr); conn != nil {
+		return conn, nil
+	}
+	return d.dialTLS(ctx, network, addr)
+}
+
+func (d *dialer) Preconnect(ctx context.Context, u *url.URL, n int) error {
+	addr := hostPort(u)
+	d.poolAddr = addr
+	d.pool = make(chan net.Conn, n)
+
+	if u.Scheme == "https" {
+		d.tlsConfig = &tls.Config{
+			ServerName: u.Hostname(),
+			NextProtos: []string{"http/1.1"},
+		}
+	}
+	var (
+		wg   sync.WaitGroup
+		once sync.Once
+		err  error
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var (
+				conn    net.Conn
+				dialErr error
+			)
+			if d.tlsConfig != nil {
+				conn, dialErr = d.dialTLS(ctx, "tcp", addr)
+			} else {
+				conn, dialErr = d.dial(ctx, "tcp", addr)
+			}
+			if dialErr != nil {
+				once.Do(func() { err = dialErr })
+				return
+			}
+			d.pool <- conn
+		}()
+	}
+	wg.Wait()
+	return err
+}
+
+func (d *dialer) pooled(addr string) net.Conn {
+	if d.pool == nil || addr != d.poolAddr {
+		return nil
+	}
+	select {
+	case conn := <-d.pool:
+		return conn
+	default:
+		return nil
+	}
+}
+
+func (d *dialer) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	if d.network != "" {
+		network = d.network
+	}
+	start := time.Now()
+	conn, err := d.connect(ctx, network, addr)
+
+	if d.churn != nil {
+		d.churn.dialed(start, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	d.countFamily(conn)
+	atomic.AddInt64(&d.stats.ConnectionsOpen, 1)
+
+	if d.slow != nil {
+		conn = d.slow.wrap(conn)
+	}
+	return &trackedConn{Conn: conn, open: &d.stats.ConnectionsOpen, churn: d.churn}, nil
+}
+
+// connect dials the addresses from the resolver in order when one is set,
+// instead of letting the dialer resolve the host.
+func (d *dialer) connect(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+
+	if d.resolver == nil || err != nil || net.ParseIP(host) != nil {
+		return d.Dialer.DialContext(ctx, network, addr)
+	}
+	ips, err := d.resolver.resolve(ctx, host)
+
+	if err != nil {
+		return nil, err
+	}
+	err = fmt.Errorf("no %s address for %s", network, host)
+
+	for _, ip := range ips {
+		if (network == "tcp4" && ip.To4() == nil) || (network == "tcp6" && ip.To4() != nil) {
+			continue
+		}
+		var conn net.Conn
+
+		if conn, err = d.Dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port)); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+func (d *dialer) dialTLS(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := d.dial(ctx, network, addr)
+
+	if err != nil {
+		return nil, err
+	}
+	tlsConn := tls.Client(conn, d.tlsConfig)
+
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+func (d *dialer) countFamily(conn net.Conn) {
+	addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+
+	if !ok {
+		return
+	}
+	if addr.IP.To4() != nil {
+		atomic.AddUint32(&d.stats.ConnectionsIPv4, 1)
+	} else {
+		atomic.AddUint32(&d.stats.ConnectionsIPv6, 1)
+	}
+}
+
+type trackedConn struct {
+	net.Conn
+
+	open   *int64
+	closed uint32
+	churn  *churnStats
+}
+
+func (c *trackedConn) Close() error {
+	if atomic.CompareAndSwapUint32(&c.closed, 0, 1) {
+		atomic.AddInt64(c.open, -1)
+	}
+	if c.churn != nil {
+		c.churn.abort(c.Conn)
+	}
+	return c.Conn.Close()
+}
+
+func hostPort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return net.JoinHostPort(u.Hostname(), port)
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+type digestTransport struct {
+	next     http.RoundTripper
+	username string
+	password string
+
+	mu   sync.Mutex
+	chal *digestChallenge
+	nc   uint32
+}
+
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+}
+
+func newDigestTransport(next http.RoundTripper, credentials string) *digestTransport {
+	username, password, _ := strings.Cut(credentials, ":")
+
+	return &digestTransport{
+		next:     next,
+		username: username,
+		password: password,
+	}
+}
+
+func (t *digestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+		req.Body.Close()
+	}
+	resp, err := t.next.RoundTrip(t.authorize(req, body))
+
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	chal := parseDigestChallenge(resp.Header.Values("WWW-Authenticate"))
+
+	if chal == nil {
+		return resp, nil
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	t.mu.Lock()
+	t.chal = chal
+	t.nc = 0
+	t.mu.Unlock()
+
+	return t.next.RoundTrip(t.authorize(req, body))
+}
+
+func (t *digestTransport) authorize(req *http.Request, body []byte) *http.Request {
+	r := req.Clone(req.Context())
+
+	if body != nil {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	t.mu.Lock()
+	chal := t.chal
+	t.nc++
+	nc := t.nc
+	t.mu.Unlock()
+
+	if chal != nil {
+		r.Header.Set("Authorization", chal.authorization(t.username, t.password, r.Method, r.URL.RequestURI(), nc))
+	}
+	return r
+}
+
+func (c *digestChallenge) authorization(username, password, method, uri string, nc uint32) string {
+	var h func() hash.Hash
+
+	switch strings.ToUpper(strings.TrimSuffix(c.algorithm, "-sess")) {
+	case "SHA-256":
+		h = sha256.New
+	default:
+		h = md5.New
+	}
+	digest := func(parts ...string) string {
+		d := h()
+		io.WriteString(d, strings.Join(parts, ":"))
+		return hex.EncodeToString(d.Sum(nil))
+	}
+	cnonce := make([]byte, 8)
+	rand.Read(cnonce)
+	cn := hex.EncodeToString(cnonce)
+	ncs := fmt.Sprintf("%08x", nc)
+
+	ha1 := digest(username, c.realm, password)
+
+	if strings.HasSuffix(strings.ToLower(c.algorithm), "-sess") {
+		ha1 = digest(ha1, c.nonce, cn)
+	}
+	ha2 := digest(method, uri)
+
+	var response string
+
+	if c.qop != "" {
+		response = digest(ha1, c.nonce, ncs, cn, c.qop, ha2)
+	} else {
+		response = digest(ha1, c.nonce, ha2)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+		username, c.realm, c.nonce, uri, response)
+
+	if c.algorithm != "" {
+		fmt.Fprintf(&sb, ", algorithm=%s", c.algorithm)
+	}
+	if c.opaque != "" {
+		fmt.Fprintf(&sb, `, opaque="%s"`, c.opaque)
+	}
+	if c.qop != "" {
+		fmt.Fprintf(&sb, `, qop=%s, nc=%s, cnonce="%s"`, c.qop, ncs, cn)
+	}
+	return sb.String()
+}
+
+func parseDigestChallenge(headers []string) *digestChallenge {
+	var best *digestChallenge
+
+	for _, header := range headers {
+		scheme, rest, _ := strings.Cut(header, " ")
+
+		if !strings.EqualFold(scheme, "Digest") {
+			continue
+		}
+		params := parseAuthParams(rest)
+		c := &digestChallenge{
+			realm:     params["realm"],
+			nonce:     params["nonce"],
+			opaque:    params["opaque"],
+			algorithm: params["algorithm"],
+		}
+		for _, qop := range strings.Split(params["qop"], ",") {
+			if strings.TrimSpace(qop) == "auth" {
+				c.qop = "auth"
+			}
+		}
+		if best == nil || strings.HasPrefix(strings.ToUpper(c.algorithm), "SHA-256") {
+			best = c
+		}
+	}
+	return best
+}
+
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimLeft(s, " ,") {
+		key, rest, ok := strings.Cut(s, "=")
+
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		var value string
+
+		if strings.HasPrefix(rest, `"`) {
+			end := 1
+
+			for end < len(rest) && rest[end] != '"' {
+				if rest[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			value = strings.ReplaceAll(rest[1:min(end, len(rest))], `\`, "")
+			s = rest[min(end+1, len(rest)):]
+		} else {
+			value, s, _ = strings.Cut(rest, ",")
+			value = strings.TrimSpace(value)
+		}
+		params[key] = value
+	}
+	return params
+}
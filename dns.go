@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	dnsCacheNone    = "none"
+	dnsCacheTTL     = "ttl"
+	dnsCacheForever = "forever"
+
+	// dnsFallbackTTL applies to answers from the system resolver, which
+	// doesn't expose record TTLs, e.g. for names from /etc/hosts.
+	dnsFallbackTTL = time.Minute
+	dnsTimeout     = 5 * time.Second
+	dnsReportLimit = 10
+)
+
+// resolver resolves target hosts for the dialer: every connection (none),
+// once per record TTL (ttl), or once for the whole run (forever).
+type resolver struct {
+	mode       string
+	nameserver string
+
+	mu    sync.Mutex
+	cache map[string]dnsEntry
+	seen  map[string]struct{}
+
+	lookups uint64
+	hits    uint64
+}
+
+type dnsEntry struct {
+	addrs   []net.IP
+	expires time.Time
+}
+
+func newResolver(mode string) (*resolver, error) {
+	switch mode {
+	case dnsCacheNone, dnsCacheTTL, dnsCacheForever:
+	default:
+		return nil, fmt.Errorf("invalid dns-cache %q, expected ttl, none or forever", mode)
+	}
+	return &resolver{
+		mode:       mode,
+		nameserver: systemNameserver(),
+		cache:      make(map[string]dnsEntry),
+		seen:       make(map[string]struct{}),
+	}, nil
+}
+
+func systemNameserver() string {
+	f, err := os.Open("/etc/resolv.conf")
+
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+
+	for s.Scan() {
+		if fields := strings.Fields(s.Text()); len(fields) > 1 && fields[0] == "nameserver" {
+			return net.JoinHostPort(fields[1], "53")
+		}
+	}
+	return ""
+}
+
+func (r *resolver) resolve(ctx context.Context, host string) ([]net.IP, error) {
+	if r.mode == dnsCacheNone {
+		addrs, _, err := r.lookup(ctx, host)
+
+		if err == nil {
+			r.mu.Lock()
+			r.remember(addrs)
+			r.mu.Unlock()
+		}
+		return addrs, err
+	}
+	// Holding the lock across the lookup keeps workers dialing at the same
+	// time from resolving the same name in parallel.
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e, ok := r.cache[host]; ok && (r.mode == dnsCacheForever || time.Now().Before(e.expires)) {
+		atomic.AddUint64(&r.hits, 1)
+		return e.addrs, nil
+	}
+	addrs, ttl, err := r.lookup(ctx, host)
+
+	if err != nil {
+		return nil, err
+	}
+	r.remember(addrs)
+	r.cache[host] = dnsEntry{addrs: addrs, expires: time.Now().Add(ttl)}
+	return addrs, nil
+}
+
+func (r *resolver) lookup(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+	atomic.AddUint64(&r.lookups, 1)
+	var (
+		addrs []net.IP
+		ttl   time.Duration
+		err   = errors.New("no nameserver")
+	)
+	if r.mode == dnsCacheTTL && r.nameserver != "" {
+		addrs, ttl, err = queryTTL(ctx, r.nameserver, host)
+	}
+	if err != nil || len(addrs) == 0 {
+		ipAddrs, lookupErr := net.DefaultResolver.LookupIPAddr(ctx, host)
+
+		if lookupErr != nil {
+			return nil, 0, lookupErr
+		}
+		addrs, ttl = addrs[:0], dnsFallbackTTL
+
+		for _, a := range ipAddrs {
+			addrs = append(addrs, a.IP)
+		}
+	}
+	return addrs, ttl, nil
+}
+
+// remember must be called with r.mu held.
+func (r *resolver) remember(addrs []net.IP) {
+	for _, a := range addrs {
+		r.seen[a.String()] = struct{}{}
+	}
+}
+
+// queryTTL asks the nameserver for the A and AAAA records of host, returning
+// the smallest TTL in the answers.
+func queryTTL(ctx context.Context, server, host string) ([]net.IP, time.Duration, error) {
+	var (
+		addrs []net.IP
+		ttl   = time.Duration(-1)
+	)
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		a, t, err := query(ctx, server, host, qtype)
+
+		if err != nil {
+			return nil, 0, err
+		}
+		addrs = append(addrs, a...)
+
+		if len(a) > 0 && (ttl < 0 || t < ttl) {
+			ttl = t
+		}
+	}
+	return addrs, max(ttl, 0), nil
+}
+
+func query(ctx context.Context, server, host string, qtype dnsmessage.Type) ([]net.IP, time.Duration, error) {
+	name, err := dnsmessage.NewName(strings.TrimSuffix(host, ".") + ".")
+
+	if err != nil {
+		return nil, 0, err
+	}
+	id := uint16(rand.Uint32())
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	b.StartQuestions()
+	b.Question(dnsmessage.Question{Name: name, Type: qtype, Class: dnsmessage.ClassINET})
+	msg, err := b.Finish()
+
+	if err != nil {
+		return nil, 0, err
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", server)
+
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+	deadline, ok := ctx.Deadline()
+
+	if !ok {
+		deadline = time.Now().Add(dnsTimeout)
+	}
+	conn.SetDeadline(deadline)
+
+	if _, err := conn.Write(msg); err != nil {
+		return nil, 0, err
+	}
+	buf := make([]byte, 4096)
+	var p dnsmessage.Parser
+
+	for {
+		n, err := conn.Read(buf)
+
+		if err != nil {
+			return nil, 0, err
+		}
+		h, err := p.Start(buf[:n])
+
+		if err != nil || h.ID != id {
+			continue
+		}
+		if h.Truncated {
+			return nil, 0, errors.New("truncated DNS response")
+		}
+		if h.RCode != dnsmessage.RCodeSuccess {
+			return nil, 0, fmt.Errorf("DNS query for %s failed: %s", host, h.RCode)
+		}
+		break
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil, 0, err
+	}
+	var (
+		addrs []net.IP
+		ttl   = time.Duration(-1)
+	)
+	for {
+		ah, err := p.AnswerHeader()
+
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if t := time.Duration(ah.TTL) * time.Second; ttl < 0 || t < ttl {
+			ttl = t
+		}
+		switch ah.Type {
+		case dnsmessage.TypeA:
+			rr, err := p.AResource()
+
+			if err != nil {
+				return nil, 0, err
+			}
+			addrs = append(addrs, net.IP(rr.A[:]))
+		case dnsmessage.TypeAAAA:
+			rr, err := p.AAAAResource()
+
+			if err != nil {
+				return nil, 0, err
+			}
+			addrs = append(addrs, net.IP(rr.AAAA[:]))
+		default:
+			if err := p.SkipAnswer(); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+	return addrs, max(ttl, 0), nil
+}
+
+func (r *resolver) report() string {
+	r.mu.Lock()
+	addrs := make([]string, 0, len(r.seen))
+
+	for a := range r.seen {
+		addrs = append(addrs, a)
+	}
+	r.mu.Unlock()
+	sort.Strings(addrs)
+
+	if len(addrs) > dnsReportLimit {
+		addrs = append(addrs[:dnsReportLimit], fmt.Sprintf("... %d more", len(addrs)-dnsReportLimit))
+	}
+	return fmt.Sprintf(`
+		DNS cache: %s
+		DNS lookups: %d
+		DNS cache hits: %d
+		Resolved addresses: %s
+	`,
+		r.mode,
+		atomic.LoadUint64(&r.lookups),
+		atomic.LoadUint64(&r.hits),
+		strings.Join(addrs, ", "),
+	)
+}
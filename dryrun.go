@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"strings"
+	"time"
+)
+
+const dryRunBodyLimit = 2048
+
+// dryRun sends one request per target, prints both sides of the exchange and
+// runs the response checks, without any load or statistics.
+func (b *bench) dryRun(t task) error {
+	targets, tasks, err := b.dryRunTargets(t)
+
+	if err != nil {
+		return err
+	}
+	b.checkSample = 1
+	var failed int
+
+	for i, c := range targets {
+		if c.name != "" {
+			fmt.Printf("=== %s\n", c.name)
+		}
+		if err := c.dryRunOne(tasks[i], os.Stdout); err != nil {
+			fmt.Printf("FAIL: %s\n\n", err)
+			failed++
+		} else {
+			fmt.Print("OK\n\n")
+		}
+	}
+	if b.script != nil {
+		fmt.Println(b.script.report(b))
+	}
+	if failed > 0 {
+		return fmt.Errorf("dry run: %d of %d requests failed", failed, len(targets))
+	}
+	return nil
+}
+
+// dryRunTargets is the bench and task of every target: the run itself, or
+// each of its scenarios.
+func (b *bench) dryRunTargets(t task) ([]*bench, []task, error) {
+	if len(b.scenarios) == 0 {
+		return []*bench{b}, []task{t}, nil
+	}
+	tasks, err := b.prepareScenarios()
+
+	if err != nil {
+		return nil, nil, err
+	}
+	return b.children, tasks, nil
+}
+
+// runPreflight sends the dry run's request per target before the load, every
+// check applied, and aborts the run with the exchanges that failed so that a
+// misconfigured target does not take the whole load.
+func (b *bench) runPreflight(t task) error {
+	targets, tasks, err := b.dryRunTargets(t)
+
+	if err != nil {
+		return withExit(exitConfig, err)
+	}
+	sample := b.checkSample
+	b.checkSample = 1
+
+	// The scenarios are prepared again for the load.
+	defer func() { b.checkSample, b.children = sample, nil }()
+
+	var failed, dialFailed int
+
+	for i, c := range targets {
+		var out bytes.Buffer
+
+		if c.name != "" {
+			fmt.Fprintf(&out, "=== %s\n", c.name)
+		}
+		if err := c.dryRunOne(tasks[i], &out); err != nil {
+			fmt.Fprintf(os.Stderr, "%sFAIL: %s\n\n", out.Bytes(), err)
+			failed++
+
+			if unreachable(err) {
+				dialFailed++
+			}
+		}
+	}
+	if failed == 0 {
+		slog.Info("preflight passed", "requests", len(targets))
+		return nil
+	}
+	err = fmt.Errorf("preflight: %d of %d requests failed, the load was not started", failed, len(targets))
+
+	if dialFailed == failed {
+		return withExit(exitUnreachable, err)
+	}
+	return withExit(exitAborted, err)
+}
+
+func (b *bench) dryRunOne(t task, w io.Writer) error {
+	req, err := http.NewRequestWithContext(b.ctx, t.method, t.url, nil)
+
+	if err != nil {
+		return err
+	}
+	req.Header = t.header.Clone()
+
+	if t.data != nil {
+		req.Body = io.NopCloser(bytes.NewReader(t.data))
+		req.ContentLength = int64(len(t.data))
+		req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(t.data)), nil }
+	}
+	b.runBeforeRequest(req)
+
+	if b.echo != nil {
+		b.echo.capture(req)
+	}
+
+	if dump, err := httputil.DumpRequestOut(req, true); err == nil {
+		fmt.Fprintf(w, "> %s\n", bytes.ReplaceAll(bytes.TrimSpace(dump), []byte("\n"), []byte("\n> ")))
+	}
+	start := time.Now()
+	resp, err := b.clientFor(0).Do(req)
+	delay := time.Since(start)
+
+	if err != nil {
+		b.runAfterResponse(nil, err, delay)
+		return err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if err != nil {
+		return err
+	}
+	if dump, err := httputil.DumpResponse(resp, false); err == nil {
+		fmt.Fprintf(w, "< %s\n", bytes.ReplaceAll(bytes.TrimSpace(dump), []byte("\n"), []byte("\n< ")))
+	}
+	var decoded io.Reader = bytes.NewReader(body)
+
+	if dec, err := newDecoder(resp.Header.Get("Content-Encoding"), decoded); err == nil && dec != nil {
+		decoded = dec
+	}
+	plain, _ := io.ReadAll(decoded)
+
+	if len(plain) > dryRunBodyLimit {
+		fmt.Fprintf(w, "<\n%s\n< ... %d more bytes\n", plain[:dryRunBodyLimit], len(plain)-dryRunBodyLimit)
+	} else if len(plain) > 0 {
+		fmt.Fprintf(w, "<\n%s\n", bytes.TrimRight(plain, "\n"))
+	}
+	fmt.Fprintf(w, "(%s, %d bytes)\n", delay, len(body))
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	b.runAfterResponse(resp, nil, delay)
+
+	if _, err := b.consumeBody(bytes.NewReader(plain), resp.StatusCode); err != nil {
+		return err
+	}
+	if b.echo != nil {
+		if _, err := b.echo.check(resp.Request, bytes.NewReader(plain)); err != nil {
+			return fmt.Errorf("%w\n%s", err, strings.TrimSpace(b.echo.report()))
+		}
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
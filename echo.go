@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+var errEchoMismatch = errors.New("echoed request differs from the request sent")
+
+const echoBinaryPrefix = "data:application/octet-stream;base64,"
+
+// echoedRequest is what an echo endpoint reports about the request it got.
+// The field names follow httpbin's /anything, which the selftest server's
+// /echo also produces.
+type echoedRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Data    string            `json:"data"`
+}
+
+func newEchoedRequest(r *http.Request, body []byte) echoedRequest {
+	e := echoedRequest{
+		Method:  r.Method,
+		URL:     r.URL.RequestURI(),
+		Headers: make(map[string]string, len(r.Header)),
+		Data:    string(body),
+	}
+	for k, v := range r.Header {
+		e.Headers[k] = strings.Join(v, ",")
+	}
+	if r.Host != "" {
+		e.Headers["Host"] = r.Host
+	}
+	if !utf8.Valid(body) {
+		e.Data = echoBinaryPrefix + base64.StdEncoding.EncodeToString(body)
+	}
+	return e
+}
+
+func (e *echoedRequest) body() ([]byte, error) {
+	if s, ok := strings.CutPrefix(e.Data, echoBinaryPrefix); ok {
+		return base64.StdEncoding.DecodeString(s)
+	}
+	return []byte(e.Data), nil
+}
+
+// echoVerifier compares the requests that were sent, after hooks, signing and
+// scripts ran, with what an echo endpoint says it received.
+type echoVerifier struct {
+	checked uint32
+
+	mu         sync.Mutex
+	mismatches map[string]uint32
+	examples   map[string]string
+}
+
+func newEchoVerifier() *echoVerifier {
+	return &echoVerifier{
+		mismatches: make(map[string]uint32),
+		examples:   make(map[string]string),
+	}
+}
+
+// echoBody keeps a copy of the request body as the transport reads it, so that
+// bodies rewritten by hooks and scripts are compared as sent.
+type echoBody struct {
+	io.ReadCloser
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (e *echoBody) Read(p []byte) (int, error) {
+	n, err := e.ReadCloser.Read(p)
+	e.mu.Lock()
+	e.buf.Write(p[:n])
+	e.mu.Unlock()
+	return n, err
+}
+
+func (e *echoBody) bytes() []byte {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return bytes.Clone(e.buf.Bytes())
+}
+
+// capture wraps the body of r; generated uploads are left alone and their
+// bodies are not compared.
+func (v *echoVerifier) capture(r *http.Request) {
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = &echoBody{ReadCloser: r.Body}
+	}
+}
+
+func sentBody(r *http.Request) []byte {
+	switch body := r.Body.(type) {
+	case nil:
+		return []byte{}
+	case *echoBody:
+		return body.bytes()
+	default:
+		if body == http.NoBody {
+			return []byte{}
+		}
+		return nil
+	}
+}
+
+// check reads the echo of req from r.
+func (v *echoVerifier) check(req *http.Request, r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	n := int64(len(data))
+
+	if err != nil {
+		return n, err
+	}
+	atomic.AddUint32(&v.checked, 1)
+	var echo echoedRequest
+
+	if err := json.Unmarshal(data, &echo); err != nil {
+		return n, v.mismatch("response", "not an echo: "+err.Error())
+	}
+	if echo.Method != req.Method {
+		return n, v.mismatch("method", fmt.Sprintf("sent %s, echoed %s", req.Method, echo.Method))
+	}
+	if u, err := url.Parse(echo.URL); err != nil {
+		return n, v.mismatch("url", fmt.Sprintf("echoed invalid URL %q", echo.URL))
+	} else if u.Path != req.URL.Path || !reflect.DeepEqual(u.Query(), req.URL.Query()) {
+		return n, v.mismatch("url", fmt.Sprintf("sent %s, echoed %s", req.URL.RequestURI(), u.RequestURI()))
+	}
+	for k, vs := range req.Header {
+		want := strings.Join(vs, ",")
+		got, ok := echoHeader(echo.Headers, k)
+
+		if !ok || got != want {
+			return n, v.mismatch("header", fmt.Sprintf("%s: sent %q, echoed %q", k, want, got))
+		}
+	}
+	if sent := sentBody(req); sent != nil {
+		got, err := echo.body()
+
+		if err != nil || !bytes.Equal(got, sent) {
+			return n, v.mismatch("body", fmt.Sprintf("sent %d bytes, echoed %d", len(sent), len(got)))
+		}
+	}
+	return n, nil
+}
+
+func echoHeader(headers map[string]string, name string) (string, bool) {
+	if v, ok := headers[name]; ok {
+		return v, true
+	}
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+func (v *echoVerifier) mismatch(kind, example string) error {
+	v.mu.Lock()
+	v.mismatches[kind]++
+
+	if _, ok := v.examples[kind]; !ok {
+		v.examples[kind] = example
+	}
+	v.mu.Unlock()
+	return errEchoMismatch
+}
+
+func (v *echoVerifier) report() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\n\t\tEcho verified requests: %d\n", atomic.LoadUint32(&v.checked))
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for _, kind := range []string{"response", "method", "url", "header", "body"} {
+		if n := v.mismatches[kind]; n > 0 {
+			fmt.Fprintf(&sb, "\t\tEcho %s mismatches: %d, e.g. %s\n", kind, n, v.examples[kind])
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+type countingReader struct {
+	r     io.Reader
+	n     int64
+	first time.Time
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+
+	if n > 0 && c.n == 0 {
+		c.first = time.Now()
+	}
+	c.n += int64(n)
+	return n, err
+}
+
+// timedReader sums the time spent in Read, which for a decoder is mostly the
+// CPU time of decompression.
+type timedReader struct {
+	r     io.Reader
+	spent *int64
+}
+
+func (t timedReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := t.r.Read(p)
+	atomic.AddInt64(t.spent, int64(time.Since(start)))
+	return n, err
+}
+
+func compressBody(data []byte, encoding string) ([]byte, error) {
+	var (
+		buf bytes.Buffer
+		w   io.WriteCloser
+	)
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	case "zstd":
+		w, _ = zstd.NewWriter(&buf)
+	default:
+		return nil, fmt.Errorf("unsupported body encoding %q", encoding)
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func newDecoder(encoding string, r io.Reader) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		return flate.NewReader(r), nil
+	case "br":
+		return brotli.NewReader(r), nil
+	case "zstd":
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+
+		if err != nil {
+			return nil, err
+		}
+		return &zstdReader{d}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// zstdReader releases the decoder once the stream ends.
+type zstdReader struct {
+	*zstd.Decoder
+}
+
+func (z *zstdReader) Read(p []byte) (int, error) {
+	n, err := z.Decoder.Read(p)
+
+	if err != nil {
+		z.Decoder.Close()
+	}
+	return n, err
+}
+
+var receivedEncodings = [...]string{"identity", "gzip", "deflate", "br", "zstd"}
+
+// encodingMix counts the Content-Encoding of the responses, with a last slot
+// for any encoding bench does not know.
+type encodingMix struct {
+	counts [len(receivedEncodings) + 1]uint32
+}
+
+func (m *encodingMix) add(encoding string) {
+	encoding = strings.ToLower(strings.TrimSpace(encoding))
+
+	switch encoding {
+	case "":
+		encoding = "identity"
+	case "x-gzip":
+		encoding = "gzip"
+	}
+	i := len(receivedEncodings)
+
+	for k, name := range receivedEncodings {
+		if name == encoding {
+			i = k
+		}
+	}
+	atomic.AddUint32(&m.counts[i], 1)
+}
+
+func (m *encodingMix) String() string {
+	var total uint32
+
+	for i := range m.counts {
+		total += atomic.LoadUint32(&m.counts[i])
+	}
+	parts := make([]string, 0, len(m.counts))
+
+	for i := range m.counts {
+		c := atomic.LoadUint32(&m.counts[i])
+
+		if c == 0 {
+			continue
+		}
+		name := "other"
+
+		if i < len(receivedEncodings) {
+			name = receivedEncodings[i]
+		}
+		parts = append(parts, fmt.Sprintf("%s %d (%.1f%%)", name, c, 100*float64(c)/float64(total)))
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (b *bench) readBody(sh *statsShard, wire *countingReader, resp *http.Response, start time.Time) error {
+	*wire = countingReader{r: resp.Body}
+
+	if b.bodyLimit != nil {
+		return b.readBodyLimited(sh, wire, resp, start)
+	}
+	var body io.Reader = wire
+
+	if b.encodings != nil {
+		b.encodings.add(resp.Header.Get("Content-Encoding"))
+	}
+	if b.acceptEncoding != "" && b.decompress {
+		if dec, err := newDecoder(resp.Header.Get("Content-Encoding"), wire); err == nil && dec != nil {
+			body = timedReader{r: dec, spent: b.decodeTime}
+		}
+	}
+	var (
+		decoded int64
+		err     error
+	)
+	if b.echo != nil {
+		decoded, err = b.echo.check(resp.Request, body)
+	} else {
+		decoded, err = b.consumeBody(body, resp.StatusCode)
+	}
+	io.Copy(io.Discard, wire)
+	resp.Body.Close()
+
+	atomic.AddUint64(&sh.bytesWire, uint64(wire.n))
+	atomic.AddUint64(&sh.bytesDecoded, uint64(decoded))
+
+	if b.stream != nil {
+		b.stream.add(start, wire.first, time.Now(), wire.n)
+	}
+	return err
+}
+
+func (b *bench) readBodyLimited(sh *statsShard, wire *countingReader, resp *http.Response, start time.Time) error {
+	n, err := io.Copy(io.Discard, io.LimitReader(wire, b.bodyLimit.limit))
+	resp.Body.Close()
+	b.bodyLimit.add(resp, n, err == nil && (n < b.bodyLimit.limit || n == resp.ContentLength))
+
+	atomic.AddUint64(&sh.bytesWire, uint64(wire.n))
+	atomic.AddUint64(&sh.bytesDecoded, uint64(wire.n))
+
+	if b.stream != nil {
+		b.stream.add(start, wire.first, time.Now(), wire.n)
+	}
+	return err
+}
+
+func (b *bench) countBody(sh *statsShard, status int, encoding []byte, body []byte) error {
+	atomic.AddUint64(&sh.bytesWire, uint64(len(body)))
+
+	if b.encodings != nil {
+		b.encodings.add(string(encoding))
+	}
+	if (b.acceptEncoding == "" || !b.decompress) && b.schema == nil && b.verifyHash == nil {
+		atomic.AddUint64(&sh.bytesDecoded, uint64(len(body)))
+		return nil
+	}
+	var r io.Reader = bytes.NewReader(body)
+
+	if b.acceptEncoding != "" && b.decompress {
+		if dec, err := newDecoder(string(encoding), r); err == nil && dec != nil {
+			r = timedReader{r: dec, spent: b.decodeTime}
+		}
+	}
+	decoded, err := b.consumeBody(r, status)
+	atomic.AddUint64(&sh.bytesDecoded, uint64(decoded))
+	return err
+}
+
+func (b *bench) consumeBody(r io.Reader, status int) (int64, error) {
+	if b.checkSample < 1 && rand.Float64() >= b.checkSample {
+		return io.Copy(io.Discard, r)
+	}
+	if b.schema == nil {
+		if b.verifyHash != nil {
+			return b.verifyHash.copy(r, status)
+		}
+		return io.Copy(io.Discard, r)
+	}
+	body, err := io.ReadAll(r)
+	n := int64(len(body))
+
+	if err != nil {
+		return n, err
+	}
+	if b.verifyHash != nil {
+		if _, err := b.verifyHash.copy(bytes.NewReader(body), status); err != nil {
+			return n, err
+		}
+	}
+	return n, b.schema.validate(body)
+}
+
+func (b *bench) decompressionReport() string {
+	seconds := b.stats.Runtime.Seconds()
+	wire := float64(b.stats.BytesWire) / seconds / 1e6
+	decoded, ratio, spent := "n/a (not decompressed)", "n/a", "n/a"
+
+	if b.decompress {
+		decoded = fmt.Sprintf("%.2f MB/s", float64(b.stats.BytesDecoded)/seconds/1e6)
+		spent = time.Duration(atomic.LoadInt64(b.decodeTime)).String()
+
+		if b.stats.BytesWire > 0 {
+			ratio = fmt.Sprintf("%.2fx", float64(b.stats.BytesDecoded)/float64(b.stats.BytesWire))
+		}
+	}
+	return fmt.Sprintf(`
+		Encodings received: %s
+		Decompression: %t
+		Wire throughput: %.2f MB/s
+		Decoded throughput: %s
+		Compression ratio: %s
+		Time spent decompressing: %s
+	`,
+		b.encodings,
+		b.decompress,
+		wire,
+		decoded,
+		ratio,
+		spent,
+	)
+}
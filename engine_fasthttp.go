@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func (b *bench) newFastHTTPClient(timeout time.Duration) *fasthttp.Client {
+	return &fasthttp.Client{
+		MaxConnsPerHost:               int(b.concurrency),
+		ReadTimeout:                   timeout,
+		WriteTimeout:                  timeout,
+		NoDefaultUserAgentHeader:      true,
+		DisableHeaderNamesNormalizing: true,
+		Dial: func(addr string) (net.Conn, error) {
+			return b.dialer.DialContext(context.Background(), "tcp", addr)
+		},
+	}
+}
+
+func (b *bench) launchFastHTTP(numRequest uint, t task) {
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.SetRequestURI(t.url)
+	req.Header.SetMethod(t.method)
+
+	for k, v := range t.header {
+		req.Header.Set(k, v[0])
+	}
+	if t.data != nil {
+		req.SetBodyRaw(t.data)
+	}
+	if b.churn != nil {
+		req.SetConnectionClose()
+	}
+	timeout := b.timeout
+	client := b.fastClient
+	sh := b.stats.shard(t.worker)
+
+	if len(b.fastClients) > 0 {
+		client = b.fastClients[t.worker%uint(len(b.fastClients))]
+	}
+
+	for i := uint(0); i < numRequest && !b.stopped(); i++ {
+		if !b.pace() || !b.acquire() {
+			break
+		}
+		start := time.Now()
+		err := client.DoTimeout(req, resp, timeout)
+		delay := time.Since(start)
+		b.release()
+
+		if b.debug != nil {
+			if id, ok := b.debug.pick(); ok {
+				b.debug.fastHTTP(id, req, resp, err, delay)
+			}
+		}
+
+		if t.data != nil {
+			atomic.AddUint64(&sh.bytesSent, uint64(len(t.data)))
+		}
+		if err == nil {
+			err = b.countBody(sh, resp.StatusCode(), resp.Header.ContentEncoding(), resp.Body())
+		}
+		b.record(sh, resp.StatusCode(), err, delay)
+
+		if b.failFast != nil && (err != nil || !b.succeeded(resp.StatusCode())) && !b.stopped() {
+			b.failFast.trip(t.worker, []byte(req.String()), []byte(resp.String()), resp.StatusCode(), err, delay)
+		}
+		resp.Reset()
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// executionSegment is the share of the load of one instance, as k6's
+// --execution-segment: the fractions from and to of the whole, so that runs
+// orchestrated for k6 can be spread over bench instances. The requests,
+// concurrency and rate are scaled, and the shares of instances covering
+// the whole add up to it exactly.
+type executionSegment struct {
+	from, to *big.Rat
+	sequence []*big.Rat
+}
+
+// parseSegmentFraction accepts 1/4, 0.25 or 25%.
+func parseSegmentFraction(s string) (*big.Rat, error) {
+	s = strings.TrimSpace(s)
+	pct := strings.HasSuffix(s, "%")
+	r, ok := new(big.Rat).SetString(strings.TrimSuffix(s, "%"))
+
+	if !ok {
+		return nil, fmt.Errorf("invalid fraction %q, expected such as 1/4, 0.25 or 25%%", s)
+	}
+	if pct {
+		r.Quo(r, big.NewRat(100, 1))
+	}
+	if r.Sign() < 0 || r.Cmp(big.NewRat(1, 1)) > 0 {
+		return nil, fmt.Errorf("fraction %q is not between 0 and 1", s)
+	}
+	return r, nil
+}
+
+// parseExecutionSegment parses a segment such as 1/4:1/2, or 1/4 for
+// 0:1/4, and an optional sequence of all segments such as 0,1/4,1/2,1.
+func parseExecutionSegment(spec, sequence string) (*executionSegment, error) {
+	s := &executionSegment{}
+	from, to, ok := strings.Cut(spec, ":")
+
+	if !ok {
+		from, to = "0", spec
+	}
+	var err error
+
+	if s.from, err = parseSegmentFraction(from); err != nil {
+		return nil, err
+	}
+	if s.to, err = parseSegmentFraction(to); err != nil {
+		return nil, err
+	}
+	if s.from.Cmp(s.to) >= 0 {
+		return nil, fmt.Errorf("invalid execution segment %q, the start must be before the end", spec)
+	}
+	if sequence == "" {
+		return s, nil
+	}
+	var onFrom, onTo bool
+
+	for i, part := range strings.Split(sequence, ",") {
+		r, err := parseSegmentFraction(part)
+
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 && r.Cmp(s.sequence[i-1]) <= 0 {
+			return nil, errors.New("execution segment sequence must increase")
+		}
+		onFrom = onFrom || r.Cmp(s.from) == 0
+		onTo = onTo || r.Cmp(s.to) == 0
+		s.sequence = append(s.sequence, r)
+	}
+	if s.sequence[0].Sign() != 0 || s.sequence[len(s.sequence)-1].Cmp(big.NewRat(1, 1)) != 0 {
+		return nil, errors.New("execution segment sequence must run from 0 to 1")
+	}
+	if !onFrom || !onTo {
+		return nil, fmt.Errorf("execution segment %q does not start and end on the sequence", spec)
+	}
+	return s, nil
+}
+
+// scale returns the share of n of the segment. Without a sequence it is the
+// difference of the rounded down boundaries; with one, n is apportioned to
+// the segments of the sequence by largest remainder, which spreads the
+// rounding evenly, and the segment gets those it spans.
+func (s *executionSegment) scale(n uint64) uint64 {
+	share := func(r *big.Rat) (*big.Int, *big.Rat) {
+		v := new(big.Rat).Mul(r, new(big.Rat).SetInt(new(big.Int).SetUint64(n)))
+		q, m := new(big.Int).QuoRem(v.Num(), v.Denom(), new(big.Int))
+		return q, new(big.Rat).SetFrac(m, v.Denom())
+	}
+	if s.sequence == nil {
+		hi, _ := share(s.to)
+		lo, _ := share(s.from)
+		return new(big.Int).Sub(hi, lo).Uint64()
+	}
+	k := len(s.sequence) - 1
+	counts := make([]uint64, k)
+	rems := make([]*big.Rat, k)
+	left := n
+
+	for i := range counts {
+		q, rem := share(new(big.Rat).Sub(s.sequence[i+1], s.sequence[i]))
+		counts[i], rems[i] = q.Uint64(), rem
+		left -= counts[i]
+	}
+	for ; left > 0; left-- {
+		best := 0
+
+		for i := range rems {
+			if rems[i].Cmp(rems[best]) > 0 {
+				best = i
+			}
+		}
+		counts[best]++
+		rems[best] = new(big.Rat)
+	}
+	var total uint64
+
+	for i, c := range counts {
+		if s.sequence[i].Cmp(s.from) >= 0 && s.sequence[i+1].Cmp(s.to) <= 0 {
+			total += c
+		}
+	}
+	return total
+}
+
+func (s *executionSegment) scaleRate(rate float64) float64 {
+	f, _ := new(big.Rat).Sub(s.to, s.from).Float64()
+	return rate * f
+}
+
+// scaleLoad gives the instance its share of a -shape or -profile schedule,
+// when scheduled is set, and of -burst. -rate is scaled along with -n and -c.
+func (s *executionSegment) scaleLoad(b *bench, scheduled bool) error {
+	if scheduled {
+		f, rate := s.scaleRate(1), b.schedule.rate
+		b.schedule.rate = func(elapsed time.Duration) float64 { return f * rate(elapsed) }
+	}
+	if b.burst != nil {
+		if b.burst.size = uint(s.scale(uint64(b.burst.size))); b.burst.size == 0 {
+			return fmt.Errorf("execution segment %s gets no share of the burst", s)
+		}
+	}
+	return nil
+}
+
+func (s *executionSegment) String() string {
+	return s.from.RatString() + ":" + s.to.RatString()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+)
+
+// Exit statuses, so that automation can branch on the outcome of a run.
+const (
+	exitFailure     = 1
+	exitConfig      = 2
+	exitUnreachable = 3
+	exitThresholds  = 4
+	exitAborted     = 5
+)
+
+const exitUsage = `
+Exit status:
+  0  the run completed and passed its thresholds
+  1  any other error
+  2  invalid flags, arguments or definition files
+  3  the target was unreachable: no request got a connection
+  4  the run completed but failed a threshold (0 with -exit-zero-on-threshold-fail)
+  5  the run was aborted: interrupted, -fail-fast, a failed -preflight, or stuck past -max-duration
+`
+
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+func withExit(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code: code, err: err}
+}
+
+func exitCode(err error) int {
+	var e *exitError
+
+	if errors.As(err, &e) {
+		return e.code
+	}
+	return exitFailure
+}
+
+// unreachable tells whether err happened before a connection was made.
+func unreachable(err error) bool {
+	var op *net.OpError
+	return errors.As(err, &op) && op.Op == "dial"
+}
+
+// threshold is a named check of the completed run.
+type threshold struct {
+	name  string
+	check func() error
+}
+
+// outcome checks the completed run: a target that could not be reached at
+// all, then the thresholds.
+func (b *bench) outcome() error {
+	if n := b.stats.RequestsTotal; n > 0 && b.stats.RequestsUnreachable == n {
+		err := fmt.Errorf("target unreachable: all %d requests failed to connect", n)
+
+		if b.gha {
+			ghaCommand("error", "bench", err.Error())
+		}
+		return withExit(exitUnreachable, err)
+	}
+	results := make([]error, len(b.thresholds))
+	var errs []error
+
+	for i, t := range b.thresholds {
+		if results[i] = t.check(); results[i] != nil {
+			errs = append(errs, results[i])
+		}
+	}
+	if b.gha {
+		b.githubActions(results)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	err := fmt.Errorf("thresholds failed: %w", errors.Join(errs...))
+
+	if b.exitZeroOnThreshold {
+		slog.Warn(err.Error())
+		return nil
+	}
+	return withExit(exitThresholds, err)
+}
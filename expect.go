@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+type expectContinue struct {
+	interim latencyStats
+	final   uint32
+}
+
+func (e *expectContinue) add(t *requestTrace) {
+	if t.wroteHeaders.IsZero() {
+		return
+	}
+	if t.got100.IsZero() {
+		atomic.AddUint32(&e.final, 1)
+		return
+	}
+	e.interim.add(t.got100.Sub(t.wroteHeaders))
+}
+
+func (e *expectContinue) report() string {
+	return fmt.Sprintf(`
+		Time to 100 Continue: %s
+		Final response without 100 Continue: %d
+	`,
+		&e.interim,
+		atomic.LoadUint32(&e.final),
+	)
+}
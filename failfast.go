@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"bench/plugins"
+)
+
+// failFast aborts the run at the first failed request and prints the whole
+// exchange, to validate a benchmark definition before the long run.
+type failFast struct {
+	once    sync.Once
+	tripped atomic.Bool
+	start   time.Time
+	cancel  context.CancelFunc
+	err     error
+}
+
+// failDumpLimit caps the body kept of the failed response.
+const failDumpLimit = 64 << 10
+
+func (f *failFast) begin(start time.Time, cancel context.CancelFunc) {
+	f.start, f.cancel = start, cancel
+}
+
+// trip keeps the first failure only: the requests cut off by cancelling the
+// run fail as well.
+func (f *failFast) trip(worker uint, request, response []byte, status int, err error, delay time.Duration) {
+	f.once.Do(func() {
+		f.tripped.Store(true)
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "--- fail-fast: first failure on worker %d, %s into the run\n", worker, time.Since(f.start).Round(time.Millisecond))
+		writePrefixed(&sb, "> ", request)
+
+		if response != nil {
+			writePrefixed(&sb, "< ", response)
+		}
+		if err != nil {
+			fmt.Fprintf(&sb, "! %s (%s)\n", err, delay)
+			f.err = fmt.Errorf("fail-fast: %w", err)
+		} else {
+			fmt.Fprintf(&sb, "(%s)\n", delay)
+			f.err = fmt.Errorf("fail-fast: unexpected status %s", failureName(status, nil))
+		}
+		os.Stderr.WriteString(sb.String())
+		f.cancel()
+	})
+}
+
+// armed holds until the first failure tripped, so that only the response
+// printed is dumped.
+func (f *failFast) armed() bool {
+	return !f.tripped.Load()
+}
+
+// failedResponse dumps the head and up to failDumpLimit of the body of resp,
+// and leaves the body whole for reading.
+func failedResponse(resp *http.Response) []byte {
+	head, _ := io.ReadAll(io.LimitReader(resp.Body, failDumpLimit))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+
+	dump, _ := httputil.DumpResponse(resp, false)
+	return append(dump, head...)
+}
+
+// failedRequest dumps r after it was sent, when its body is gone.
+func failedRequest(r *http.Request, data []byte) []byte {
+	dump, err := httputil.DumpRequestOut(r, false)
+
+	if err != nil {
+		return []byte(err.Error())
+	}
+	return append(dump, data...)
+}
+
+func failedProtocolRequest(req *plugins.Request) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s\n", req.Method, req.URL)
+	req.Header.Write(&buf)
+	buf.WriteString("\n")
+	buf.Write(req.Body)
+	return buf.Bytes()
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// failureBuckets are the upper bounds of the latency ranges failures are
+// counted in; the last range is open.
+var failureBuckets = []time.Duration{
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2 * time.Second,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// failureLatency correlates non-200 outcomes with latency, which tells
+// timeouts at a proxy apart from fast application errors.
+type failureLatency struct {
+	mu       sync.Mutex
+	outcomes map[string]*failureOutcome
+}
+
+type failureOutcome struct {
+	name     string
+	count    uint64
+	min, max time.Duration
+	buckets  []uint64
+}
+
+func newFailureLatency() *failureLatency {
+	return &failureLatency{outcomes: make(map[string]*failureOutcome)}
+}
+
+func failureName(status int, err error) string {
+	if err == nil {
+		if serverTimeout(status) {
+			return strconv.Itoa(status) + " server timeout"
+		}
+		return strconv.Itoa(status)
+	}
+	switch {
+	case clientTimeout(err):
+		return "client timeout"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection refused"
+	case errors.Is(err, syscall.ECONNRESET):
+		return "connection reset"
+	case errors.Is(err, syscall.EMFILE), errors.Is(err, syscall.ENFILE):
+		return "out of file descriptors"
+	case errors.Is(err, errHashMismatch):
+		return "hash mismatch"
+	case errors.Is(err, errSchemaViolation):
+		return "schema violation"
+	case errors.Is(err, errEchoMismatch):
+		return "echo mismatch"
+	}
+	return "other error"
+}
+
+func (f *failureLatency) add(status int, err error, delay time.Duration) {
+	name := failureName(status, err)
+	k := sort.Search(len(failureBuckets), func(i int) bool { return delay < failureBuckets[i] })
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	o, ok := f.outcomes[name]
+
+	if !ok {
+		o = &failureOutcome{name: name, min: delay, buckets: make([]uint64, len(failureBuckets)+1)}
+		f.outcomes[name] = o
+	}
+	o.count++
+	o.min, o.max = min(o.min, delay), max(o.max, delay)
+	o.buckets[k]++
+}
+
+func (f *failureLatency) merge(o *failureLatency) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for name, src := range o.outcomes {
+		dst, ok := f.outcomes[name]
+
+		if !ok {
+			dst = &failureOutcome{name: name, min: src.min, buckets: make([]uint64, len(failureBuckets)+1)}
+			f.outcomes[name] = dst
+		}
+		dst.count += src.count
+		dst.min, dst.max = min(dst.min, src.min), max(dst.max, src.max)
+
+		for k, c := range src.buckets {
+			dst.buckets[k] += c
+		}
+	}
+}
+
+func failureRange(k int) string {
+	switch k {
+	case 0:
+		return "<" + failureBuckets[0].String()
+	case len(failureBuckets):
+		return ">=" + failureBuckets[k-1].String()
+	}
+	return failureBuckets[k-1].String() + "-" + failureBuckets[k].String()
+}
+
+func (f *failureLatency) report() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.outcomes) == 0 {
+		return ""
+	}
+	outcomes := make([]*failureOutcome, 0, len(f.outcomes))
+
+	for _, o := range f.outcomes {
+		outcomes = append(outcomes, o)
+	}
+	sort.Slice(outcomes, func(i, j int) bool { return outcomes[i].count > outcomes[j].count })
+
+	var sb strings.Builder
+	sb.WriteString("\n\t\tFailures by latency:\n")
+
+	for _, o := range outcomes {
+		var ranges []string
+		lo, hi := -1, 0
+
+		for k, c := range o.buckets {
+			if c == 0 {
+				continue
+			}
+			if lo < 0 {
+				lo = k
+			}
+			hi = k
+			ranges = append(ranges, fmt.Sprintf("%s %.0f%%", failureRange(k), 100*float64(c)/float64(o.count)))
+		}
+		fmt.Fprintf(&sb, "\t\t%s: %d, min %s, max %s: %s",
+			o.name, o.count, formatLatency(o.min), formatLatency(o.max), strings.Join(ranges, ", "))
+
+		switch {
+		case lo == hi:
+			fmt.Fprintf(&sb, " (all %s)", failureRange(lo))
+		case lo > 0:
+			fmt.Fprintf(&sb, " (all above %s)", failureBuckets[lo-1])
+		case hi < len(failureBuckets):
+			fmt.Fprintf(&sb, " (all below %s)", failureBuckets[hi])
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// longFlags are GNU-style spellings of the single-letter flags, and aliases
+// of a few others. Both names share one value, so the last occurrence of
+// either wins; --duration also lifts the -n limit unless -n is given.
+var longFlags = map[string]string{
+	"requests":    "n",
+	"concurrency": "c",
+	"timeout":     "t",
+	"url":         "h",
+	"method":      "m",
+	"params":      "p",
+	"data":        "d",
+	"output":      "o",
+	"duration":    "max-duration",
+	"body-size":   "upload-size",
+}
+
+// unlimitedRequests stands in for "no request limit" when a run is bounded
+// by its duration.
+const unlimitedRequests = 1<<32 - 1
+
+func addLongFlags(fs *flag.FlagSet) {
+	for long, short := range longFlags {
+		f := fs.Lookup(short)
+		fs.Var(f.Value, long, "Same as -"+short)
+	}
+}
+
+// headerValue collects repeated -H "Name: value" flags.
+type headerValue http.Header
+
+func (h headerValue) String() string {
+	var sb strings.Builder
+	http.Header(h).Write(&sb)
+	return strings.ReplaceAll(strings.TrimSpace(sb.String()), "\r\n", "; ")
+}
+
+func (h headerValue) Set(s string) error {
+	k, v, ok := strings.Cut(s, ":")
+
+	if !ok || strings.TrimSpace(k) == "" {
+		return fmt.Errorf("invalid header %q, expected Name: value", s)
+	}
+	http.Header(h).Add(strings.TrimSpace(k), strings.TrimSpace(v))
+	return nil
+}
+
+// queryValue accumulates repeated -p flags into one set of parameters.
+type queryValue url.Values
+
+func (q queryValue) String() string {
+	return url.Values(q).Encode()
+}
+
+func (q queryValue) Set(s string) error {
+	v, err := url.ParseQuery(s)
+
+	if err != nil {
+		return err
+	}
+	for k, vs := range v {
+		q[k] = append(q[k], vs...)
+	}
+	return nil
+}
+
+// tagValue collects key=value pairs from repeated flags, each of which may
+// hold several separated by commas.
+type tagValue map[string]string
+
+func (t tagValue) String() string {
+	pairs := make([]string, 0, len(t))
+
+	for k, v := range t {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (t tagValue) Set(s string) error {
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+
+		if !ok || k == "" {
+			return fmt.Errorf("invalid tag %q, expected key=value", pair)
+		}
+		t[k] = v
+	}
+	return nil
+}
+
+// cutFlag removes every occurrence of the named flags, with their values,
+// from a command line.
+func cutFlag(args []string, fs *flag.FlagSet, names ...string) (rest []string, found bool) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			return append(rest, args[i:]...), found
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+
+		if !slices.Contains(names, name) {
+			rest = append(rest, arg)
+
+			if f := fs.Lookup(name); f != nil && !hasValue && !isBoolFlag(f) {
+				if i+1 < len(args) {
+					rest = append(rest, args[i+1])
+				}
+				i++
+			}
+			continue
+		}
+		found = true
+
+		if f := fs.Lookup(name); f != nil && !hasValue && !isBoolFlag(f) {
+			i++
+		}
+	}
+	return rest, found
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+var byteUnits = map[string]int64{
+	"": 1, "B": 1,
+	"K": 1 << 10, "KB": 1 << 10, "KIB": 1 << 10,
+	"M": 1 << 20, "MB": 1 << 20, "MIB": 1 << 20,
+	"G": 1 << 30, "GB": 1 << 30, "GIB": 1 << 30,
+}
+
+// parseByteSize parses sizes such as 512, 10KB or 1.5MiB, in binary units.
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+
+	if i < 0 {
+		i = len(s)
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	unit, ok := byteUnits[strings.ToUpper(strings.TrimSpace(s[i:]))]
+
+	if err != nil || !ok || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected a byte count such as 512, 10KB or 1MB", s)
+	}
+	if v := n * float64(unit); v != float64(int64(v)) {
+		return 0, fmt.Errorf("invalid size %q, not a whole number of bytes", s)
+	} else {
+		return int64(v), nil
+	}
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30 && n%(1<<30) == 0:
+		return fmt.Sprintf("%dGB", n>>30)
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%dMB", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%dKB", n>>10)
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+// byteSize is a size flag that takes units, such as 4KiB.
+type byteSize int64
+
+func (b *byteSize) String() string {
+	return formatBytes(int64(*b))
+}
+
+func (b *byteSize) Set(s string) error {
+	n, err := parseByteSize(s)
+
+	if err != nil {
+		return err
+	}
+	*b = byteSize(n)
+	return nil
+}
+
+// msDuration is a duration flag such as 250ms or 2s that still takes a
+// bare number as milliseconds, as -t always has.
+type msDuration time.Duration
+
+func (d *msDuration) String() string {
+	return time.Duration(*d).String()
+}
+
+func (d *msDuration) Set(s string) error {
+	if n, err := strconv.ParseUint(s, 10, 32); err == nil {
+		*d = msDuration(time.Duration(n) * time.Millisecond)
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+
+	if err != nil || v < 0 {
+		return fmt.Errorf("invalid duration %q, expected such as 250ms or 2s, or a number of milliseconds", s)
+	}
+	*d = msDuration(v)
+	return nil
+}
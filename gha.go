@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	ghaData     = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	ghaProperty = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+// ghaCommand prints a GitHub Actions workflow command, which the runner turns
+// into an annotation on the job and the pull request.
+func ghaCommand(kind, title, message string) {
+	fmt.Printf("::%s title=%s::%s\n", kind, ghaProperty.Replace(title), ghaData.Replace(message))
+}
+
+// githubActions annotates the threshold results, where results[i] is the
+// outcome of b.thresholds[i], and appends a Markdown summary of the run to
+// the file the runner names in GITHUB_STEP_SUMMARY.
+func (b *bench) githubActions(results []error) {
+	failed := 0
+
+	for _, err := range results {
+		if err != nil {
+			ghaCommand("error", "bench threshold", err.Error())
+			failed++
+		}
+	}
+	line := b.summaryLine(float64(b.stats.RequestsTotal) / b.stats.Runtime.Seconds())
+
+	if failed == 0 && len(results) > 0 {
+		line = fmt.Sprintf("all %d thresholds passed: %s", len(results), line)
+	}
+	ghaCommand("notice", "bench", line)
+
+	path := os.Getenv("GITHUB_STEP_SUMMARY")
+
+	if path == "" {
+		slog.Warn("GITHUB_STEP_SUMMARY is not set, skipping the step summary")
+		return
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+
+	if err != nil {
+		slog.Error("writing step summary failed", "err", err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(b.stepSummary(results)); err != nil {
+		slog.Error("writing step summary failed", "err", err)
+	}
+}
+
+func (b *bench) stepSummary(results []error) string {
+	s := &b.stats
+	cur := b.result()
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "### bench run `%s`\n\n", b.meta.RunID)
+	fmt.Fprintf(&sb, "Target `%s`, concurrency %d, %s\n\n", b.targetURL(), b.concurrency, s.Runtime.Round(time.Millisecond))
+	sb.WriteString("| Metric | Value |\n| --- | --- |\n")
+	fmt.Fprintf(&sb, "| Requests | %d |\n", s.RequestsTotal)
+	fmt.Fprintf(&sb, "| Requests per second | %.1f |\n", cur.RPS)
+	fmt.Fprintf(&sb, "| Errors | %.2f%% |\n", cur.errorRate())
+	fmt.Fprintf(&sb, "| P50 delay | %s |\n", formatLatency(cur.Latency.P50Ns))
+	fmt.Fprintf(&sb, "| P90 delay | %s |\n", formatLatency(cur.Latency.P90Ns))
+	fmt.Fprintf(&sb, "| P99 delay | %s |\n", formatLatency(cur.Latency.P99Ns))
+	fmt.Fprintf(&sb, "| P99.9 delay | %s |\n", formatLatency(cur.Latency.P999Ns))
+	fmt.Fprintf(&sb, "| Max delay | %s |\n", formatLatency(cur.Latency.MaxNs))
+
+	if len(results) > 0 {
+		sb.WriteString("\n| Threshold | Result |\n| --- | --- |\n")
+	}
+	for i, err := range results {
+		verdict := ":white_check_mark: passed"
+
+		if err != nil {
+			verdict = ":x: " + strings.ReplaceAll(err.Error(), "|", `\|`)
+		}
+		fmt.Fprintf(&sb, "| %s | %s |\n", b.thresholds[i].name, verdict)
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// h2Pool speaks HTTP/2 over a fixed number of connections per host that it
+// dials itself, so that multiplexing is under the caller's control: h2 over
+// TLS, or h2c with prior knowledge for http:// targets.
+// The initial window sizes are not configurable: x/net/http2 advertises its
+// own, 4MB per stream and 1GB per connection, with no Transport setting.
+type h2Pool struct {
+	t          *http2.Transport
+	dialer     *dialer
+	conns      int
+	maxStreams int
+
+	mu     sync.Mutex
+	hosts  map[string][]*h2Conn
+	order  []*h2Conn
+	events *h2Events
+}
+
+// h2Events counts HTTP/2 level events with the first and last time each was
+// seen, to tell apart a storm of resets or a GOAWAY from steady failures.
+type h2Events struct {
+	start time.Time
+
+	mu     sync.Mutex
+	events map[string]*h2Event
+}
+
+type h2Event struct {
+	count       uint64
+	first, last time.Duration
+}
+
+type h2Conn struct {
+	pool *h2Pool
+	addr string
+	tls  bool
+	sem  chan struct{}
+
+	active   int64
+	peak     int64
+	sum      int64
+	requests int64
+
+	mu        sync.Mutex
+	cc        *http2.ClientConn
+	dials     uint32
+	serverMax uint32
+}
+
+func newH2Pool(d *dialer, conns, maxStreams, maxFrame uint) (*h2Pool, error) {
+	if maxFrame != 0 && (maxFrame < 16<<10 || maxFrame > 1<<24-1) {
+		return nil, fmt.Errorf("h2-max-frame-size %d must be between 16384 and 16777215", maxFrame)
+	}
+	events := &h2Events{start: time.Now(), events: make(map[string]*h2Event)}
+
+	return &h2Pool{
+		t:          &http2.Transport{MaxReadFrameSize: uint32(maxFrame), DisableCompression: true, CountError: events.add},
+		dialer:     d,
+		conns:      int(max(conns, 1)),
+		maxStreams: int(maxStreams),
+		hosts:      make(map[string][]*h2Conn),
+		events:     events,
+	}, nil
+}
+
+func (e *h2Events) add(name string) {
+	at := time.Since(e.start)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ev, ok := e.events[name]
+
+	if !ok {
+		ev = &h2Event{first: at}
+		e.events[name] = ev
+	}
+	ev.count++
+	ev.last = at
+}
+
+func (e *h2Events) report() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	names := make([]string, 0, len(e.events))
+
+	for name := range e.events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	sb.WriteString("\n\t\tHTTP/2 events:\n")
+
+	if len(names) == 0 {
+		sb.WriteString("\t\tnone\n")
+	}
+	for _, name := range names {
+		ev := e.events[name]
+		fmt.Fprintf(&sb, "\t\t%s: %d (first at %s, last at %s)\n",
+			name, ev.count, ev.first.Round(time.Millisecond), ev.last.Round(time.Millisecond))
+	}
+	return sb.String()
+}
+
+func (p *h2Pool) RoundTrip(req *http.Request) (*http.Response, error) {
+	addr := hostPort(req.URL)
+	p.mu.Lock()
+	conns, ok := p.hosts[addr]
+
+	if !ok {
+		for i := 0; i < p.conns; i++ {
+			c := &h2Conn{pool: p, addr: addr, tls: req.URL.Scheme == "https"}
+
+			if p.maxStreams > 0 {
+				c.sem = make(chan struct{}, p.maxStreams)
+			}
+			conns = append(conns, c)
+		}
+		p.hosts[addr] = conns
+		p.order = append(p.order, conns...)
+	}
+	p.mu.Unlock()
+
+	least := conns[0]
+
+	for _, c := range conns[1:] {
+		if atomic.LoadInt64(&c.active) < atomic.LoadInt64(&least.active) {
+			least = c
+		}
+	}
+	return least.roundTrip(req)
+}
+
+func (c *h2Conn) roundTrip(req *http.Request) (*http.Response, error) {
+	if c.sem != nil {
+		select {
+		case c.sem <- struct{}{}:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+	active := atomic.AddInt64(&c.active, 1)
+
+	if active > atomic.LoadInt64(&c.peak) {
+		atomic.StoreInt64(&c.peak, active)
+	}
+	atomic.AddInt64(&c.sum, active)
+	atomic.AddInt64(&c.requests, 1)
+
+	cc, err := c.get(req.Context())
+
+	if err != nil {
+		c.done()
+		return nil, err
+	}
+	resp, err := cc.RoundTrip(req)
+
+	if err != nil {
+		var goAway http2.GoAwayError
+
+		if errors.As(err, &goAway) {
+			c.pool.events.add("request_failed_goaway")
+		}
+		c.done()
+		return nil, err
+	}
+	resp.Body = &h2Body{ReadCloser: resp.Body, conn: c}
+	return resp, nil
+}
+
+func (c *h2Conn) done() {
+	atomic.AddInt64(&c.active, -1)
+
+	if c.sem != nil {
+		<-c.sem
+	}
+}
+
+// get returns the connection, replacing it once it is closed or going away.
+func (c *h2Conn) get(ctx context.Context) (*http2.ClientConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cc != nil {
+		st := c.cc.State()
+		c.serverMax = st.MaxConcurrentStreams
+
+		if !st.Closed && !st.Closing {
+			return c.cc, nil
+		}
+		if st.Closed {
+			c.pool.events.add("conn_closed")
+		} else {
+			// Received a GOAWAY, or the stream errors made it unusable.
+			c.pool.events.add("conn_going_away")
+		}
+	}
+	conn, err := c.pool.dialer.DialContext(ctx, "tcp", c.addr)
+
+	if err != nil {
+		return nil, err
+	}
+	if c.tls {
+		host, _, _ := net.SplitHostPort(c.addr)
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host, NextProtos: []string{http2.NextProtoTLS}})
+
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if tlsConn.ConnectionState().NegotiatedProtocol != http2.NextProtoTLS {
+			conn.Close()
+			return nil, errors.New("server did not negotiate HTTP/2")
+		}
+		conn = tlsConn
+	}
+	cc, err := c.pool.t.NewClientConn(conn)
+
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.cc = cc
+	c.dials++
+	return cc, nil
+}
+
+type h2Body struct {
+	io.ReadCloser
+
+	conn *h2Conn
+	once sync.Once
+}
+
+func (b *h2Body) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.conn.done)
+	return err
+}
+
+func (p *h2Pool) report() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\n\t\tHTTP/2 connections: %d per host, %d in total\n", p.conns, len(p.order))
+
+	for i, c := range p.order {
+		c.mu.Lock()
+		limit, dials := c.serverMax, c.dials
+
+		if c.cc != nil {
+			limit = c.cc.State().MaxConcurrentStreams
+		}
+		c.mu.Unlock()
+
+		if p.maxStreams > 0 && (limit == 0 || uint32(p.maxStreams) < limit) {
+			limit = uint32(p.maxStreams)
+		}
+		n := atomic.LoadInt64(&c.requests)
+		var avg float64
+
+		if n > 0 {
+			avg = float64(atomic.LoadInt64(&c.sum)) / float64(n)
+		}
+		utilization := "n/a"
+
+		if limit > 0 {
+			utilization = fmt.Sprintf("%.1f%%", 100*avg/float64(limit))
+		}
+		fmt.Fprintf(&sb, "\t\t%s #%d: requests=%d dials=%d streams avg=%.1f peak=%d limit=%d utilization=%s\n",
+			c.addr, i%p.conns+1, n, dials, avg, atomic.LoadInt64(&c.peak), limit, utilization)
+	}
+	sb.WriteString(p.events.report())
+	return sb.String()
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// heartbeat is the line a worker prints to stdout every -heartbeat interval,
+// for the controller following its log to tell that it is alive and, from
+// Elapsed, when its load started in the controller's clock.
+type heartbeat struct {
+	Time     time.Time     `json:"heartbeat"`
+	Elapsed  time.Duration `json:"elapsed_ns"`
+	Requests uint32        `json:"requests"`
+}
+
+func (b *bench) beat(stop <-chan struct{}) {
+	ticker := time.NewTicker(b.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		hb := heartbeat{Time: time.Now(), Elapsed: time.Since(b.stats.LaunchTime)}
+
+		for _, sh := range b.stats.shards {
+			hb.Requests += atomic.LoadUint32(&sh.total)
+		}
+		data, _ := json.Marshal(hb)
+		os.Stdout.Write(append(data, '\n'))
+	}
+}
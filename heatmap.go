@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	heatmapCell   = 6
+	heatmapMargin = 70
+)
+
+func (b *bench) writeHeatmap(path string) error {
+	slots := b.timeline.snapshot()
+	lo, hi := timelineBuckets, -1
+	var peak uint32
+
+	for i := range slots {
+		for k, c := range slots[i] {
+			if c == 0 {
+				continue
+			}
+			lo, hi = min(lo, k), max(hi, k)
+			peak = max(peak, c)
+		}
+	}
+	if hi < 0 {
+		return fmt.Errorf("heatmap: no samples")
+	}
+	meta, err := json.Marshal(b.meta)
+
+	if err != nil {
+		return err
+	}
+	svg := renderHeatmap(slots, lo, hi, peak, b.meta.RunID, meta)
+
+	if strings.EqualFold(filepath.Ext(path), ".html") {
+		svg = "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>bench latency heatmap</title></head><body>\n" +
+			svg + "</body></html>\n"
+	}
+	return os.WriteFile(path, []byte(svg), 0644)
+}
+
+func renderHeatmap(slots [][timelineBuckets]uint32, lo, hi int, peak uint32, runID string, meta []byte) string {
+	rows := hi - lo + 1
+	width := heatmapMargin + len(slots)*heatmapCell + 10
+	height := rows*heatmapCell + 40
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="monospace" font-size="10">`+"\n", width, height)
+	// json.Marshal escapes '>' so the payload cannot terminate the CDATA section.
+	fmt.Fprintf(&sb, "<metadata><![CDATA[%s]]></metadata>\n", meta)
+	fmt.Fprintf(&sb, `<rect width="%d" height="%d" fill="#fff"/>`+"\n", width, height)
+
+	for i := range slots {
+		for k := lo; k <= hi; k++ {
+			c := slots[i][k]
+
+			if c == 0 {
+				continue
+			}
+			// Log scale so rare slow requests stay visible next to the main mode.
+			v := math.Log1p(float64(c)) / math.Log1p(float64(peak))
+			x := heatmapMargin + i*heatmapCell
+			y := (hi - k) * heatmapCell
+			fmt.Fprintf(&sb, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"><title>%ds %s: %d</title></rect>`+"\n",
+				x, y, heatmapCell, heatmapCell, heatColor(v), i, timelineValue(k).Round(time.Microsecond), c)
+		}
+	}
+	for k := hi; k >= lo; k -= max(rows/8, 1) {
+		fmt.Fprintf(&sb, `<text x="2" y="%d">%s</text>`+"\n", (hi-k)*heatmapCell+heatmapCell, formatLatency(timelineValue(k)))
+	}
+	step := max(len(slots)/10, 1)
+
+	for i := 0; i < len(slots); i += step {
+		fmt.Fprintf(&sb, `<text x="%d" y="%d">%s</text>`+"\n",
+			heatmapMargin+i*heatmapCell, rows*heatmapCell+15, time.Duration(i)*timelineSlot)
+	}
+	fmt.Fprintf(&sb, `<text x="%d" y="%d">time since start; latency on the vertical axis; run %s</text>`+"\n", heatmapMargin, rows*heatmapCell+32, runID)
+	sb.WriteString("</svg>\n")
+	return sb.String()
+}
+
+func heatColor(v float64) string {
+	r := int(255 * math.Min(1, 2*v))
+	g := int(255 * math.Max(0, 1-2*math.Abs(v-0.5)))
+	bl := int(255 * math.Max(0, 1-2*v))
+	return fmt.Sprintf("#%02x%02x%02x", r, g, bl)
+}
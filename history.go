@@ -0,0 +1,260 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// historySchema is the layout of the history database, kept stable so that
+// it can be queried with plain SQL. Times are RFC 3339 in UTC and latencies
+// in nanoseconds; result holds the complete result document.
+const historySchema = `CREATE TABLE IF NOT EXISTS runs (
+	run_id           TEXT PRIMARY KEY,
+	timestamp        TEXT NOT NULL,
+	version          TEXT NOT NULL,
+	hostname         TEXT NOT NULL,
+	command          TEXT NOT NULL,
+	concurrency      INTEGER NOT NULL,
+	runtime_ns       INTEGER NOT NULL,
+	rps              REAL NOT NULL,
+	requests_total   INTEGER NOT NULL,
+	requests_success INTEGER NOT NULL,
+	requests_fail    INTEGER NOT NULL,
+	requests_timeout INTEGER NOT NULL,
+	avg_ns           INTEGER NOT NULL,
+	p50_ns           INTEGER NOT NULL,
+	p90_ns           INTEGER NOT NULL,
+	p99_ns           INTEGER NOT NULL,
+	p999_ns          INTEGER NOT NULL,
+	max_ns           INTEGER NOT NULL,
+	ttfb_p50_ns      INTEGER NOT NULL,
+	ttfb_p99_ns      INTEGER NOT NULL,
+	result           TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS runs_timestamp ON runs (timestamp);
+CREATE TABLE IF NOT EXISTS tags (
+	run_id TEXT NOT NULL REFERENCES runs (run_id) ON DELETE CASCADE,
+	key    TEXT NOT NULL,
+	value  TEXT NOT NULL,
+	PRIMARY KEY (run_id, key)
+);
+CREATE INDEX IF NOT EXISTS tags_key_value ON tags (key, value);
+`
+
+const historyTime = "2006-01-02T15:04:05.000000000Z"
+
+// openHistory opens the database at path with foreign keys enforced on every
+// connection, so that deleting a run deletes its tags.
+func openHistory(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)")
+
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(historySchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("history %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// addHistory stores r in the history database at path.
+func addHistory(path string, r result) error {
+	doc, err := json.Marshal(r)
+
+	if err != nil {
+		return err
+	}
+	db, err := openHistory(path)
+
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	m := r.Metadata
+	_, err = tx.Exec(`INSERT INTO runs VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		m.RunID, m.Timestamp.UTC().Format(historyTime), m.Version, m.Hostname, m.Command,
+		r.Concurrency, r.RuntimeNs, r.RPS,
+		r.Requests.Total, r.Requests.Success, r.Requests.Fail, r.Requests.Timeout,
+		r.Latency.AvgNs, r.Latency.P50Ns, r.Latency.P90Ns, r.Latency.P99Ns, r.Latency.P999Ns, r.Latency.MaxNs,
+		r.TTFB.P50Ns, r.TTFB.P99Ns, string(doc))
+
+	if err != nil {
+		return err
+	}
+	for k, v := range m.Tags {
+		if _, err := tx.Exec(`INSERT INTO tags VALUES (?, ?, ?)`, m.RunID, k, v); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// readHistory loads the stored results matching every tag in filter and
+// taken after since, oldest first.
+func readHistory(path string, filter map[string]string, since time.Time) ([]*result, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := openHistory(path)
+
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query := `SELECT result FROM runs WHERE timestamp >= ?`
+	args := []any{since.UTC().Format(historyTime)}
+
+	for k, v := range filter {
+		query += ` AND run_id IN (SELECT run_id FROM tags WHERE key = ? AND value = ?)`
+		args = append(args, k, v)
+	}
+	rows, err := db.Query(query+` ORDER BY timestamp`, args...)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*result
+
+	for rows.Next() {
+		var doc string
+
+		if err := rows.Scan(&doc); err != nil {
+			return nil, err
+		}
+		r, err := parseResult([]byte(doc))
+
+		if err != nil {
+			return nil, fmt.Errorf("history %s: %w", path, err)
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// parseSince accepts a duration back from now such as 12h or 30d, or a date.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.ParseFloat(days, 64); err == nil && n >= 0 {
+			return now.Add(-time.Duration(n * float64(24*time.Hour))), nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("invalid since %q, expected a duration such as 30d or 12h, or a date", s)
+	}
+	return now.Add(-d), nil
+}
+
+func historyCommand(args []string) error {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	fs.Usage = func() { usage(fs, "history [flags]") }
+	db := fs.String("db", "", "History database, as given to bench -history")
+	schema := fs.Bool("schema", false, "Print the SQL schema of the history database and exit")
+	filter := make(tagValue)
+	fs.Var(filter, "filter", "Only runs with these key=value tags, e.g. service=checkout,env=staging; may be repeated")
+	since := fs.String("since", "", "Only runs within this duration back from now, e.g. 30d or 12h, or since a date such as 2024-01-31")
+	metric := fs.String("metric", "p99", "Metric to trend: "+strings.Join(resultMetricNames(), ", "))
+	fs.Parse(args)
+
+	if *schema {
+		fmt.Print(historySchema)
+		return nil
+	}
+	if *db == "" {
+		fs.Usage()
+		return errors.New("history needs -db")
+	}
+	get, ok := resultMetrics[*metric]
+
+	if !ok {
+		return fmt.Errorf("unknown metric %q, expected one of %s", *metric, strings.Join(resultMetricNames(), ", "))
+	}
+	from, err := parseSince(*since, time.Now())
+
+	if err != nil {
+		return err
+	}
+	results, err := readHistory(*db, filter, from)
+
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		return errors.New("no runs match")
+	}
+	values := make([]float64, len(results))
+
+	for i, r := range results {
+		values[i] = get(r)
+	}
+	fmt.Print(historyTable(*metric, results, values))
+	fmt.Printf("\n%s %s  min %s, max %s\n", *metric, sparkline(values),
+		formatMetric(*metric, slices.Min(values)), formatMetric(*metric, slices.Max(values)))
+	return nil
+}
+
+func historyTable(metric string, results []*result, values []float64) string {
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Time\tRun\t%s\tChange\tTags\n", metric)
+
+	for i, r := range results {
+		change := "-"
+
+		if i > 0 && values[i-1] != 0 {
+			change = fmt.Sprintf("%+.1f%%", 100*(values[i]-values[i-1])/values[i-1])
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Metadata.Timestamp.Local().Format("2006-01-02 15:04"),
+			r.Metadata.RunID, formatMetric(metric, values[i]), change, tagValue(r.Metadata.Tags))
+	}
+	w.Flush()
+	return sb.String()
+}
+
+func sparkline(values []float64) string {
+	lo, hi := slices.Min(values), slices.Max(values)
+	out := make([]rune, len(values))
+
+	for i, v := range values {
+		k := 0
+
+		if hi > lo {
+			k = int(math.Round((v - lo) / (hi - lo) * float64(len(sparks)-1)))
+		}
+		out[i] = sparks[k]
+	}
+	return string(out)
+}
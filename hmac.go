@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type hmacSigner struct {
+	secret          []byte
+	hash            func() hash.Hash
+	header          string
+	timestampHeader string
+	fields          []string
+	encode          func([]byte) string
+}
+
+func newHMACSigner(spec, secret string) (*hmacSigner, error) {
+	if secret == "" {
+		return nil, errors.New("a secret is required, set -hmac-secret")
+	}
+	s := &hmacSigner{
+		secret:          []byte(secret),
+		hash:            sha256.New,
+		header:          "X-Signature",
+		timestampHeader: "X-Timestamp",
+		fields:          []string{"method", "path", "body"},
+		encode:          hex.EncodeToString,
+	}
+	for _, opt := range strings.Split(spec, ",") {
+		if opt == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(opt, "=")
+
+		if !ok {
+			return nil, fmt.Errorf("invalid option %q", opt)
+		}
+		switch key {
+		case "header":
+			s.header = value
+		case "timestamp-header":
+			s.timestampHeader = value
+		case "alg":
+			switch value {
+			case "sha1":
+				s.hash = sha1.New
+			case "sha256":
+				s.hash = sha256.New
+			case "sha512":
+				s.hash = sha512.New
+			default:
+				return nil, fmt.Errorf("unsupported algorithm %q", value)
+			}
+		case "fields":
+			s.fields = strings.Split(value, "+")
+
+			for _, f := range s.fields {
+				switch f {
+				case "method", "path", "query", "body", "timestamp", "host":
+				default:
+					return nil, fmt.Errorf("unsupported field %q", f)
+				}
+			}
+		case "encoding":
+			switch value {
+			case "hex":
+				s.encode = hex.EncodeToString
+			case "base64":
+				s.encode = base64.StdEncoding.EncodeToString
+			default:
+				return nil, fmt.Errorf("unsupported encoding %q", value)
+			}
+		default:
+			return nil, fmt.Errorf("unknown option %q", key)
+		}
+	}
+	return s, nil
+}
+
+func (s *hmacSigner) sign(req *http.Request) {
+	mac := hmac.New(s.hash, s.secret)
+
+	for i, f := range s.fields {
+		if i > 0 {
+			io.WriteString(mac, "\n")
+		}
+		switch f {
+		case "method":
+			io.WriteString(mac, req.Method)
+		case "path":
+			io.WriteString(mac, req.URL.EscapedPath())
+		case "query":
+			io.WriteString(mac, req.URL.RawQuery)
+		case "host":
+			io.WriteString(mac, req.Host)
+		case "timestamp":
+			ts := strconv.FormatInt(time.Now().Unix(), 10)
+			req.Header.Set(s.timestampHeader, ts)
+			io.WriteString(mac, ts)
+		case "body":
+			if req.Body != nil {
+				body, _ := io.ReadAll(req.Body)
+				req.Body = io.NopCloser(bytes.NewReader(body))
+				mac.Write(body)
+			}
+		}
+	}
+	req.Header.Set(s.header, s.encode(mac.Sum(nil)))
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+)
+
+// onRequest registers f to be called with every request before it is sent.
+// Hooks run concurrently from all workers.
+func (b *bench) onRequest(f func(*http.Request)) {
+	b.beforeRequest = append(b.beforeRequest, f)
+}
+
+// onResponse registers f to be called with the outcome of every request and
+// the time until response headers arrived. The body is drained and closed after
+// the hooks return. Hooks run concurrently from all workers.
+func (b *bench) onResponse(f func(*http.Response, error, time.Duration)) {
+	b.afterResponse = append(b.afterResponse, f)
+}
+
+func (b *bench) hasHooks() bool {
+	return len(b.beforeRequest) > 0 || len(b.afterResponse) > 0
+}
+
+func (b *bench) runBeforeRequest(req *http.Request) {
+	for _, f := range b.beforeRequest {
+		f(req)
+	}
+}
+
+// hookBody reads the body of resp for a hook and puts it back, for the body
+// to be counted and checked after the hooks ran.
+func hookBody(resp *http.Response) []byte {
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return body
+}
+
+func (b *bench) runAfterResponse(resp *http.Response, err error, delay time.Duration) {
+	for _, f := range b.afterResponse {
+		f(resp, err, delay)
+	}
+}
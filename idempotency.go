@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// idempotency sends a fresh key with every logical request and re-sends a
+// fraction of them with the same key once they completed, to see how the
+// server deduplicates.
+type idempotency struct {
+	header   string
+	fraction float64
+
+	sent     uint32
+	failed   uint32
+	replayed uint32
+	latency  latencyStats
+
+	mu    sync.Mutex
+	pairs map[[2]int]uint32
+}
+
+func newIdempotency(header, dup string) (*idempotency, error) {
+	i := &idempotency{header: http.CanonicalHeaderKey(header), pairs: make(map[[2]int]uint32)}
+
+	if dup != "" {
+		f, err := parseFraction(dup)
+
+		if err != nil {
+			return nil, fmt.Errorf("idempotency-dup: %w", err)
+		}
+		i.fraction = f
+	}
+	return i, nil
+}
+
+func (i *idempotency) install(b *bench) {
+	b.onRequest(func(req *http.Request) {
+		req.Header.Set(i.header, newUUID())
+	})
+}
+
+// duplicate re-sends r, which already carries its key, when it is picked.
+func (i *idempotency) duplicate(client *http.Client, r *http.Request, data []byte, status int) {
+	if i.fraction == 0 || rand.Float64() >= i.fraction {
+		return
+	}
+	dup := r.Clone(r.Context())
+
+	if data != nil {
+		dup.Body = io.NopCloser(bytes.NewReader(data))
+		dup.ContentLength = int64(len(data))
+	}
+	atomic.AddUint32(&i.sent, 1)
+	start := time.Now()
+	resp, err := client.Do(dup)
+
+	if err != nil {
+		atomic.AddUint32(&i.failed, 1)
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	i.latency.add(time.Since(start))
+
+	if strings.EqualFold(resp.Header.Get("Idempotent-Replayed"), "true") {
+		atomic.AddUint32(&i.replayed, 1)
+	}
+	i.mu.Lock()
+	i.pairs[[2]int{status, resp.StatusCode}]++
+	i.mu.Unlock()
+}
+
+func (i *idempotency) report() string {
+	i.mu.Lock()
+	pairs := make([][2]int, 0, len(i.pairs))
+
+	for p := range i.pairs {
+		pairs = append(pairs, p)
+	}
+	sort.Slice(pairs, func(a, b int) bool {
+		if pairs[a][0] != pairs[b][0] {
+			return pairs[a][0] < pairs[b][0]
+		}
+		return pairs[a][1] < pairs[b][1]
+	})
+	var sb strings.Builder
+
+	for _, p := range pairs {
+		fmt.Fprintf(&sb, "\t\t  %d -> %d: %d\n", p[0], p[1], i.pairs[p])
+	}
+	i.mu.Unlock()
+
+	return fmt.Sprintf(`
+		Idempotency key header: %s
+		Duplicates sent: %d
+		Duplicates failed: %d
+		Duplicates replayed (Idempotent-Replayed): %d
+		Duplicate latency: %s
+		Original -> duplicate status:
+%s`,
+		i.header,
+		atomic.LoadUint32(&i.sent),
+		atomic.LoadUint32(&i.failed),
+		atomic.LoadUint32(&i.replayed),
+		&i.latency,
+		sb.String(),
+	)
+}
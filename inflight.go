@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// inflightLimit caps the requests outstanding across all workers and
+// scenarios, whatever the concurrency or arrival rate.
+type inflightLimit struct {
+	slots chan struct{}
+
+	peak   int64
+	cur    int64
+	waits  uint64
+	waited int64
+}
+
+func newInflightLimit(n uint) *inflightLimit {
+	return &inflightLimit{slots: make(chan struct{}, n)}
+}
+
+// acquire reports false when the run stopped while waiting for a slot.
+func (l *inflightLimit) acquire(done <-chan struct{}) bool {
+	select {
+	case l.slots <- struct{}{}:
+	default:
+		start := time.Now()
+		atomic.AddUint64(&l.waits, 1)
+
+		select {
+		case l.slots <- struct{}{}:
+		case <-done:
+			return false
+		}
+		atomic.AddInt64(&l.waited, int64(time.Since(start)))
+	}
+	if cur := atomic.AddInt64(&l.cur, 1); cur > atomic.LoadInt64(&l.peak) {
+		atomic.StoreInt64(&l.peak, cur)
+	}
+	return true
+}
+
+func (l *inflightLimit) release() {
+	atomic.AddInt64(&l.cur, -1)
+	<-l.slots
+}
+
+func (b *bench) acquire() bool {
+	return b.inflight == nil || b.inflight.acquire(b.ctx.Done())
+}
+
+func (b *bench) release() {
+	if b.inflight != nil {
+		b.inflight.release()
+	}
+}
+
+func (l *inflightLimit) report() string {
+	waits := atomic.LoadUint64(&l.waits)
+	var avg time.Duration
+
+	if waits > 0 {
+		avg = time.Duration(atomic.LoadInt64(&l.waited) / int64(waits))
+	}
+	return fmt.Sprintf(`
+		In-flight cap: %d
+		Peak in-flight: %d
+		Requests delayed by the cap: %d
+		Avg wait for a slot: %s
+	`,
+		cap(l.slots),
+		atomic.LoadInt64(&l.peak),
+		waits,
+		avg,
+	)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"log/slog"
+	"math"
+	"time"
+)
+
+func (b *bench) reportInterim(stop <-chan struct{}) {
+	ticker := time.NewTicker(b.interim)
+	defer ticker.Stop()
+	var prev uint32
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		total, sk, ttfb := b.stats.snapshot()
+		rps := float64(total-prev) / b.interim.Seconds()
+		prev = total
+
+		slog.Info("interim",
+			"elapsed", time.Since(b.stats.LaunchTime).Round(time.Second),
+			"requests", total,
+			"rps", math.Round(rps),
+			"p50", sk.percentile(50),
+			"p90", sk.percentile(90),
+			"p99", sk.percentile(99),
+			"p99.9", sk.percentile(99.9),
+			"ttfb_p50", ttfb.percentile(50),
+			"ttfb_p99", ttfb.percentile(99))
+	}
+}
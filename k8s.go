@@ -0,0 +1,482 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	k8sPoll           = 2 * time.Second
+)
+
+// k8sClient talks to the Kubernetes API directly: in-cluster with the pod's
+// service account, or through kubectl proxy with -k8s-api.
+type k8sClient struct {
+	api       string
+	namespace string
+	token     string
+	client    *http.Client
+}
+
+func newK8sClient(api, namespace string) (*k8sClient, error) {
+	c := &k8sClient{api: strings.TrimSuffix(api, "/"), namespace: namespace, client: &http.Client{Timeout: 30 * time.Second}}
+
+	if token, err := os.ReadFile(serviceAccountDir + "/token"); err == nil {
+		c.token = strings.TrimSpace(string(token))
+	}
+	if ca, err := os.ReadFile(serviceAccountDir + "/ca.crt"); err == nil {
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(ca)
+		c.client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	}
+	if c.api == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+
+		if host == "" {
+			return nil, errors.New("not running in a cluster, point -k8s-api at the API server, e.g. kubectl proxy on http://127.0.0.1:8001")
+		}
+		c.api = "https://" + host + ":" + port
+	}
+	if c.namespace == "" {
+		c.namespace = "default"
+
+		if ns, err := os.ReadFile(serviceAccountDir + "/namespace"); err == nil {
+			c.namespace = strings.TrimSpace(string(ns))
+		}
+	}
+	return c, nil
+}
+
+func (c *k8sClient) do(method, path string, body, out any) error {
+	var r io.Reader
+
+	if body != nil {
+		data, err := json.Marshal(body)
+
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.api+"/api/v1/namespaces/"+c.namespace+path, r)
+
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.client.Do(req)
+
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, bytes.TrimSpace(msg))
+	}
+	if out == nil {
+		return nil
+	}
+	if w, ok := out.(io.Writer); ok {
+		_, err = io.Copy(w, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// stream calls fn with the body of a long-lived GET, such as a followed log.
+func (c *k8sClient) stream(ctx context.Context, path string, fn func(io.Reader) error) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.api+"/api/v1/namespaces/"+c.namespace+path, nil)
+
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := (&http.Client{Transport: c.client.Transport}).Do(req)
+
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+	return fn(resp.Body)
+}
+
+type k8sPod struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Status struct {
+		Phase  string `json:"phase"`
+		Reason string `json:"reason"`
+	} `json:"status"`
+}
+
+// k8sLostBeats is how many heartbeats a worker may miss before it is
+// considered lost.
+const k8sLostBeats = 3
+
+// k8sWorker is what the controller knows of a worker pod, from the API and
+// from following its log.
+type k8sWorker struct {
+	name string
+
+	mu       sync.Mutex
+	phase    string
+	seen     time.Time
+	start    time.Time
+	requests uint32
+	result   *result
+	lost     string
+}
+
+// read scans a worker log for heartbeats and the result document.
+func (w *k8sWorker) read(r io.Reader) error {
+	var doc bytes.Buffer
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 16<<20)
+	in := false
+
+	for sc.Scan() {
+		line := sc.Text()
+		var hb heartbeat
+
+		if !in && strings.HasPrefix(line, `{"heartbeat"`) && json.Unmarshal([]byte(line), &hb) == nil {
+			w.mu.Lock()
+			w.seen, w.requests = time.Now(), hb.Requests
+
+			// Every heartbeat bounds when the load started in our clock from
+			// above, the log delay being the error; the earliest is the best.
+			if start := w.seen.Add(-hb.Elapsed); w.start.IsZero() || start.Before(w.start) {
+				w.start = start
+			}
+			w.mu.Unlock()
+			continue
+		}
+		in = in || line == "{"
+
+		if in {
+			doc.WriteString(line)
+			doc.WriteByte('\n')
+		}
+		if in && line == "}" {
+			r, err := parseResult(doc.Bytes())
+
+			if err != nil {
+				return err
+			}
+			w.mu.Lock()
+			w.result = r
+			w.mu.Unlock()
+			return nil
+		}
+	}
+	return sc.Err()
+}
+
+// k8sWorkers runs the load from worker pods and merges the results of those
+// that finished. Workers that stop sending heartbeats, or whose pod fails
+// or disappears, are marked lost and left out.
+type k8sWorkers struct {
+	client    *k8sClient
+	workers   int
+	requests  uint
+	image     string
+	args      []string
+	output    string
+	history   string
+	timeout   time.Duration
+	heartbeat time.Duration
+	runID     string
+}
+
+func newK8sWorkers(workers uint, image, api, namespace string, timeout, heartbeat time.Duration, args []string, fs *flag.FlagSet) (*k8sWorkers, error) {
+	if image == "" {
+		return nil, errors.New("k8s-workers needs -k8s-image")
+	}
+	if heartbeat <= 0 {
+		return nil, errors.New("k8s-heartbeat must be positive")
+	}
+	client, err := newK8sClient(api, namespace)
+
+	if err != nil {
+		return nil, err
+	}
+	args, _ = cutFlag(args, fs, "k8s-workers", "k8s-image", "k8s-namespace", "k8s-api", "k8s-timeout", "k8s-heartbeat",
+		"heartbeat", "timeline", "o", "summary-only", "history")
+
+	return &k8sWorkers{client: client, workers: int(workers), image: image, args: args, timeout: timeout, heartbeat: heartbeat}, nil
+}
+
+func (k *k8sWorkers) selector() string {
+	return url.QueryEscape("app=bench-worker,bench-run=" + k.runID)
+}
+
+func (k *k8sWorkers) run() error {
+	// Catch interrupts so that the pods are deleted on the way out.
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, interruptSignals...)
+	defer signal.Stop(interrupt)
+	defer k.cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The results go to stdout, where the controller reads them from the log.
+	args := append([]string{"-summary-only", "-o", "/dev/stdout", "-timeline", "-heartbeat", k.heartbeat.String(), "-tag", "k8s-run=" + k.runID}, k.args...)
+	workers := make([]*k8sWorker, k.workers)
+
+	for i := range workers {
+		pod := map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Pod",
+			"metadata": map[string]any{
+				"generateName": "bench-worker-",
+				"labels":       map[string]string{"app": "bench-worker", "bench-run": k.runID},
+			},
+			"spec": map[string]any{
+				"restartPolicy": "Never",
+				"containers":    []map[string]any{{"name": "bench", "image": k.image, "args": args}},
+			},
+		}
+		var created k8sPod
+
+		if err := k.client.do(http.MethodPost, "/pods", pod, &created); err != nil {
+			return fmt.Errorf("creating worker pod: %w", err)
+		}
+		workers[i] = &k8sWorker{name: created.Metadata.Name, phase: "Pending"}
+		go k.follow(ctx, workers[i])
+	}
+	slog.Info("worker pods created", "workers", k.workers, "image", k.image, "namespace", k.client.namespace)
+
+	if err := k.wait(workers, interrupt); err != nil {
+		return err
+	}
+	return k.report(workers)
+}
+
+// follow reads the log of a worker until it delivers its result, reopening
+// the stream when it breaks or the container has not started yet.
+func (k *k8sWorkers) follow(ctx context.Context, w *k8sWorker) {
+	for {
+		err := k.client.stream(ctx, "/pods/"+w.name+"/log?container=bench&follow=true", w.read)
+
+		w.mu.Lock()
+		done := w.result != nil
+		w.mu.Unlock()
+
+		if done || ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			slog.Debug("following worker log failed", "pod", w.name, "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(k8sPoll):
+		}
+	}
+}
+
+// wait polls the worker pods until every worker delivered its result or
+// was lost.
+func (k *k8sWorkers) wait(workers []*k8sWorker, interrupt <-chan os.Signal) error {
+	deadline := time.Now().Add(k.timeout)
+	lostAfter := k8sLostBeats * k.heartbeat
+
+	for {
+		var list struct {
+			Items []k8sPod `json:"items"`
+		}
+		if err := k.client.do(http.MethodGet, "/pods?labelSelector="+k.selector(), nil, &list); err != nil {
+			// The API being unreachable for a moment does not lose the workers.
+			slog.Warn("listing worker pods failed", "err", err)
+		} else {
+			phases := make(map[string]k8sPod, len(list.Items))
+
+			for _, pod := range list.Items {
+				phases[pod.Metadata.Name] = pod
+			}
+			pending := 0
+
+			for _, w := range workers {
+				pod, ok := phases[w.name]
+				w.mu.Lock()
+
+				if w.result == nil && w.lost == "" {
+					if w.lost = k.lost(w, pod, ok, lostAfter); w.lost != "" {
+						slog.Warn("worker lost", "pod", w.name, "reason", w.lost, "requests", w.requests)
+					} else {
+						pending++
+					}
+				}
+				w.mu.Unlock()
+			}
+			if pending == 0 {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			for _, w := range workers {
+				w.mu.Lock()
+
+				if w.result == nil && w.lost == "" {
+					w.lost = "timed out after " + k.timeout.String()
+				}
+				w.mu.Unlock()
+			}
+			return nil
+		}
+		select {
+		case <-interrupt:
+			return withExit(exitAborted, errors.New("interrupted, deleting the worker pods"))
+		case <-time.After(k8sPoll):
+		}
+	}
+}
+
+// lost tells why a worker that has not delivered its result is lost, if it
+// is. A worker is given until its heartbeats are overdue to deliver, also
+// once its pod exited.
+func (k *k8sWorkers) lost(w *k8sWorker, pod k8sPod, ok bool, after time.Duration) string {
+	if !ok {
+		return "pod deleted"
+	}
+	phase := pod.Status.Phase
+	defer func() { w.phase = phase }()
+
+	switch {
+	case phase == "Unknown":
+		return "node unreachable"
+	case phase == "Pending" || w.phase == "Pending":
+		// Heartbeats are due from when the pod runs.
+		w.seen = time.Now()
+	case time.Since(w.seen) > after:
+		reason := fmt.Sprintf("no heartbeat for %s", time.Since(w.seen).Round(time.Second))
+
+		if pod.Status.Reason != "" {
+			reason += ", " + pod.Status.Reason
+		}
+		return reason
+	}
+	return ""
+}
+
+func (k *k8sWorkers) report(workers []*k8sWorker) error {
+	var results []*result
+	var sb strings.Builder
+	var sent, unmeasured uint64
+	lost := 0
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Worker\tStatus\tRequests\tRPS\tErrors\tP50\tP99\tClock skew")
+
+	for _, worker := range workers {
+		worker.mu.Lock()
+		r := worker.result
+
+		if worker.lost != "" {
+			lost++
+			unmeasured += uint64(worker.requests)
+			fmt.Fprintf(w, "%s\tlost: %s\t%d sent\t-\t-\t-\t-\t-\n", worker.name, worker.lost, worker.requests)
+		} else {
+			results = append(results, r)
+			sent += uint64(r.Requests.Total)
+			skew := "-"
+
+			// The worker's own clock places its timeline; move it to where
+			// the heartbeats put it in ours so that the seconds line up.
+			if r.Timeline != nil && !worker.start.IsZero() {
+				skew = r.Timeline.Start.Sub(worker.start).Round(time.Millisecond).String()
+				r.Timeline.Start = worker.start
+			}
+			fmt.Fprintf(w, "%s\tdone\t%d\t%.1f\t%.2f%%\t%s\t%s\t%s\n", worker.name, r.Requests.Total, r.RPS,
+				r.errorRate(), formatLatency(r.Latency.P50Ns), formatLatency(r.Latency.P99Ns), skew)
+		}
+		worker.mu.Unlock()
+	}
+	var merged result
+
+	if len(results) > 0 {
+		m, err := mergeResults(results)
+
+		if err != nil {
+			return err
+		}
+		merged = m
+		merged.Metadata.Tags["k8s-workers"] = fmt.Sprintf("%d/%d", len(results), k.workers)
+		fmt.Fprintf(w, "total\t%d/%d done\t%d\t%.1f\t%.2f%%\t%s\t%s\t\n", len(results), k.workers, merged.Requests.Total, merged.RPS,
+			merged.errorRate(), formatLatency(merged.Latency.P50Ns), formatLatency(merged.Latency.P99Ns))
+	}
+	w.Flush()
+	planned := uint64(k.workers) * uint64(k.requests)
+	fmt.Fprintf(&sb, "\nLoad delivered: %d of %d requests (%.1f%%)", sent+unmeasured, planned, 100*float64(sent+unmeasured)/float64(planned))
+
+	if lost > 0 {
+		fmt.Fprintf(&sb, ", %d of %d workers lost; the results cover %d requests, the lost workers sent at least %d more", lost, k.workers, sent, unmeasured)
+	}
+	sb.WriteString("\n")
+
+	if merged.Timeline != nil && len(merged.Timeline.Slots) > 0 {
+		var counts, p99s []float64
+
+		for _, slot := range merged.Timeline.slots() {
+			counts = append(counts, float64(slotCount(&slot)))
+			p99s = append(p99s, float64(slotPercentile(&slot, 99)))
+		}
+		fmt.Fprintf(&sb, "\nPer second, worker clocks aligned: requests %s  p99 %s\n", sparkline(counts), sparkline(p99s))
+	}
+	fmt.Print(sb.String())
+
+	if len(results) == 0 {
+		return errors.New("no worker delivered results")
+	}
+	if k.output != "" {
+		if err := writeResult(k.output, merged); err != nil {
+			return err
+		}
+	}
+	if k.history != "" {
+		if err := addHistory(k.history, merged); err != nil {
+			return err
+		}
+	}
+	if lost > 0 {
+		return fmt.Errorf("%d of %d workers lost", lost, k.workers)
+	}
+	return nil
+}
+
+func (k *k8sWorkers) cleanup() {
+	if err := k.client.do(http.MethodDelete, "/pods?labelSelector="+k.selector(), nil, nil); err != nil {
+		slog.Error("deleting worker pods failed", "err", err)
+	}
+}
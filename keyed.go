@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const keyedReportLimit = 20
+
+var errUnexpectedStatus = errors.New("unexpected status")
+
+// keyedStats splits latency and failures by an arbitrary key such as a
+// connection or a backend.
+type keyedStats struct {
+	mu   sync.Mutex
+	keys map[string]*keyedStat
+}
+
+type keyedStat struct {
+	key     string
+	latency latencyStats
+	fail    uint32
+}
+
+func newKeyedStats() *keyedStats {
+	return &keyedStats{keys: make(map[string]*keyedStat)}
+}
+
+func (k *keyedStats) add(key string, err error, delay time.Duration) {
+	k.mu.Lock()
+	s, ok := k.keys[key]
+
+	if !ok {
+		s = &keyedStat{key: key}
+		k.keys[key] = s
+	}
+	k.mu.Unlock()
+
+	if err != nil {
+		atomic.AddUint32(&s.fail, 1)
+	}
+	s.latency.add(delay)
+}
+
+// addStatus counts a response whose status was not a success as a failure.
+func (k *keyedStats) addStatus(key string, success bool, err error, delay time.Duration) {
+	if err == nil && !success {
+		err = errUnexpectedStatus
+	}
+	k.add(key, err, delay)
+}
+
+func (k *keyedStats) report(title string) string {
+	k.mu.Lock()
+	stats := make([]*keyedStat, 0, len(k.keys))
+
+	for _, s := range k.keys {
+		stats = append(stats, s)
+	}
+	k.mu.Unlock()
+
+	avgs := make(map[*keyedStat]time.Duration, len(stats))
+	var total uint64
+
+	for _, s := range stats {
+		avgs[s] = s.latency.avg()
+		total += s.latency.samples()
+	}
+	sort.Slice(stats, func(i, j int) bool { return avgs[stats[i]] > avgs[stats[j]] })
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\n\t\t%s (%d, slowest first):\n", title, len(stats))
+
+	for i, s := range stats {
+		if i == keyedReportLimit {
+			fmt.Fprintf(&sb, "\t\t... %d more\n", len(stats)-i)
+			break
+		}
+		fmt.Fprintf(&sb, "\t\t%s: %s fail=%d share=%.1f%%\n",
+			s.key, &s.latency, atomic.LoadUint32(&s.fail), 100*float64(s.latency.samples())/float64(total))
+	}
+	return sb.String()
+}
+
+type segmenter struct {
+	header string
+	stats  *keyedStats
+}
+
+func newSegmenter(spec string) (*segmenter, error) {
+	s := &segmenter{stats: newKeyedStats()}
+
+	switch {
+	case spec == "ip":
+	case strings.HasPrefix(spec, "header:") && len(spec) > len("header:"):
+		s.header = strings.TrimPrefix(spec, "header:")
+	default:
+		return nil, fmt.Errorf("invalid segment %q, expected ip or header:Name", spec)
+	}
+	return s, nil
+}
+
+func (s *segmenter) add(resp *http.Response, conn net.Conn, err error, delay time.Duration) {
+	key := "-"
+
+	if s.header == "" {
+		if conn != nil {
+			key, _, _ = net.SplitHostPort(conn.RemoteAddr().String())
+		}
+	} else if resp != nil {
+		if v := resp.Header.Get(s.header); v != "" {
+			key = v
+		}
+	}
+	s.stats.add(key, err, delay)
+}
+
+func (s *segmenter) report() string {
+	if s.header == "" {
+		return s.stats.report("Per-backend IP")
+	}
+	return s.stats.report("Per-backend " + s.header)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyUnit and latencyPrecision are -latency-unit and -latency-precision;
+// without them every latency is printed in the unit that suits it.
+var (
+	latencyUnit       time.Duration
+	latencyUnitName   string
+	latencyPrecision  = -1
+	latencyUnitsNamed = map[string]time.Duration{
+		"ns": time.Nanosecond,
+		"us": time.Microsecond,
+		"µs": time.Microsecond,
+		"ms": time.Millisecond,
+		"s":  time.Second,
+	}
+)
+
+func setLatencyFormat(unit string, precision int) error {
+	if unit != "" {
+		d, ok := latencyUnitsNamed[unit]
+
+		if !ok {
+			return fmt.Errorf("unknown latency unit %q, expected ns, us, ms or s", unit)
+		}
+		latencyUnit, latencyUnitName = d, unit
+	}
+	if precision > 9 {
+		return fmt.Errorf("latency precision %d is beyond nanoseconds", precision)
+	}
+	latencyPrecision = precision
+	return nil
+}
+
+// formatLatency prints a latency for tables and summaries: rounded to three
+// significant digits or so, or as set with -latency-unit and
+// -latency-precision.
+func formatLatency(d time.Duration) string {
+	if latencyUnit == 0 && latencyPrecision < 0 {
+		switch {
+		case d >= time.Second:
+			return d.Round(10 * time.Millisecond).String()
+		case d >= time.Millisecond:
+			return d.Round(10 * time.Microsecond).String()
+		default:
+			return d.Round(time.Microsecond).String()
+		}
+	}
+	unit, name := latencyUnit, latencyUnitName
+
+	if unit == 0 {
+		switch {
+		case d >= time.Second:
+			unit, name = time.Second, "s"
+		case d >= time.Millisecond:
+			unit, name = time.Millisecond, "ms"
+		case d >= time.Microsecond:
+			unit, name = time.Microsecond, "µs"
+		default:
+			unit, name = time.Nanosecond, "ns"
+		}
+	}
+	precision := latencyPrecision
+
+	if precision < 0 {
+		precision = 3
+	}
+	return strconv.FormatFloat(float64(d)/float64(unit), 'f', precision, 64) + name
+}
+
+// showLatency is formatLatency for the reports that print latencies in full
+// unless told otherwise.
+func showLatency(d time.Duration) string {
+	if latencyUnit == 0 && latencyPrecision < 0 {
+		return d.String()
+	}
+	return formatLatency(d)
+}
+
+// latencyKey is the suffix of latency keys in key=value output, ms unless
+// -latency-unit says otherwise.
+func latencyKey() string {
+	if latencyUnit == 0 {
+		return "ms"
+	}
+	return strings.ReplaceAll(latencyUnitName, "µ", "u")
+}
+
+type latencyStats struct {
+	mu    sync.Mutex
+	count uint64
+	sum   time.Duration
+	min   time.Duration
+	max   time.Duration
+}
+
+func (l *latencyStats) add(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.count == 0 || d < l.min {
+		l.min = d
+	}
+	if d > l.max {
+		l.max = d
+	}
+	l.count++
+	l.sum += d
+}
+
+func (l *latencyStats) samples() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.count
+}
+
+func (l *latencyStats) avg() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.count == 0 {
+		return 0
+	}
+	return l.sum / time.Duration(l.count)
+}
+
+func (l *latencyStats) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.count == 0 {
+		return "n=0"
+	}
+	avg := l.sum / time.Duration(l.count)
+	return fmt.Sprintf("n=%d min=%s avg=%s max=%s", l.count, showLatency(l.min), showLatency(avg), showLatency(l.max))
+}
+
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	return sorted[max(0, min(i, len(sorted)-1))]
+}
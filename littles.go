@@ -0,0 +1,37 @@
+package main
+
+import "fmt"
+
+const generatorBoundRatio = 0.8
+
+func (b *bench) littlesLaw() string {
+	if b.stats.Runtime <= 0 || b.concurrency == 0 {
+		return ""
+	}
+	throughput := float64(b.stats.RequestsTotal) / b.stats.Runtime.Seconds()
+	observed := throughput * b.stats.DelayAvg.Seconds()
+	ratio := observed / float64(b.concurrency)
+
+	res := fmt.Sprintf(`
+		Observed concurrency (throughput x avg delay): %.2f
+		Configured concurrency: %d
+		Utilization: %.1f%%
+	`,
+		observed,
+		b.concurrency,
+		ratio*100,
+	)
+	// Paced workers are meant to sit idle between requests.
+	paced := b.pacer != nil || b.open
+
+	for _, c := range b.children {
+		paced = paced || c.pacer != nil
+	}
+	if ratio < generatorBoundRatio && !paced {
+		res += fmt.Sprintf(
+			"\t\t%s workers spent %.1f%% of the run outside requests; the generator, not the server, was likely the bottleneck\n",
+			paint(colorYellow, "Warning:"), (1-ratio)*100,
+		)
+	}
+	return res
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+var currentPhase atomic.Value
+
+func setPhase(phase string) {
+	currentPhase.Store(phase)
+}
+
+// phaseHandler stamps every record with the phase the run is in when the
+// record is emitted.
+type phaseHandler struct {
+	slog.Handler
+}
+
+func (h phaseHandler) Handle(ctx context.Context, r slog.Record) error {
+	if phase, ok := currentPhase.Load().(string); ok {
+		r.AddAttrs(slog.String("phase", phase))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h phaseHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return phaseHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h phaseHandler) WithGroup(name string) slog.Handler {
+	return phaseHandler{h.Handler.WithGroup(name)}
+}
+
+func setupLogging(level, format, runID string) error {
+	var lvl slog.Level
+
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	var h slog.Handler
+
+	switch strings.ToLower(format) {
+	case "text":
+		h = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid log format %q, expected text or json", format)
+	}
+	slog.SetDefault(slog.New(phaseHandler{h}).With("run", runID))
+	return nil
+}
+
+func newRunID() string {
+	id := make([]byte, 6)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -1,27 +1,118 @@
 package main
 
 import (
-	"context"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
+const (
+	maxDurationGrace = 10 * time.Second
+	// abortGrace is how long an aborted run has for the workers to stop
+	// before the results so far are printed regardless.
+	abortGrace = 5 * time.Second
+)
+
+// interruptSignals abort the run with the results so far. On Windows, Go
+// delivers Ctrl+C and Ctrl+Break as os.Interrupt and closing the console as
+// SIGTERM; os.Kill cannot be caught on any platform.
+var interruptSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
 func main() {
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
-	defer cancel()
+	// A channel rather than signal.NotifyContext: cancelling that context
+	// when main returns would race the normal exit with the abort below.
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, interruptSignals...)
+
+	args := os.Args[1:]
+
+	if len(args) > 0 {
+		if cmd, ok := commands[args[0]]; ok {
+			if err := cmd(args[1:]); err != nil {
+				fatal(err)
+			}
+			return
+		}
+		if args[0] == "run" {
+			args = args[1:]
+		}
+		if tool, rest, ok := cutCompat(args); ok {
+			translated, err := compatArgs(tool, rest)
 
+			if err != nil {
+				fatal(withExit(exitConfig, err))
+			}
+			args = translated
+		}
+	}
 	b := NewBench()
 
-	if err := b.ParseArgs(); err != nil {
-		log.Fatalln(err)
+	if err := b.ParseArgs(args); err != nil {
+		fatal(withExit(exitConfig, err))
+	}
+	if b.delegate != nil {
+		if err := b.delegate.run(); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	// An aborted run prints its results once Run returned, when the stats
+	// are no longer written; only workers stuck past abortGrace leave them
+	// to be printed from the shards as they are.
+	var (
+		aborted atomic.Bool
+		report  sync.Once
+	)
+	abort := func() {
+		aborted.Store(true)
+		b.abort()
+		time.Sleep(abortGrace)
+		report.Do(func() {
+			slog.Error("workers did not stop, printing the results so far")
+			b.PrintResult()
+		})
+		os.Exit(exitAborted)
 	}
 	go func() {
-		<-ctx.Done()
-		b.PrintResult()
-		os.Exit(1)
+		<-interrupt
+		abort()
 	}()
 
-	b.Run()
-	b.PrintResult()
+	var stuck *time.Timer
+
+	if b.maxDuration > 0 {
+		stuck = time.AfterFunc(b.maxDuration+maxDurationGrace, func() {
+			slog.Error("run did not stop within the -max-duration grace period")
+			abort()
+		})
+	}
+
+	err := b.Run()
+
+	// A run that finished must not be taken for a stuck one while it reports.
+	if stuck != nil {
+		stuck.Stop()
+	}
+
+	if aborted.Load() {
+		report.Do(b.PrintResult)
+		os.Exit(exitAborted)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	report.Do(b.PrintResult)
+
+	if err := b.outcome(); err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(exitCode(err))
 }
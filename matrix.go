@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// matrixParam is a run flag and the values the matrix tries for it.
+type matrixParam struct {
+	flag   string
+	values []string
+}
+
+type matrixParams []matrixParam
+
+func (p *matrixParams) String() string {
+	parts := make([]string, len(*p))
+
+	for i, param := range *p {
+		parts[i] = param.flag + "=" + strings.Join(param.values, ",")
+	}
+	return strings.Join(parts, " ")
+}
+
+func (p *matrixParams) Set(s string) error {
+	name, values, ok := strings.Cut(s, "=")
+	name = strings.TrimLeft(name, "-")
+
+	if !ok || name == "" || values == "" {
+		return fmt.Errorf("invalid parameter %q, expected flag=value,value...", s)
+	}
+	*p = append(*p, matrixParam{flag: name, values: strings.Split(values, ",")})
+	return nil
+}
+
+// combinations is the cross product of the values, the last parameter
+// varying fastest.
+func (p matrixParams) combinations() [][]string {
+	combos := [][]string{nil}
+
+	for _, param := range p {
+		next := make([][]string, 0, len(combos)*len(param.values))
+
+		for _, combo := range combos {
+			for _, v := range param.values {
+				next = append(next, append(combo[:len(combo):len(combo)], v))
+			}
+		}
+		combos = next
+	}
+	return combos
+}
+
+type matrixRun struct {
+	values []string
+	result *result
+	err    error
+}
+
+func matrixCommand(args []string) error {
+	fs := flag.NewFlagSet("matrix", flag.ExitOnError)
+	fs.Usage = func() { usage(fs, "matrix [flags] -- [run flags] [URL...]") }
+	var params matrixParams
+	fs.Var(&params, "param", "Run flag and the values to try, e.g. c=1,16,64 or upload-size=1024,65536; may be repeated, runs cover every combination")
+	pause := fs.Duration("pause", 5*time.Second, "Pause between runs, to let the target settle")
+	fs.Parse(args)
+
+	if len(params) == 0 {
+		fs.Usage()
+		return errors.New("matrix needs at least one -param")
+	}
+	runs, err := runMatrix(params, *pause, fs.Args())
+
+	if err != nil {
+		return err
+	}
+	fmt.Print(matrixTable(params, runs))
+	return matrixErr(runs)
+}
+
+// runMatrix runs bench with args once per combination of params, one after
+// the other with a pause in between.
+func runMatrix(params matrixParams, pause time.Duration, args []string) ([]matrixRun, error) {
+	self, err := os.Executable()
+
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "bench-matrix")
+
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	combos := params.combinations()
+	runs := make([]matrixRun, len(combos))
+
+	for i, values := range combos {
+		if i > 0 && pause > 0 {
+			time.Sleep(pause)
+		}
+		output := filepath.Join(dir, fmt.Sprintf("%d.json", i))
+		// Parameters go first: flags after the first URL would not be parsed.
+		run := make([]string, 0, len(values)+3+len(args))
+
+		for j, v := range values {
+			run = append(run, "-"+params[j].flag+"="+v)
+		}
+		run = append(run, "-summary-only", "-o", output)
+		run = append(run, args...)
+		slog.Info("matrix run", "step", fmt.Sprintf("%d/%d", i+1, len(combos)), "args", strings.Join(run[:len(values)], " "))
+
+		cmd := exec.Command(self, run...)
+		cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+		runs[i] = matrixRun{values: values, err: cmd.Run()}
+
+		// A run failing its thresholds still wrote its results.
+		if r, err := readResult(output); err == nil {
+			runs[i].result = r
+		} else if runs[i].err == nil {
+			runs[i].err = err
+		}
+	}
+	return runs, nil
+}
+
+func matrixErr(runs []matrixRun) error {
+	failed := 0
+
+	for _, run := range runs {
+		if run.result == nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d matrix runs failed", failed, len(runs))
+	}
+	return nil
+}
+
+func matrixTable(params matrixParams, runs []matrixRun) string {
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+
+	for _, param := range params {
+		fmt.Fprintf(w, "%s\t", param.flag)
+	}
+	fmt.Fprintln(w, "Requests\tRPS\tErrors\tP50\tP90\tP99\tP99.9\tRPS vs first")
+	var first float64
+
+	for _, run := range runs {
+		for _, v := range run.values {
+			fmt.Fprintf(w, "%s\t", v)
+		}
+		r := run.result
+
+		if r == nil {
+			fmt.Fprintf(w, "failed: %s\n", run.err)
+			continue
+		}
+		change := "-"
+
+		if first == 0 {
+			first = r.RPS
+		} else {
+			change = fmt.Sprintf("%+.1f%%", 100*(r.RPS-first)/first)
+		}
+		fmt.Fprintf(w, "%d\t%.1f\t%.2f%%\t%s\t%s\t%s\t%s\t%s\n", r.Requests.Total, r.RPS, r.errorRate(),
+			formatLatency(r.Latency.P50Ns), formatLatency(r.Latency.P90Ns), formatLatency(r.Latency.P99Ns),
+			formatLatency(r.Latency.P999Ns), change)
+	}
+	w.Flush()
+	return sb.String()
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+
+	"bench/plugins"
+)
+
+// version is set at build time with -ldflags "-X main.version=v1.2.3".
+var version = ""
+
+// secretFlags are redacted from the configuration recorded with the results,
+// as are the values of secretHeaders and the passwords of URLs.
+var secretFlags = map[string]bool{
+	"client-secret": true,
+	"hmac-secret":   true,
+	"digest":        true,
+}
+
+var secretHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Api-Key"}
+
+// recordedValue is the value of f as recorded with the results.
+func recordedValue(name string, f *flag.Flag) string {
+	v := f.Value.String()
+
+	if v == "" {
+		return v
+	}
+	if secretFlags[name] {
+		return "(redacted)"
+	}
+	if h, ok := f.Value.(headerValue); ok {
+		redacted := http.Header(h).Clone()
+
+		for _, k := range secretHeaders {
+			if redacted.Get(k) != "" {
+				redacted.Set(k, "(redacted)")
+			}
+		}
+		return headerValue(redacted).String()
+	}
+	return redactURL(v)
+}
+
+func redactURL(s string) string {
+	if u, err := url.Parse(s); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return s
+}
+
+func newMetadata(fs *flag.FlagSet, tags map[string]string) plugins.Metadata {
+	host, _ := os.Hostname()
+
+	return plugins.Metadata{
+		Version:   toolVersion(),
+		RunID:     newRunID(),
+		Hostname:  host,
+		GOOS:      runtime.GOOS,
+		GOARCH:    runtime.GOARCH,
+		Timestamp: time.Now().UTC(),
+		Tags:      tags,
+		Command:   commandLine(fs),
+		Config:    resolvedConfig(fs),
+	}
+}
+
+func toolVersion() string {
+	if version != "" {
+		return version
+	}
+	info, ok := debug.ReadBuildInfo()
+
+	if !ok {
+		return "unknown"
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" && len(s.Value) >= 12 {
+			return "devel+" + s.Value[:12]
+		}
+	}
+	return "devel"
+}
+
+// resolvedConfig records every flag with the value in effect, defaults
+// included, so that a result can be interpreted without the command line.
+func resolvedConfig(fs *flag.FlagSet) map[string]string {
+	config := make(map[string]string)
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := longFlags[f.Name]; ok {
+			return
+		}
+		config[f.Name] = recordedValue(f.Name, f)
+	})
+	return config
+}
+
+func (b *bench) metadataReport() string {
+	tags := make([]string, 0, len(b.meta.Tags))
+
+	for k, v := range b.meta.Tags {
+		tags = append(tags, k+"="+v)
+	}
+	sort.Strings(tags)
+
+	return fmt.Sprintf(`
+		Run: %s
+		Version: %s
+		Host: %s (%s/%s)
+		Started: %s
+		Tags: %s
+		Command: %s`,
+		b.meta.RunID,
+		b.meta.Version,
+		b.meta.Hostname, b.meta.GOOS, b.meta.GOARCH,
+		b.meta.Timestamp.Format(time.RFC3339),
+		strings.Join(tags, " "),
+		b.meta.Command,
+	)
+}
+
+// commandLine reproduces the explicitly set flags; the full resolved
+// configuration is recorded separately.
+func commandLine(fs *flag.FlagSet) string {
+	args := []string{"bench", fs.Name()}
+	seen := make(map[string]bool)
+
+	fs.Visit(func(f *flag.Flag) {
+		name := f.Name
+
+		if short, ok := longFlags[name]; ok {
+			name = short
+		}
+		if name == "tag" || seen[name] {
+			return
+		}
+		seen[name] = true
+		args = append(args, "-"+name+"="+shellQuote(recordedValue(name, f)))
+	})
+	for _, arg := range fs.Args() {
+		args = append(args, shellQuote(redactURL(arg)))
+	}
+	return strings.Join(args, " ")
+}
+
+func shellQuote(s string) string {
+	if strings.ContainsAny(s, " \t'\"&;|<>()$`\\*?") {
+		return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+	}
+	return s
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// requestMix picks the method of every request by weight, each method with its
+// own body, as a lighter alternative to scenarios.
+type requestMix struct {
+	entries []mixEntry
+	total   int
+	stats   *keyedStats
+}
+
+type mixEntry struct {
+	method   string
+	weight   int
+	data     []byte
+	encoding string
+}
+
+func newRequestMix(spec string, bodies map[string]string, encoding string) (*requestMix, error) {
+	m := &requestMix{stats: newKeyedStats()}
+
+	for _, part := range strings.Split(spec, ",") {
+		method, weight, ok := strings.Cut(strings.TrimSpace(part), ":")
+		w, err := strconv.Atoi(weight)
+
+		if !ok || err != nil || w <= 0 {
+			return nil, fmt.Errorf("invalid mix entry %q, expected METHOD:weight", part)
+		}
+		method = strings.ToUpper(method)
+
+		switch method {
+		case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			return nil, fmt.Errorf("mix: unsupported HTTP method %q", method)
+		}
+		e := mixEntry{method: method, weight: w}
+
+		if body, ok := bodies[method]; ok {
+			var v map[string]any
+
+			if err := json.Unmarshal([]byte(body), &v); err != nil {
+				return nil, fmt.Errorf("mix-data %s: invalid request data, expected JSON object", method)
+			}
+			e.data, _ = json.Marshal(v)
+
+			if encoding != "" {
+				if e.data, err = compressBody(e.data, encoding); err != nil {
+					return nil, err
+				}
+				e.encoding = encoding
+			}
+		}
+		m.entries = append(m.entries, e)
+		m.total += w
+	}
+	for method := range bodies {
+		if !m.has(method) {
+			return nil, fmt.Errorf("mix-data %s: method is not part of -mix", method)
+		}
+	}
+	return m, nil
+}
+
+func (m *requestMix) has(method string) bool {
+	for _, e := range m.entries {
+		if e.method == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *requestMix) pick() *mixEntry {
+	n := rand.Intn(m.total)
+
+	for i := range m.entries {
+		if n -= m.entries[i].weight; n < 0 {
+			return &m.entries[i]
+		}
+	}
+	return &m.entries[len(m.entries)-1]
+}
+
+// apply turns r, a clone of the worker's request, into a request for e.
+func (e *mixEntry) apply(r *http.Request, retries bool) {
+	r.Method = e.method
+	r.GetBody = nil
+
+	if e.data == nil {
+		r.Body, r.ContentLength = nil, 0
+		return
+	}
+	if r.Header.Get("Content-Type") == "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if e.encoding != "" {
+		r.Header.Set("Content-Encoding", e.encoding)
+	}
+	if retries {
+		r.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(e.data)), nil }
+	}
+}
+
+func (m *requestMix) report() string {
+	return m.stats.report("Per-method")
+}
+
+// mixData collects -mix-data METHOD:json bodies.
+type mixData map[string]string
+
+func (d mixData) String() string {
+	return ""
+}
+
+func (d mixData) Set(s string) error {
+	method, body, ok := strings.Cut(s, ":")
+
+	if !ok || method == "" {
+		return errors.New(`expected "METHOD:{json}"`)
+	}
+	d[strings.ToUpper(strings.TrimSpace(method))] = body
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const monitorInterval = 250 * time.Millisecond
+
+type monitor struct {
+	start    time.Time
+	cpuStart time.Duration
+	cpuOK    bool
+	gcStart  runtime.MemStats
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+
+	peakGoroutines int
+	peakConns      int64
+}
+
+func startMonitor(openConns *int64) *monitor {
+	m := &monitor{
+		start: time.Now(),
+		stop:  make(chan struct{}),
+	}
+	m.cpuStart, m.cpuOK = processCPUTime()
+	runtime.ReadMemStats(&m.gcStart)
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(monitorInterval)
+		defer ticker.Stop()
+
+		for {
+			m.sample(openConns)
+
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return m
+}
+
+func (m *monitor) sample(openConns *int64) {
+	m.peakGoroutines = max(m.peakGoroutines, runtime.NumGoroutine())
+	m.peakConns = max(m.peakConns, atomic.LoadInt64(openConns))
+}
+
+func (m *monitor) report() string {
+	select {
+	case <-m.stop:
+	default:
+		close(m.stop)
+	}
+	m.wg.Wait()
+
+	wall := time.Since(m.start)
+	var gc runtime.MemStats
+	runtime.ReadMemStats(&gc)
+
+	gcPause := time.Duration(gc.PauseTotalNs - m.gcStart.PauseTotalNs)
+	numGC := gc.NumGC - m.gcStart.NumGC
+	var maxPause time.Duration
+
+	for i := m.gcStart.NumGC; i < gc.NumGC && i-m.gcStart.NumGC < uint32(len(gc.PauseNs)); i++ {
+		maxPause = max(maxPause, time.Duration(gc.PauseNs[i%uint32(len(gc.PauseNs))]))
+	}
+
+	var sb strings.Builder
+	var warnings []string
+	sb.WriteString("\n\t\tGenerator health:\n")
+
+	if util, ok := m.cpuUtil(); ok {
+		fmt.Fprintf(&sb, "\t\tCPU utilization: %.1f%% of %d cores\n", util, runtime.NumCPU())
+
+		if util > 90 {
+			warnings = append(warnings, "generator CPU was saturated")
+		}
+	}
+	fmt.Fprintf(&sb, "\t\tGC cycles: %d, total pause %s, max pause %s\n", numGC, gcPause, maxPause)
+	fmt.Fprintf(&sb, "\t\tPeak goroutines: %d\n", m.peakGoroutines)
+	fmt.Fprintf(&sb, "\t\tPeak open connections: %d", m.peakConns)
+
+	if ports := ephemeralPorts(); ports > 0 {
+		fmt.Fprintf(&sb, " of %d ephemeral ports", ports)
+
+		if float64(m.peakConns) > 0.8*float64(ports) {
+			warnings = append(warnings, "ephemeral ports are nearly exhausted")
+		}
+	}
+	sb.WriteString("\n")
+
+	if wall > 0 && float64(gcPause) > 0.01*float64(wall) {
+		warnings = append(warnings, "GC pauses exceeded 1% of the run")
+	}
+	for _, w := range warnings {
+		fmt.Fprintf(&sb, "\t\t%s %s; results are likely client-limited\n", paint(colorYellow, "Warning:"), w)
+	}
+	return sb.String()
+}
+
+// cpuUtil is the share of all cores the generator used since the start, in
+// percent.
+func (m *monitor) cpuUtil() (float64, bool) {
+	wall := time.Since(m.start)
+	cpu, ok := processCPUTime()
+
+	if !ok || !m.cpuOK || wall <= 0 {
+		return 0, false
+	}
+	return float64(cpu-m.cpuStart) / float64(wall) / float64(runtime.NumCPU()) * 100, true
+}
+
+func ephemeralPorts() int {
+	data, err := os.ReadFile("/proc/sys/net/ipv4/ip_local_port_range")
+
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+
+	if len(fields) != 2 {
+		return 0
+	}
+	lo, err1 := strconv.Atoi(fields[0])
+	hi, err2 := strconv.Atoi(fields[1])
+
+	if err1 != nil || err2 != nil {
+		return 0
+	}
+	return hi - lo + 1
+}
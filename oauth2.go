@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+type oauth2Auth struct {
+	tokens oauth2.TokenSource
+
+	errors uint32
+}
+
+func newOAuth2(tokenURL, clientID, clientSecret, scope string) (*oauth2Auth, error) {
+	cfg := clientcredentials.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		TokenURL:     tokenURL,
+		Scopes:       strings.FieldsFunc(scope, func(r rune) bool { return r == ',' || r == ' ' }),
+	}
+	tokens := cfg.TokenSource(context.Background())
+
+	if _, err := tokens.Token(); err != nil {
+		return nil, err
+	}
+	return &oauth2Auth{tokens: tokens}, nil
+}
+
+func (a *oauth2Auth) authorize(req *http.Request) {
+	token, err := a.tokens.Token()
+
+	if err != nil {
+		if atomic.AddUint32(&a.errors, 1) == 1 {
+			slog.Warn("oauth2 token request failed", "err", err)
+		}
+		return
+	}
+	token.SetAuthHeader(req)
+}
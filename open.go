@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	modelClosed = "closed"
+	modelOpen   = "open"
+)
+
+// launchOpen starts a goroutine per arrival instead of a fixed pool of
+// workers, so the arrival rate holds when the server slows down. At most
+// concurrency requests run at once, each on a free worker slot and its stats
+// shard; arrivals finding no free slot are dropped and counted.
+func (b *bench) launchOpen(wg *sync.WaitGroup, task task) {
+	slots := make(chan uint, b.concurrency)
+
+	for i := uint(0); i < b.concurrency; i++ {
+		slots <- i
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for i := uint(0); i < b.requests && !b.stopped(); i++ {
+			var at time.Time
+
+			if b.schedule != nil {
+				var ok bool
+
+				if at, ok = b.schedule.waitAt(b.ctx); !ok {
+					break
+				}
+			} else if b.pacer != nil && !b.pacer.wait(b.ctx) {
+				break
+			}
+			atomic.AddUint64(&b.arrivals, 1)
+
+			select {
+			case worker := <-slots:
+				t := task
+				t.worker = worker
+				wg.Add(1)
+				go func() {
+					b.LaunchTask(1, t)
+					slots <- worker
+					wg.Done()
+				}()
+			default:
+				atomic.AddUint64(&b.dropped, 1)
+
+				if b.schedule != nil {
+					b.schedule.unsend(at)
+				}
+			}
+		}
+	}()
+}
+
+func (b *bench) openReport() string {
+	arrivals, dropped := atomic.LoadUint64(&b.arrivals), atomic.LoadUint64(&b.dropped)
+	var pct float64
+
+	if arrivals > 0 {
+		pct = 100 * float64(dropped) / float64(arrivals)
+	}
+	return fmt.Sprintf(`
+		Open model arrivals: %d
+		Dropped at the in-flight cap (-c %d): %d (%.2f%%)
+	`,
+		arrivals,
+		b.concurrency,
+		dropped, pct,
+	)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pacer decides when workers may send. Workers call wait before every
+// request; without a pacer they send back to back. wait returns false when
+// the run is over, because ctx is done or the schedule ended.
+type pacer interface {
+	begin(start time.Time)
+	wait(ctx context.Context) bool
+}
+
+// pace is a no-op in the open model, where arrivals are paced before the
+// request goroutine starts.
+func (b *bench) pace() bool {
+	if b.pacer != nil && !b.open {
+		return b.pacer.wait(b.ctx)
+	}
+	return true
+}
+
+// sleepCtx sleeps for d or until ctx is done, and reports whether it slept
+// the whole time.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// burstPacer releases size requests at the start of every period and holds
+// workers until the next one.
+type burstPacer struct {
+	size   uint
+	period time.Duration
+	start  time.Time
+
+	mu     sync.Mutex
+	cur    int
+	issued uint
+	bursts []*keyedStat
+}
+
+func newBurstPacer(spec string) (*burstPacer, error) {
+	size, period, ok := strings.Cut(spec, "@")
+
+	if !ok {
+		return nil, fmt.Errorf("invalid burst %q, expected count@interval", spec)
+	}
+	n, err := strconv.ParseUint(size, 10, 0)
+
+	if err != nil || n == 0 {
+		return nil, fmt.Errorf("invalid burst size %q", size)
+	}
+	d, err := time.ParseDuration(period)
+
+	if err != nil || d <= 0 {
+		return nil, errors.New("invalid burst interval")
+	}
+	return &burstPacer{size: uint(n), period: d}, nil
+}
+
+func (p *burstPacer) begin(start time.Time) {
+	p.start = start
+}
+
+func (p *burstPacer) wait(ctx context.Context) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for {
+		if cur := int(time.Since(p.start) / p.period); cur > p.cur {
+			p.cur, p.issued = cur, 0
+		}
+		if p.issued < p.size {
+			p.issued++
+			return true
+		}
+		next := p.start.Add(time.Duration(p.cur+1) * p.period)
+		p.mu.Unlock()
+		ok := sleepCtx(ctx, time.Until(next))
+		p.mu.Lock()
+
+		if !ok {
+			return false
+		}
+	}
+}
+
+func (p *burstPacer) add(err error, delay time.Duration) {
+	i := max(int(time.Since(p.start.Add(delay))/p.period), 0)
+
+	p.mu.Lock()
+	for len(p.bursts) <= i {
+		p.bursts = append(p.bursts, &keyedStat{key: fmt.Sprintf("Burst %d", len(p.bursts)+1)})
+	}
+	s := p.bursts[i]
+	p.mu.Unlock()
+
+	if err != nil {
+		atomic.AddUint32(&s.fail, 1)
+	}
+	s.latency.add(delay)
+}
+
+func (p *burstPacer) report() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\n\t\tBursts of %d every %s:\n", p.size, p.period)
+
+	for i, s := range p.bursts {
+		if s.latency.samples() == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "\t\t%s (t=%s): %s fail=%d\n",
+			s.key, time.Duration(i)*p.period, &s.latency, atomic.LoadUint32(&s.fail))
+	}
+	return sb.String()
+}
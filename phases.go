@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	phaseDNS = iota
+	phaseConnect
+	phaseTLS
+	phaseWait
+	phaseTransfer
+	phaseCount
+)
+
+var (
+	phaseNames  = [phaseCount]string{"DNS", "connect", "TLS", "wait", "transfer"}
+	phaseColors = [phaseCount + 1]string{"#8dd3c7", "#80b1d3", "#bebada", "#fb8072", "#fdb462", "#d9d9d9"}
+	phaseBands  = []float64{0, 50, 90, 99, 99.9}
+)
+
+// phaseStats keeps a sketch per request phase, and per bin of the total
+// latency the summed time of every phase, so that the composition of each
+// latency band can be told apart from the overall means.
+type phaseStats struct {
+	phases [phaseCount]sketch
+	total  sketch
+	sums   [][phaseCount]int64
+}
+
+func newPhaseStats() *phaseStats {
+	p := &phaseStats{total: newSketch(), sums: make([][phaseCount]int64, sketchBins)}
+
+	for i := range p.phases {
+		p.phases[i] = newSketch()
+	}
+	return p
+}
+
+func (p *phaseStats) add(t *requestTrace, delay time.Duration) {
+	var d [phaseCount]time.Duration
+
+	if !t.dnsStart.IsZero() && !t.dnsDone.IsZero() {
+		d[phaseDNS] = t.dnsDone.Sub(t.dnsStart)
+	}
+	if !t.connectStart.IsZero() && !t.connectDone.IsZero() {
+		d[phaseConnect] = t.connectDone.Sub(t.connectStart)
+	}
+	if !t.tlsStart.IsZero() && !t.tlsDone.IsZero() {
+		d[phaseTLS] = t.tlsDone.Sub(t.tlsStart)
+	}
+	if !t.wroteRequest.IsZero() && !t.firstByte.IsZero() {
+		d[phaseWait] = t.firstByte.Sub(t.wroteRequest)
+	}
+	if !t.firstByte.IsZero() {
+		d[phaseTransfer] = time.Since(t.firstByte)
+	}
+	k := sketchKey(delay)
+
+	for i, v := range d {
+		// Connection setup is only part of requests that opened a connection.
+		if v > 0 || i >= phaseWait {
+			p.phases[i].add(v)
+			atomic.AddInt64(&p.sums[k][i], int64(v))
+		}
+	}
+	p.total.add(delay)
+}
+
+// bands returns the mean time of every phase, and of the rest, within each
+// percentile band of the total latency.
+func (p *phaseStats) bands() [][phaseCount + 1]time.Duration {
+	out := make([][phaseCount + 1]time.Duration, len(phaseBands))
+	total := p.total.count()
+
+	if total == 0 {
+		return out
+	}
+	var (
+		seen  uint64
+		band  int
+		sums  [phaseCount]int64
+		delay int64
+		n     uint64
+	)
+	flush := func() {
+		if n == 0 {
+			return
+		}
+		rest := delay
+
+		for i := range sums {
+			out[band][i] = time.Duration(sums[i] / int64(n))
+			rest -= sums[i]
+		}
+		out[band][phaseCount] = time.Duration(max(rest, 0) / int64(n))
+		sums, delay, n = [phaseCount]int64{}, 0, 0
+	}
+	for k, c := range p.total.bins {
+		if c == 0 {
+			continue
+		}
+		for band+1 < len(phaseBands) && float64(seen) >= phaseBands[band+1]/100*float64(total) {
+			flush()
+			band++
+		}
+		for i := range sums {
+			sums[i] += atomic.LoadInt64(&p.sums[k][i])
+		}
+		delay += int64(sketchValue(k)) * int64(c)
+		n += c
+		seen += c
+	}
+	flush()
+	return out
+}
+
+func (p *phaseStats) report() string {
+	var sb strings.Builder
+	sb.WriteString("\n\t\tPhase percentiles:\n")
+	fmt.Fprintf(&sb, "\t\t%-9s %8s %10s %10s %10s %10s %10s\n", "phase", "n", "p50", "p90", "p99", "p99.9", "max")
+
+	for i := range p.phases {
+		s := &p.phases[i]
+		fmt.Fprintf(&sb, "\t\t%-9s %8d %10s %10s %10s %10s %10s\n", phaseNames[i], s.count(),
+			formatLatency(s.percentile(50)), formatLatency(s.percentile(90)), formatLatency(s.percentile(99)),
+			formatLatency(s.percentile(99.9)), formatLatency(s.percentile(100)))
+	}
+	sb.WriteString("\n\t\tPhase share by latency band:\n")
+
+	for i, band := range p.bands() {
+		var total time.Duration
+
+		for _, v := range band {
+			total += v
+		}
+		if total == 0 {
+			continue
+		}
+		parts := make([]string, 0, len(band))
+
+		for j, v := range band {
+			parts = append(parts, fmt.Sprintf("%s %.0f%%", phaseName(j), 100*float64(v)/float64(total)))
+		}
+		fmt.Fprintf(&sb, "\t\t%s: %s (mean %s)\n", bandName(i), strings.Join(parts, ", "), formatLatency(total))
+	}
+	return sb.String()
+}
+
+// phaseName names phase i, where phaseCount stands for the unaccounted rest.
+func phaseName(i int) string {
+	if i < phaseCount {
+		return phaseNames[i]
+	}
+	return "other"
+}
+
+func bandName(i int) string {
+	if i+1 < len(phaseBands) {
+		return fmt.Sprintf("p%g-p%g", phaseBands[i], phaseBands[i+1])
+	}
+	return fmt.Sprintf("p%g+", phaseBands[i])
+}
+
+// writeChart draws every latency band as a bar stacked by phase.
+func (p *phaseStats) writeChart(path string, b *bench) error {
+	meta, err := json.Marshal(b.meta)
+
+	if err != nil {
+		return err
+	}
+	const (
+		margin = 90
+		barW   = 600
+		barH   = 22
+	)
+	bands := p.bands()
+	var longest time.Duration
+
+	for _, band := range bands {
+		var total time.Duration
+
+		for _, v := range band {
+			total += v
+		}
+		longest = max(longest, total)
+	}
+	if longest == 0 {
+		return fmt.Errorf("phase chart: no samples")
+	}
+	height := len(bands)*(barH+8) + 60
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="monospace" font-size="10">`+"\n", margin+barW+20, height)
+	fmt.Fprintf(&sb, "<metadata><![CDATA[%s]]></metadata>\n", meta)
+	fmt.Fprintf(&sb, `<rect width="%d" height="%d" fill="#fff"/>`+"\n", margin+barW+20, height)
+
+	for i, band := range bands {
+		y := i * (barH + 8)
+		x := float64(margin)
+		fmt.Fprintf(&sb, `<text x="2" y="%d">%s</text>`+"\n", y+barH/2+4, bandName(i))
+
+		for j, v := range band {
+			w := barW * float64(v) / float64(longest)
+
+			if w <= 0 {
+				continue
+			}
+			fmt.Fprintf(&sb, `<rect x="%.1f" y="%d" width="%.1f" height="%d" fill="%s"><title>%s %s: %s</title></rect>`+"\n",
+				x, y, w, barH, phaseColors[j], bandName(i), phaseName(j), formatLatency(v))
+			x += w
+		}
+	}
+	y := len(bands)*(barH+8) + 12
+
+	for j, color := range phaseColors {
+		x := margin + j*80
+		fmt.Fprintf(&sb, `<rect x="%d" y="%d" width="10" height="10" fill="%s"/><text x="%d" y="%d">%s</text>`+"\n", x, y, color, x+14, y+9, phaseName(j))
+	}
+	fmt.Fprintf(&sb, `<text x="%d" y="%d">mean time per phase within each latency band, up to %s; run %s</text>`+"\n",
+		margin, y+30, formatLatency(longest), b.meta.RunID)
+	sb.WriteString("</svg>\n")
+	svg := sb.String()
+
+	if strings.EqualFold(filepath.Ext(path), ".html") {
+		svg = "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>bench latency phases</title></head><body>\n" +
+			svg + "</body></html>\n"
+	}
+	return os.WriteFile(path, []byte(svg), 0644)
+}
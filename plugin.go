@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"bench/plugins"
+)
+
+// setupPlugins wires what the plugins loaded in ParseArgs registered: the
+// protocol for the target scheme, reporters, the data source and hooks.
+func (b *bench) setupPlugins(reporters, dataSource string) error {
+	u, _ := url.Parse(b.host)
+
+	if f, ok := plugins.LookupProtocol(u.Scheme); ok {
+		p, err := f(u)
+
+		if err != nil {
+			return fmt.Errorf("protocol %s: %w", u.Scheme, err)
+		}
+		b.protocol = p
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+
+	if reporters != "" {
+		for _, name := range strings.Split(reporters, ",") {
+			r, ok := plugins.LookupReporter(name)
+
+			if !ok {
+				return fmt.Errorf("unknown reporter %q", name)
+			}
+			b.reporters = append(b.reporters, r)
+		}
+	}
+
+	if dataSource != "" {
+		name, arg, _ := strings.Cut(dataSource, ":")
+		f, ok := plugins.LookupDataSource(name)
+
+		if !ok {
+			return fmt.Errorf("unknown data source %q", name)
+		}
+		ds, err := f(arg)
+
+		if err != nil {
+			return fmt.Errorf("data source %s: %w", name, err)
+		}
+		b.dataSource = ds
+
+		if b.protocol == nil {
+			b.onRequest(b.applyDataSource)
+		}
+	}
+	before, after := plugins.Hooks()
+
+	for _, f := range before {
+		b.onRequest(f)
+	}
+	for _, f := range after {
+		b.onResponse(f)
+	}
+	return nil
+}
+
+func (b *bench) applyDataSource(req *http.Request) {
+	next, err := b.dataSource.Next()
+
+	if err != nil {
+		return
+	}
+	if next.Method != "" {
+		req.Method = next.Method
+	}
+	if next.URL != "" {
+		if u, err := req.URL.Parse(next.URL); err == nil {
+			req.URL = u
+			req.Host = u.Host
+		}
+	}
+	for k, v := range next.Header {
+		req.Header[k] = v
+	}
+	if next.Body != nil {
+		req.Body = io.NopCloser(bytes.NewReader(next.Body))
+		req.ContentLength = int64(len(next.Body))
+	}
+}
+
+func (b *bench) launchProtocol(numRequest uint, t task) {
+	base := plugins.Request{
+		Method: t.method,
+		URL:    t.url,
+		Header: t.header.Clone(),
+		Body:   t.data,
+	}
+	timeout := b.timeout
+	sh := b.stats.shard(t.worker)
+
+	for i := uint(0); i < numRequest && !b.stopped(); i++ {
+		if !b.pace() {
+			break
+		}
+		req := base
+
+		if b.dataSource != nil {
+			if next, err := b.dataSource.Next(); err == nil {
+				mergeRequest(&req, next)
+			}
+		}
+		if !b.acquire() {
+			break
+		}
+		ctx, cancel := context.WithTimeout(b.ctx, timeout)
+		start := time.Now()
+		resp, err := b.protocol.Do(ctx, &req)
+		cancel()
+		b.release()
+		status := 0
+
+		if err == nil && resp != nil {
+			status = resp.Status
+		}
+		delay := time.Since(start)
+		b.record(sh, status, err, delay)
+
+		if b.failFast != nil && (err != nil || !b.succeeded(status)) && !b.stopped() {
+			b.failFast.trip(t.worker, failedProtocolRequest(&req), nil, status, err, delay)
+		}
+	}
+}
+
+func mergeRequest(req *plugins.Request, next *plugins.Request) {
+	if next.Method != "" {
+		req.Method = next.Method
+	}
+	if next.URL != "" {
+		req.URL = next.URL
+	}
+	if len(next.Header) > 0 {
+		header := req.Header.Clone()
+
+		for k, v := range next.Header {
+			header[k] = v
+		}
+		req.Header = header
+	}
+	if next.Body != nil {
+		req.Body = next.Body
+	}
+}
+
+func (b *bench) runReporters() {
+	s := plugins.Summary{
+		Metadata:        b.meta,
+		Runtime:         b.stats.Runtime,
+		Concurrency:     b.concurrency,
+		RequestsTotal:   b.stats.RequestsTotal,
+		RequestsSuccess: b.stats.RequestsSuccess,
+		RequestsFail:    b.stats.RequestsFail,
+		RequestsTimeout: b.stats.RequestsTimeout,
+		DelayMin:        b.stats.DelayMin,
+		DelayAvg:        b.stats.DelayAvg,
+		DelayMax:        b.stats.DelayMax,
+		TTFBMin:         b.stats.TTFBMin,
+		TTFBAvg:         b.stats.TTFBAvg,
+		TTFBMax:         b.stats.TTFBMax,
+	}
+	for _, r := range b.reporters {
+		if err := r.Report(s); err != nil {
+			slog.Error("reporter failed", "err", err)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package plugins
+
+import (
+	"errors"
+	"net/http"
+)
+
+var (
+	client    *http.Client
+	transport http.RoundTripper
+)
+
+// WithClient makes bench send requests with c instead of the client it
+// builds. A client without Transport gets the built-in one, and one without
+// Timeout gets -t.
+func WithClient(c *http.Client) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if client != nil {
+		return errors.New("plugins: client set twice")
+	}
+	client = c
+	return nil
+}
+
+// WithTransport makes requests go through rt instead of the built-in
+// transport, also for a client set with WithClient.
+func WithTransport(rt http.RoundTripper) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if transport != nil {
+		return errors.New("plugins: transport set twice")
+	}
+	transport = rt
+	return nil
+}
+
+// Client returns a copy of the client set with WithClient and WithTransport,
+// or nil when neither was.
+func Client() *http.Client {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if client == nil && transport == nil {
+		return nil
+	}
+	c := &http.Client{}
+
+	if client != nil {
+		*c = *client
+	}
+	if transport != nil {
+		c.Transport = transport
+	}
+	return c
+}
@@ -0,0 +1,39 @@
+package plugins
+
+import (
+	"net/http"
+	"time"
+)
+
+var (
+	beforeRequest []func(*http.Request)
+	afterResponse []func(*http.Response, error, time.Duration)
+)
+
+// BeforeRequest registers f to be called with every request before it is
+// sent, after the hooks bench installs itself. Hooks run concurrently from
+// all workers.
+func BeforeRequest(f func(*http.Request)) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	beforeRequest = append(beforeRequest, f)
+}
+
+// AfterResponse registers f to be called with the outcome of every request
+// and the time until response headers arrived. A hook reading the body must
+// put it back for bench to count it. Hooks run concurrently from all workers.
+func AfterResponse(f func(*http.Response, error, time.Duration)) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	afterResponse = append(afterResponse, f)
+}
+
+// Hooks returns the registered hooks in the order they were registered.
+func Hooks() ([]func(*http.Request), []func(*http.Response, error, time.Duration)) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return beforeRequest, afterResponse
+}
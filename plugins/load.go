@@ -0,0 +1,17 @@
+package plugins
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// Load opens Go plugins built with -buildmode=plugin. Plugins register
+// themselves from their init functions.
+func Load(paths ...string) error {
+	for _, path := range paths {
+		if _, err := plugin.Open(path); err != nil {
+			return fmt.Errorf("load plugin %s: %w", path, err)
+		}
+	}
+	return nil
+}
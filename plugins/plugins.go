@@ -0,0 +1,153 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Request is what a Protocol sends and a DataSource supplies: the method,
+// target URL, headers and body of one request.
+type Request struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   []byte
+}
+
+// Response is the outcome of a request sent by a Protocol.
+type Response struct {
+	Status int
+}
+
+// Metadata identifies a run: where and with what it was produced.
+type Metadata struct {
+	Version   string            `json:"version"`
+	RunID     string            `json:"run_id"`
+	Hostname  string            `json:"hostname"`
+	GOOS      string            `json:"goos"`
+	GOARCH    string            `json:"goarch"`
+	Timestamp time.Time         `json:"timestamp"`
+	Command   string            `json:"command"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Config    map[string]string `json:"config"`
+}
+
+// Summary is the result of a run handed to reporters.
+type Summary struct {
+	Metadata Metadata
+
+	Runtime     time.Duration
+	Concurrency uint
+
+	RequestsTotal   uint32
+	RequestsSuccess uint32
+	RequestsFail    uint32
+	RequestsTimeout uint32
+
+	DelayMin time.Duration
+	DelayAvg time.Duration
+	DelayMax time.Duration
+
+	TTFBMin time.Duration
+	TTFBAvg time.Duration
+	TTFBMax time.Duration
+}
+
+// Protocol sends a single request. Implementations must be safe for
+// concurrent use by all workers.
+type Protocol interface {
+	Do(ctx context.Context, req *Request) (*Response, error)
+}
+
+// Reporter receives the final summary of a run.
+type Reporter interface {
+	Report(s Summary) error
+}
+
+// DataSource supplies requests for workers. Empty fields of the returned
+// request keep the value configured on the command line.
+type DataSource interface {
+	Next() (*Request, error)
+}
+
+type (
+	// ProtocolFactory builds the protocol for a target URL of its scheme.
+	ProtocolFactory func(target *url.URL) (Protocol, error)
+	// DataSourceFactory builds a data source from the part of -datasource
+	// after the name and colon.
+	DataSourceFactory func(arg string) (DataSource, error)
+)
+
+var (
+	mu          sync.RWMutex
+	protocols   = make(map[string]ProtocolFactory)
+	reporters   = make(map[string]Reporter)
+	dataSources = make(map[string]DataSourceFactory)
+)
+
+// RegisterProtocol makes targets of the URL scheme go through the protocol
+// built by f. It fails if the scheme is already taken.
+func RegisterProtocol(scheme string, f ProtocolFactory) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := protocols[scheme]; ok {
+		return fmt.Errorf("plugins: protocol %q registered twice", scheme)
+	}
+	protocols[scheme] = f
+	return nil
+}
+
+// RegisterReporter makes r available to -reporter under name. It fails if
+// the name is already taken.
+func RegisterReporter(name string, r Reporter) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := reporters[name]; ok {
+		return fmt.Errorf("plugins: reporter %q registered twice", name)
+	}
+	reporters[name] = r
+	return nil
+}
+
+// RegisterDataSource makes the data source built by f available to
+// -datasource under name. It fails if the name is already taken.
+func RegisterDataSource(name string, f DataSourceFactory) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := dataSources[name]; ok {
+		return fmt.Errorf("plugins: data source %q registered twice", name)
+	}
+	dataSources[name] = f
+	return nil
+}
+
+// LookupProtocol returns the protocol factory registered for scheme.
+func LookupProtocol(scheme string) (ProtocolFactory, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	f, ok := protocols[scheme]
+	return f, ok
+}
+
+// LookupReporter returns the reporter registered under name.
+func LookupReporter(name string) (Reporter, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	r, ok := reporters[name]
+	return r, ok
+}
+
+// LookupDataSource returns the data source factory registered under name.
+func LookupDataSource(name string) (DataSourceFactory, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	f, ok := dataSources[name]
+	return f, ok
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type profilePoint struct {
+	at   time.Duration
+	rate float64
+}
+
+// newProfilePacer replays a timestamp,rate schedule. Each rate holds until the
+// next timestamp and the last one holds until the run ends; a last rate of 0
+// ends the run there.
+func newProfilePacer(path string, scale float64) (*ratePacer, error) {
+	if scale <= 0 {
+		return nil, fmt.Errorf("invalid profile scale %g, must be positive", scale)
+	}
+	points, err := loadProfile(path)
+
+	if err != nil {
+		return nil, err
+	}
+	if len(points) == 0 {
+		return nil, errors.New("profile has no points")
+	}
+	sort.SliceStable(points, func(i, j int) bool { return points[i].at < points[j].at })
+	var end time.Duration
+
+	if last := points[len(points)-1]; last.rate == 0 {
+		if last.at == 0 {
+			return nil, errors.New("profile has no rate above 0")
+		}
+		end = last.at
+	}
+	return &ratePacer{
+		end:  end,
+		name: fmt.Sprintf("%s x%g (%d points over %s)", path, scale, len(points), points[len(points)-1].at),
+		rate: func(elapsed time.Duration) float64 {
+			i := sort.Search(len(points), func(i int) bool { return points[i].at > elapsed }) - 1
+			return points[max(i, 0)].rate * scale
+		},
+	}, nil
+}
+
+func loadProfile(path string) ([]profilePoint, error) {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rows [][2]string
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		var entries []struct {
+			Timestamp json.RawMessage `json:"timestamp"`
+			Rate      float64         `json:"rate"`
+		}
+		if err := json.NewDecoder(f).Decode(&entries); err != nil {
+			return nil, fmt.Errorf("profile: %w", err)
+		}
+		for _, e := range entries {
+			ts := strings.Trim(string(e.Timestamp), `"`)
+			rows = append(rows, [2]string{ts, strconv.FormatFloat(e.Rate, 'f', -1, 64)})
+		}
+	} else {
+		r := csv.NewReader(f)
+		r.FieldsPerRecord = 2
+		r.TrimLeadingSpace = true
+		r.Comment = '#'
+
+		records, err := r.ReadAll()
+
+		if err != nil {
+			return nil, fmt.Errorf("profile: %w", err)
+		}
+		for i, rec := range records {
+			if _, err := strconv.ParseFloat(rec[1], 64); err != nil && i == 0 {
+				continue
+			}
+			rows = append(rows, [2]string{rec[0], rec[1]})
+		}
+	}
+	points := make([]profilePoint, 0, len(rows))
+	var first time.Time
+
+	for _, row := range rows {
+		rate, err := strconv.ParseFloat(row[1], 64)
+
+		if err != nil || rate < 0 {
+			return nil, fmt.Errorf("profile: invalid rate %q", row[1])
+		}
+		at, err := parseProfileTime(row[0], &first)
+
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, profilePoint{at: at, rate: rate})
+	}
+	return points, nil
+}
+
+// parseProfileTime accepts seconds since start, a duration such as 90s, or an
+// RFC 3339 timestamp relative to the first one in the file.
+func parseProfileTime(s string, first *time.Time) (time.Duration, error) {
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+
+	if err != nil {
+		return 0, fmt.Errorf("profile: invalid timestamp %q", s)
+	}
+	if first.IsZero() {
+		*first = t
+	}
+	return t.Sub(*first), nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const readyInterval = time.Second
+
+// readiness holds the run back until the target answers a probe with a
+// healthy status, for targets that were just deployed.
+type readiness struct {
+	timeout time.Duration
+	url     string
+	codes   map[int]bool
+	classes map[int]bool
+}
+
+// newReadiness parses the healthy statuses, codes such as 200 or classes
+// such as 2xx, comma-separated.
+func newReadiness(timeout time.Duration, target, status string) (*readiness, error) {
+	if target != "" {
+		if _, err := url.ParseRequestURI(target); err != nil {
+			return nil, fmt.Errorf("invalid ready URL: %w", err)
+		}
+	}
+	r := &readiness{timeout: timeout, url: target, codes: make(map[int]bool), classes: make(map[int]bool)}
+
+	for _, part := range strings.Split(status, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+
+		if class, ok := strings.CutSuffix(part, "xx"); ok {
+			if n, err := strconv.Atoi(class); err == nil && n >= 1 && n <= 5 {
+				r.classes[n] = true
+				continue
+			}
+		}
+		if n, err := strconv.Atoi(part); err == nil && n >= 100 && n <= 599 {
+			r.codes[n] = true
+			continue
+		}
+		return nil, fmt.Errorf("invalid ready status %q, expected codes such as 200 or classes such as 2xx", part)
+	}
+	return r, nil
+}
+
+func (r *readiness) healthy(status int) bool {
+	return r.codes[status] || r.classes[status/100]
+}
+
+// wait probes every readyInterval until the target is healthy or the timeout
+// passed. The probes carry the headers of the run, for authentication.
+func (r *readiness) wait(client *http.Client, t task) error {
+	target := r.url
+
+	if target == "" {
+		target = t.url
+	}
+	start := time.Now()
+	slog.Info("waiting for the target to be ready", "url", target, "timeout", r.timeout)
+	var last string
+
+	for n := 1; ; n++ {
+		if status, err := r.probe(client, target, t.header); err != nil {
+			last = err.Error()
+		} else if r.healthy(status) {
+			slog.Info("target ready", "after", time.Since(start).Round(time.Millisecond), "probes", n)
+			return nil
+		} else {
+			last = "status " + strconv.Itoa(status)
+		}
+		slog.Debug("target not ready", "probe", n, "result", last)
+
+		if time.Since(start)+readyInterval > r.timeout {
+			return fmt.Errorf("target not ready after %s: %s", r.timeout, last)
+		}
+		time.Sleep(readyInterval)
+	}
+}
+
+func (r *readiness) probe(client *http.Client, target string, header http.Header) (int, error) {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+
+	if err != nil {
+		return 0, err
+	}
+	req.Header = header.Clone()
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
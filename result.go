@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+
+	"bench/plugins"
+)
+
+// resultVersion is bumped whenever a change to the result file could break a
+// reader. Every bump adds a migration from the previous version.
+const resultVersion = 1
+
+//go:embed result.schema.json
+var resultSchemaJSON string
+
+var resultSchema = jsonschema.MustCompileString("result.schema.json", resultSchemaJSON)
+
+// resultMigrations upgrade a decoded document from the keyed version to the
+// next one.
+var resultMigrations = map[int]func(doc map[string]any) error{}
+
+type result struct {
+	SchemaVersion int              `json:"schema_version"`
+	Metadata      plugins.Metadata `json:"metadata"`
+
+	RuntimeNs   time.Duration `json:"runtime_ns"`
+	Concurrency uint          `json:"concurrency"`
+	RPS         float64       `json:"rps"`
+
+	Requests resultRequests `json:"requests"`
+	Bytes    resultBytes    `json:"bytes"`
+	Latency  resultLatency  `json:"latency"`
+	TTFB     resultLatency  `json:"ttfb"`
+
+	Timeline *resultTimeline `json:"timeline,omitempty"`
+}
+
+type resultRequests struct {
+	Total   uint32 `json:"total"`
+	Success uint32 `json:"success"`
+	Fail    uint32 `json:"fail"`
+	Timeout uint32 `json:"timeout"`
+	NoFile  uint32 `json:"no_file"`
+}
+
+type resultBytes struct {
+	Sent    uint64 `json:"sent"`
+	Wire    uint64 `json:"wire"`
+	Decoded uint64 `json:"decoded"`
+}
+
+// resultLatency keeps the sketch bins next to the percentiles so that results
+// can be merged without losing accuracy.
+type resultLatency struct {
+	MinNs  time.Duration `json:"min_ns"`
+	AvgNs  time.Duration `json:"avg_ns"`
+	MaxNs  time.Duration `json:"max_ns"`
+	P50Ns  time.Duration `json:"p50_ns"`
+	P90Ns  time.Duration `json:"p90_ns"`
+	P99Ns  time.Duration `json:"p99_ns"`
+	P999Ns time.Duration `json:"p999_ns"`
+
+	Sketch resultSketch `json:"sketch"`
+}
+
+type resultSketch struct {
+	Accuracy float64           `json:"accuracy"`
+	MinNs    time.Duration     `json:"min_ns"`
+	Bins     map[string]uint64 `json:"bins"`
+}
+
+func newResultLatency(s *sketch, lo, avg, hi time.Duration) resultLatency {
+	bins := make(map[string]uint64)
+
+	for k, c := range s.bins {
+		if c > 0 {
+			bins[strconv.Itoa(k)] = c
+		}
+	}
+	return resultLatency{
+		MinNs:  lo,
+		AvgNs:  avg,
+		MaxNs:  hi,
+		P50Ns:  s.percentile(50),
+		P90Ns:  s.percentile(90),
+		P99Ns:  s.percentile(99),
+		P999Ns: s.percentile(99.9),
+		Sketch: resultSketch{Accuracy: sketchAccuracy, MinNs: sketchMin, Bins: bins},
+	}
+}
+
+// resultTimeline is the latency histogram of every second of the run, the
+// buckets keyed like the sketch bins. Start is in the clock of the host that
+// ran it.
+type resultTimeline struct {
+	Start time.Time           `json:"start"`
+	Slots []map[string]uint64 `json:"slots"`
+}
+
+func newResultTimeline(t *timeline) *resultTimeline {
+	rt := &resultTimeline{Start: t.start}
+
+	for _, slot := range t.snapshot() {
+		buckets := make(map[string]uint64)
+
+		for k, c := range slot {
+			if c > 0 {
+				buckets[strconv.Itoa(k)] = uint64(c)
+			}
+		}
+		rt.Slots = append(rt.Slots, buckets)
+	}
+	return rt
+}
+
+func (rt *resultTimeline) slots() [][timelineBuckets]uint32 {
+	slots := make([][timelineBuckets]uint32, len(rt.Slots))
+
+	for i, buckets := range rt.Slots {
+		for k, c := range buckets {
+			if n, err := strconv.Atoi(k); err == nil && n >= 0 && n < timelineBuckets {
+				slots[i][n] += uint32(c)
+			}
+		}
+	}
+	return slots
+}
+
+// mergeTimelines lines the timelines up by their start and adds them second
+// by second.
+func mergeTimelines(results []*result) *resultTimeline {
+	var m *resultTimeline
+
+	for _, r := range results {
+		if r.Timeline != nil && (m == nil || r.Timeline.Start.Before(m.Start)) {
+			m = &resultTimeline{Start: r.Timeline.Start}
+		}
+	}
+	if m == nil {
+		return nil
+	}
+	for _, r := range results {
+		if r.Timeline == nil {
+			continue
+		}
+		offset := int(math.Round(float64(r.Timeline.Start.Sub(m.Start)) / float64(timelineSlot)))
+
+		for i, buckets := range r.Timeline.Slots {
+			for len(m.Slots) <= offset+i {
+				m.Slots = append(m.Slots, make(map[string]uint64))
+			}
+			for k, c := range buckets {
+				m.Slots[offset+i][k] += c
+			}
+		}
+	}
+	return m
+}
+
+func (l *resultLatency) sketch() (sketch, error) {
+	s := newSketch()
+
+	if l.Sketch.Accuracy != sketchAccuracy || l.Sketch.MinNs != sketchMin {
+		return s, fmt.Errorf("sketch accuracy %g and minimum %s are incompatible", l.Sketch.Accuracy, l.Sketch.MinNs)
+	}
+	for key, c := range l.Sketch.Bins {
+		k, err := strconv.Atoi(key)
+
+		if err != nil || k < 0 || k >= len(s.bins) {
+			return s, fmt.Errorf("invalid sketch bin %q", key)
+		}
+		s.bins[k] = c
+	}
+	return s, nil
+}
+
+func (b *bench) result() result {
+	s := &b.stats
+	var rps float64
+
+	if s.Runtime > 0 {
+		rps = float64(s.RequestsTotal) / s.Runtime.Seconds()
+	}
+
+	r := result{
+		SchemaVersion: resultVersion,
+		Metadata:      b.meta,
+		RuntimeNs:     s.Runtime,
+		Concurrency:   b.concurrency,
+		RPS:           rps,
+		Requests: resultRequests{
+			Total:   s.RequestsTotal,
+			Success: s.RequestsSuccess,
+			Fail:    s.RequestsFail,
+			Timeout: s.RequestsTimeout,
+			NoFile:  s.RequestsNoFile,
+		},
+		Bytes: resultBytes{
+			Sent:    s.BytesSent,
+			Wire:    s.BytesWire,
+			Decoded: s.BytesDecoded,
+		},
+		Latency: newResultLatency(&s.Delays, s.DelayMin, s.DelayAvg, s.DelayMax),
+		TTFB:    newResultLatency(&s.TTFB, s.TTFBMin, s.TTFBAvg, s.TTFBMax),
+	}
+	if b.timeline != nil {
+		r.Timeline = newResultTimeline(b.timeline)
+	}
+	return r
+}
+
+// resultMetrics are the summary metrics of a result by name, latencies in
+// nanoseconds and errors in percent.
+var resultMetrics = map[string]func(*result) float64{
+	"p50":      func(r *result) float64 { return float64(r.Latency.P50Ns) },
+	"p90":      func(r *result) float64 { return float64(r.Latency.P90Ns) },
+	"p99":      func(r *result) float64 { return float64(r.Latency.P99Ns) },
+	"p99.9":    func(r *result) float64 { return float64(r.Latency.P999Ns) },
+	"avg":      func(r *result) float64 { return float64(r.Latency.AvgNs) },
+	"max":      func(r *result) float64 { return float64(r.Latency.MaxNs) },
+	"ttfb-p50": func(r *result) float64 { return float64(r.TTFB.P50Ns) },
+	"ttfb-p99": func(r *result) float64 { return float64(r.TTFB.P99Ns) },
+	"rps":      func(r *result) float64 { return r.RPS },
+	"errors":   (*result).errorRate,
+}
+
+func resultMetricNames() []string {
+	names := make([]string, 0, len(resultMetrics))
+
+	for name := range resultMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// formatMetric formats a value of resultMetrics[metric].
+func formatMetric(metric string, v float64) string {
+	switch metric {
+	case "rps":
+		return fmt.Sprintf("%.1f", v)
+	case "errors":
+		return fmt.Sprintf("%.2f%%", v)
+	}
+	return formatLatency(time.Duration(v))
+}
+
+func marshalResult(r result) ([]byte, error) {
+	data, err := json.MarshalIndent(r, "", "  ")
+
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func writeResult(path string, r result) error {
+	data, err := marshalResult(r)
+
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// readResult loads a result file written by any version of bench, migrates
+// it to the current version and validates it against the schema.
+func readResult(path string) (*result, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+	r, err := parseResult(data)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return r, nil
+}
+
+func parseResult(data []byte) (*result, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc map[string]any
+
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if err := migrateResult(doc); err != nil {
+		return nil, err
+	}
+	if err := resultSchema.Validate(doc); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(doc)
+
+	if err != nil {
+		return nil, err
+	}
+	var r result
+
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func migrateResult(doc map[string]any) error {
+	n, ok := doc["schema_version"].(json.Number)
+
+	if !ok {
+		return errors.New("missing schema_version, not a bench result file")
+	}
+	v, err := strconv.Atoi(n.String())
+
+	if err != nil || v < 1 {
+		return fmt.Errorf("invalid schema_version %s", n)
+	}
+	if v > resultVersion {
+		return fmt.Errorf("schema_version %d is newer than this bench supports (%d)", v, resultVersion)
+	}
+	for ; v < resultVersion; v++ {
+		if err := resultMigrations[v](doc); err != nil {
+			return fmt.Errorf("migrating from schema_version %d: %w", v, err)
+		}
+		doc["schema_version"] = json.Number(strconv.Itoa(v + 1))
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retry resends r while it fails in a retryable way. The body is rewound with
+// GetBody; requests whose body can't be rewound, such as uploads, are not
+// retried. The latency of a request includes all of its attempts.
+func (b *bench) retry(client *http.Client, r *http.Request, sh *statsShard, resp *http.Response, err error) (*http.Response, error) {
+	for i := uint(0); i < b.retries && retryable(resp, err) && !b.stopped(); i++ {
+		if r.Body != nil {
+			if r.GetBody == nil {
+				break
+			}
+			body, bodyErr := r.GetBody()
+
+			if bodyErr != nil {
+				break
+			}
+			r.Body = body
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		atomic.AddUint32(&sh.retries, 1)
+		resp, err = client.Do(r)
+	}
+	return resp, err
+}
+
+// setTimeout overrides the request timeout of a scenario. Clients without a
+// timeout, as in -stream mode, keep relying on the transport's limits.
+func (b *bench) setTimeout(d time.Duration) {
+	b.timeout = d
+
+	if b.client == nil || b.client.Timeout == 0 {
+		return
+	}
+	withTimeout := func(c *http.Client) *http.Client {
+		clone := *c
+		clone.Timeout = d
+		return &clone
+	}
+	b.client = withTimeout(b.client)
+	clients := make([]*http.Client, len(b.clients))
+
+	for i, c := range b.clients {
+		clients[i] = withTimeout(c)
+	}
+	b.clients = clients
+}
+
+func (b *bench) retryReport() string {
+	return fmt.Sprintf(`
+		Retried attempts: %d
+	`,
+		b.stats.Retries,
+	)
+}
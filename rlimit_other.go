@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+func raiseFileLimit(need uint64) (uint64, error) {
+	return 0, errors.New("file descriptor limit is not supported on this platform")
+}
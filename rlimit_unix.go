@@ -0,0 +1,23 @@
+//go:build linux || darwin
+
+package main
+
+import "syscall"
+
+func raiseFileLimit(need uint64) (uint64, error) {
+	var lim syscall.Rlimit
+
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+		return 0, err
+	}
+	if lim.Cur >= need {
+		return lim.Cur, nil
+	}
+	cur := lim.Cur
+	lim.Cur = min(need, lim.Max)
+
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+		return cur, nil
+	}
+	return lim.Cur, nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type scenario struct {
+	Name        string            `json:"name"`
+	URL         string            `json:"url"`
+	Method      string            `json:"method"`
+	Params      string            `json:"params"`
+	Data        map[string]any    `json:"data"`
+	Headers     map[string]string `json:"headers"`
+	Concurrency uint              `json:"concurrency"`
+	Requests    uint              `json:"requests"`
+	Rate        float64           `json:"rate"`
+	Shape       string            `json:"shape"`
+	Burst       string            `json:"burst"`
+	Timeout     string            `json:"timeout"`
+	Retries     *uint             `json:"retries"`
+}
+
+func loadScenarios(path string) ([]scenario, error) {
+	src, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+	var scenarios []scenario
+
+	if err := json.Unmarshal(src, &scenarios); err != nil {
+		return nil, fmt.Errorf("scenarios: %w", err)
+	}
+	if len(scenarios) == 0 {
+		return nil, errors.New("scenarios: file defines no scenarios")
+	}
+	for i, sc := range scenarios {
+		if sc.Name == "" {
+			scenarios[i].Name = fmt.Sprintf("scenario %d", i+1)
+		}
+		if _, err := url.ParseRequestURI(sc.URL); err != nil {
+			return nil, fmt.Errorf("scenario %q: invalid URL", scenarios[i].Name)
+		}
+		if d, err := time.ParseDuration(sc.Timeout); sc.Timeout != "" && (err != nil || d <= 0) {
+			return nil, fmt.Errorf("scenario %q: invalid timeout %q", scenarios[i].Name, sc.Timeout)
+		}
+	}
+	return scenarios, nil
+}
+
+// newScenario derives an independent bench for sc that shares the parent's
+// clients, hooks and checks but keeps its own load model and statistics.
+func (b *bench) newScenario(sc scenario) (*bench, error) {
+	c := *b
+	c.name = sc.Name
+	c.scenarios, c.children = nil, nil
+	c.stats = stats{}
+	c.arrivals, c.dropped = 0, 0
+	c.pacer, c.burst, c.schedule = nil, nil, nil
+	c.host = sc.URL
+
+	if sc.Method != "" {
+		c.method = strings.ToUpper(sc.Method)
+	}
+	if sc.Params != "" {
+		if p, err := url.ParseQuery(sc.Params); err == nil {
+			c.params = p
+		}
+	} else {
+		c.params = nil
+	}
+	if sc.Data != nil {
+		c.data = sc.Data
+	}
+	if sc.Concurrency > 0 {
+		c.concurrency = sc.Concurrency
+	}
+	if sc.Requests > 0 {
+		c.requests = sc.Requests
+	}
+	if sc.Timeout != "" {
+		d, _ := time.ParseDuration(sc.Timeout)
+		c.setTimeout(d)
+	}
+	if sc.Retries != nil {
+		c.retries = *sc.Retries
+	}
+	switch {
+	case sc.Burst != "":
+		p, err := newBurstPacer(sc.Burst)
+
+		if err != nil {
+			return nil, fmt.Errorf("scenario %q: %w", sc.Name, err)
+		}
+		c.burst, c.pacer = p, p
+	case sc.Shape != "":
+		p, err := newShapePacer(sc.Shape)
+
+		if err != nil {
+			return nil, fmt.Errorf("scenario %q: %w", sc.Name, err)
+		}
+		c.schedule, c.pacer = p, p
+	case sc.Rate > 0:
+		p := newConstantPacer(sc.Rate)
+		c.schedule, c.pacer = p, p
+	}
+	return &c, nil
+}
+
+// positionalTargets takes URLs given as arguments. A single URL is the same as
+// -h; several become one scenario each, with the command line load model.
+func (b *bench) positionalTargets(args []string, host *string, params queryValue, burst, shape string, rate float64) error {
+	if len(args) == 0 {
+		return nil
+	}
+	if b.scenarios != nil {
+		return errors.New("URL arguments cannot be combined with -scenarios")
+	}
+	if *host != "" {
+		args = append([]string{*host}, args...)
+	}
+	if len(args) == 1 {
+		*host = args[0]
+		return nil
+	}
+	for i, target := range args {
+		if _, err := url.ParseRequestURI(target); err != nil {
+			return fmt.Errorf("invalid URL %q", target)
+		}
+		b.scenarios = append(b.scenarios, scenario{
+			Name:   fmt.Sprintf("target %d", i+1),
+			URL:    target,
+			Params: params.String(),
+			Burst:  burst,
+			Shape:  shape,
+			Rate:   rate,
+		})
+	}
+	*host = args[0]
+	return nil
+}
+
+func (b *bench) prepareScenarios() ([]task, error) {
+	tasks := make([]task, len(b.scenarios))
+
+	for i, sc := range b.scenarios {
+		c, err := b.newScenario(sc)
+
+		if err != nil {
+			return nil, err
+		}
+		if tasks[i], err = c.newTask(); err != nil {
+			return nil, err
+		}
+		for k, v := range sc.Headers {
+			tasks[i].header.Set(k, v)
+		}
+		b.children = append(b.children, c)
+	}
+	return tasks, nil
+}
+
+func (b *bench) launchScenarios(wg *sync.WaitGroup) error {
+	tasks, err := b.prepareScenarios()
+
+	if err != nil {
+		return err
+	}
+	b.stats.shards = nil
+	b.concurrency = 0
+
+	for i, c := range b.children {
+		c.stats.init(c.concurrency)
+		c.stats.LaunchTime = b.stats.LaunchTime
+
+		if c.pacer != nil {
+			c.pacer.begin(c.stats.LaunchTime)
+		}
+		b.stats.shards = append(b.stats.shards, c.stats.shards...)
+		b.concurrency += c.concurrency
+		c.launchWorkers(wg, tasks[i])
+	}
+	return nil
+}
+
+func (b *bench) scenarioReport() string {
+	var sb strings.Builder
+	sb.WriteString("\n\t\tScenarios:\n")
+
+	for _, c := range b.children {
+		c.stats.Runtime = b.stats.Runtime
+		c.stats.merge()
+		rps := float64(c.stats.RequestsTotal) / c.stats.Runtime.Seconds()
+
+		fmt.Fprintf(&sb, "\t\t%s: %s %s concurrency=%d requests=%d success=%d fail=%d rps=%.0f avg=%s p50=%s p99=%s\n",
+			c.name, c.method, c.host, c.concurrency, c.stats.RequestsTotal, c.stats.RequestsSuccess,
+			c.stats.RequestsFail, rps, showLatency(c.stats.DelayAvg), showLatency(c.stats.Delays.percentile(50)),
+			showLatency(c.stats.Delays.percentile(99)))
+	}
+	return sb.String()
+}
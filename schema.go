@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+var errSchemaViolation = errors.New("response violates JSON schema")
+
+type schemaValidator struct {
+	schema *jsonschema.Schema
+
+	validated  uint32
+	violations uint32
+}
+
+func newSchemaValidator(path string) (*schemaValidator, error) {
+	schema, err := jsonschema.Compile(path)
+
+	if err != nil {
+		return nil, err
+	}
+	return &schemaValidator{schema: schema}, nil
+}
+
+func (v *schemaValidator) validate(body []byte) error {
+	atomic.AddUint32(&v.validated, 1)
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var doc any
+	err := dec.Decode(&doc)
+
+	if err == nil {
+		err = v.schema.Validate(doc)
+	}
+	if err != nil {
+		if atomic.AddUint32(&v.violations, 1) == 1 {
+			slog.Warn("schema violation", "err", err)
+		}
+		return errSchemaViolation
+	}
+	return nil
+}
+
+func (v *schemaValidator) report() string {
+	return fmt.Sprintf(`
+		Schema validated responses: %d
+		Schema violations: %d
+	`,
+		atomic.LoadUint32(&v.validated),
+		atomic.LoadUint32(&v.violations),
+	)
+}
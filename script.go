@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+type scriptEngine interface {
+	install(b *bench)
+	report(b *bench) string
+}
+
+type jsScript struct {
+	vms chan *scriptVM
+
+	errors uint32
+	checks uint32
+	failed uint32
+
+	mu      sync.Mutex
+	metrics map[string]*metric
+}
+
+type scriptVM struct {
+	rt       *goja.Runtime
+	request  goja.Callable
+	response goja.Callable
+}
+
+type metric struct {
+	count    uint64
+	sum      float64
+	min, max float64
+}
+
+func loadScript(path string, n uint) (scriptEngine, error) {
+	if strings.HasSuffix(path, ".lua") {
+		return loadLuaScript(path, n)
+	}
+	return loadJSScript(path, n)
+}
+
+func loadJSScript(path string, n uint) (*jsScript, error) {
+	src, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+	prg, err := goja.Compile(path, string(src), false)
+
+	if err != nil {
+		return nil, err
+	}
+	s := &jsScript{
+		vms:     make(chan *scriptVM, n),
+		metrics: make(map[string]*metric),
+	}
+	for i := uint(0); i < n; i++ {
+		vm, err := s.newVM(prg)
+
+		if err != nil {
+			return nil, err
+		}
+		s.vms <- vm
+	}
+	return s, nil
+}
+
+func (s *jsScript) newVM(prg *goja.Program) (*scriptVM, error) {
+	rt := goja.New()
+	rt.SetFieldNameMapper(goja.TagFieldNameMapper("js", true))
+
+	if err := rt.Set("metric", s.addMetric); err != nil {
+		return nil, err
+	}
+	if _, err := rt.RunProgram(prg); err != nil {
+		return nil, err
+	}
+	vm := &scriptVM{rt: rt}
+	vm.request, _ = goja.AssertFunction(rt.Get("request"))
+	vm.response, _ = goja.AssertFunction(rt.Get("response"))
+
+	if vm.request == nil && vm.response == nil {
+		return nil, fmt.Errorf("script defines neither request() nor response()")
+	}
+	return vm, nil
+}
+
+func (s *jsScript) install(b *bench) {
+	vm := <-s.vms
+	s.vms <- vm
+
+	if vm.request != nil {
+		b.onRequest(s.beforeRequest)
+	}
+	if vm.response != nil {
+		b.onResponse(s.afterResponse)
+	}
+}
+
+func (s *jsScript) beforeRequest(req *http.Request) {
+	vm := <-s.vms
+	defer func() { s.vms <- vm }()
+
+	obj := vm.rt.NewObject()
+	obj.Set("method", req.Method)
+	obj.Set("url", req.URL.String())
+	obj.Set("headers", flattenHeader(req.Header))
+	obj.Set("body", "")
+
+	ret, err := vm.request(goja.Undefined(), obj)
+
+	if err != nil {
+		s.fail(err)
+		return
+	}
+	if o, ok := ret.(*goja.Object); ok {
+		obj = o
+	}
+	if err := applyScriptRequest(req, obj); err != nil {
+		s.fail(err)
+	}
+}
+
+func (s *jsScript) afterResponse(resp *http.Response, err error, delay time.Duration) {
+	vm := <-s.vms
+	defer func() { s.vms <- vm }()
+
+	obj := vm.rt.NewObject()
+	obj.Set("ttfb", float64(delay)/float64(time.Millisecond))
+
+	if err != nil {
+		obj.Set("status", 0)
+		obj.Set("error", err.Error())
+	} else {
+		body := hookBody(resp)
+		obj.Set("status", resp.StatusCode)
+		obj.Set("headers", flattenHeader(resp.Header))
+		obj.Set("body", string(body))
+	}
+	ret, callErr := vm.response(goja.Undefined(), obj)
+
+	if callErr != nil {
+		s.fail(callErr)
+		return
+	}
+	if goja.IsUndefined(ret) || goja.IsNull(ret) {
+		return
+	}
+	atomic.AddUint32(&s.checks, 1)
+
+	if !ret.ToBoolean() {
+		atomic.AddUint32(&s.failed, 1)
+	}
+}
+
+func (s *jsScript) addMetric(name string, value float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.metrics[name]
+
+	if !ok {
+		m = &metric{min: math.Inf(1), max: math.Inf(-1)}
+		s.metrics[name] = m
+	}
+	m.count++
+	m.sum += value
+	m.min = math.Min(m.min, value)
+	m.max = math.Max(m.max, value)
+}
+
+func (s *jsScript) fail(err error) {
+	if atomic.AddUint32(&s.errors, 1) == 1 {
+		slog.Warn("script error", "err", err)
+	}
+}
+
+func (s *jsScript) report(b *bench) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\t\tScript errors: %d\n", atomic.LoadUint32(&s.errors))
+	fmt.Fprintf(&sb, "\t\tScript checks: %d (%d failed)\n", atomic.LoadUint32(&s.checks), atomic.LoadUint32(&s.failed))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.metrics))
+
+	for name := range s.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		m := s.metrics[name]
+		fmt.Fprintf(&sb, "\t\t%s: count=%d avg=%g min=%g max=%g\n", name, m.count, m.sum/float64(m.count), m.min, m.max)
+	}
+	return sb.String()
+}
+
+func applyScriptRequest(req *http.Request, obj *goja.Object) error {
+	if v := obj.Get("method"); v != nil && !goja.IsUndefined(v) {
+		req.Method = strings.ToUpper(v.String())
+	}
+	if v := obj.Get("url"); v != nil && !goja.IsUndefined(v) {
+		u, err := url.Parse(v.String())
+
+		if err != nil {
+			return err
+		}
+		req.URL = u
+		req.Host = u.Host
+	}
+	if v := obj.Get("headers"); v != nil && !goja.IsUndefined(v) {
+		if h, ok := v.Export().(map[string]any); ok {
+			req.Header = make(http.Header, len(h))
+
+			for k, val := range h {
+				req.Header.Set(k, fmt.Sprint(val))
+			}
+		}
+	}
+	if v := obj.Get("body"); v != nil && !goja.IsUndefined(v) {
+		if body := v.String(); body != "" {
+			req.Body = io.NopCloser(strings.NewReader(body))
+			req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader(body)), nil }
+			req.ContentLength = int64(len(body))
+		}
+	}
+	return nil
+}
+
+func flattenHeader(h http.Header) map[string]any {
+	m := make(map[string]any, len(h))
+
+	for k := range h {
+		m[k] = h.Get(k)
+	}
+	return m
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+type luaScript struct {
+	states chan *lua.LState
+	first  *lua.LState
+
+	hasRequest  bool
+	hasResponse bool
+	hasDone     bool
+	static      *luaRequest
+
+	errors uint32
+}
+
+type luaRequest struct {
+	method string
+	path   string
+	header http.Header
+	body   string
+}
+
+func loadLuaScript(path string, n uint) (*luaScript, error) {
+	s := &luaScript{states: make(chan *lua.LState, n)}
+
+	for i := uint(0); i < n; i++ {
+		L := lua.NewState()
+
+		if err := s.initState(L, path); err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			s.first = L
+		}
+		s.states <- L
+	}
+	s.hasRequest = s.first.GetGlobal("request").Type() == lua.LTFunction
+	s.hasResponse = s.first.GetGlobal("response").Type() == lua.LTFunction
+	s.hasDone = s.first.GetGlobal("done").Type() == lua.LTFunction
+	s.static = readWrkTable(s.first)
+	return s, nil
+}
+
+func (s *luaScript) initState(L *lua.LState, path string) error {
+	wrk := L.NewTable()
+	L.SetField(wrk, "method", lua.LString(http.MethodGet))
+	L.SetField(wrk, "path", lua.LString("/"))
+	L.SetField(wrk, "headers", L.NewTable())
+	L.SetField(wrk, "body", lua.LNil)
+	L.SetField(wrk, "format", L.NewFunction(wrkFormat))
+	L.SetGlobal("wrk", wrk)
+
+	if err := L.DoFile(path); err != nil {
+		return err
+	}
+	if fn := L.GetGlobal("init"); fn.Type() == lua.LTFunction {
+		return L.CallByParam(lua.P{Fn: fn, Protect: true}, L.NewTable())
+	}
+	return nil
+}
+
+func (s *luaScript) setTarget(u *url.URL, method string) {
+	for i := 0; i < cap(s.states); i++ {
+		L := <-s.states
+		wrk := L.GetGlobal("wrk").(*lua.LTable)
+		L.SetField(wrk, "scheme", lua.LString(u.Scheme))
+		L.SetField(wrk, "host", lua.LString(u.Hostname()))
+		L.SetField(wrk, "port", lua.LString(u.Port()))
+
+		if wrk.RawGetString("method").String() == http.MethodGet {
+			L.SetField(wrk, "method", lua.LString(method))
+		}
+		if wrk.RawGetString("path").String() == "/" && u.RequestURI() != "/" {
+			L.SetField(wrk, "path", lua.LString(u.RequestURI()))
+		}
+		s.states <- L
+	}
+	s.static = readWrkTable(s.first)
+}
+
+func (s *luaScript) install(b *bench) {
+	if u, err := url.Parse(b.host); err == nil {
+		s.setTarget(u, b.method)
+	}
+	b.onRequest(s.beforeRequest)
+
+	if s.hasResponse {
+		b.onResponse(s.afterResponse)
+	}
+}
+
+func (s *luaScript) beforeRequest(req *http.Request) {
+	if !s.hasRequest {
+		applyLuaRequest(req, s.static)
+		return
+	}
+	L := <-s.states
+	defer func() { s.states <- L }()
+
+	if err := L.CallByParam(lua.P{Fn: L.GetGlobal("request"), NRet: 1, Protect: true}); err != nil {
+		s.fail(err)
+		return
+	}
+	raw := L.Get(-1).String()
+	L.Pop(1)
+
+	r, err := http.ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+
+	if err != nil {
+		s.fail(err)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	r.Header.Del("Host")
+	applyLuaRequest(req, &luaRequest{
+		method: r.Method,
+		path:   r.RequestURI,
+		header: r.Header,
+		body:   string(body),
+	})
+}
+
+func (s *luaScript) afterResponse(resp *http.Response, err error, delay time.Duration) {
+	if err != nil {
+		return
+	}
+	L := <-s.states
+	defer func() { s.states <- L }()
+
+	headers := L.NewTable()
+
+	for k := range resp.Header {
+		L.SetField(headers, k, lua.LString(resp.Header.Get(k)))
+	}
+	body := hookBody(resp)
+	err = L.CallByParam(
+		lua.P{Fn: L.GetGlobal("response"), Protect: true},
+		lua.LNumber(resp.StatusCode), headers, lua.LString(body),
+	)
+	if err != nil {
+		s.fail(err)
+	}
+}
+
+func (s *luaScript) report(b *bench) string {
+	if s.hasDone {
+		s.done(b)
+	}
+	return fmt.Sprintf("\t\tScript errors: %d\n", atomic.LoadUint32(&s.errors))
+}
+
+func (s *luaScript) done(b *bench) {
+	L := <-s.states
+	defer func() { s.states <- L }()
+
+	// Transport errors after the connection was made count as read errors:
+	// bench does not tell them from write errors, so write is left out.
+	errs := L.NewTable()
+	failed := max(int(b.stats.RequestsFail)-int(b.stats.RequestsTimeout)-int(b.stats.RequestsUnreachable), 0)
+	L.SetField(errs, "connect", lua.LNumber(b.stats.RequestsUnreachable))
+	L.SetField(errs, "read", lua.LNumber(failed))
+	L.SetField(errs, "status", lua.LNumber(b.stats.RequestsTotal-b.stats.RequestsSuccess-b.stats.RequestsFail))
+	L.SetField(errs, "timeout", lua.LNumber(b.stats.RequestsTimeout))
+
+	summary := L.NewTable()
+	L.SetField(summary, "duration", lua.LNumber(b.stats.Runtime.Microseconds()))
+	L.SetField(summary, "requests", lua.LNumber(b.stats.RequestsTotal))
+	L.SetField(summary, "bytes", lua.LNumber(b.stats.BytesWire))
+	L.SetField(summary, "errors", errs)
+
+	rps := []float64{float64(b.stats.RequestsTotal) / b.stats.Runtime.Seconds()}
+
+	err := L.CallByParam(
+		lua.P{Fn: L.GetGlobal("done"), Protect: true},
+		summary, newWrkLatency(L, &b.stats), newWrkStats(L, rps),
+	)
+	if err != nil {
+		s.fail(err)
+	}
+}
+
+func (s *luaScript) fail(err error) {
+	if atomic.AddUint32(&s.errors, 1) == 1 {
+		slog.Warn("script error", "err", err)
+	}
+}
+
+func readWrkTable(L *lua.LState) *luaRequest {
+	wrk := L.GetGlobal("wrk").(*lua.LTable)
+	r := &luaRequest{
+		method: wrk.RawGetString("method").String(),
+		path:   wrk.RawGetString("path").String(),
+		header: make(http.Header),
+	}
+	if body := wrk.RawGetString("body"); body != lua.LNil {
+		r.body = body.String()
+	}
+	if headers, ok := wrk.RawGetString("headers").(*lua.LTable); ok {
+		headers.ForEach(func(k, v lua.LValue) {
+			r.header.Set(k.String(), v.String())
+		})
+	}
+	return r
+}
+
+func applyLuaRequest(req *http.Request, r *luaRequest) {
+	req.Method = r.method
+
+	if u, err := req.URL.Parse(r.path); err == nil {
+		req.URL = u
+	}
+	for k, v := range r.header {
+		if strings.EqualFold(k, "Host") {
+			req.Host = v[0]
+			continue
+		}
+		req.Header[k] = append([]string(nil), v...)
+	}
+	if body := r.body; body != "" {
+		req.Body = io.NopCloser(strings.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader(body)), nil }
+		req.ContentLength = int64(len(body))
+	}
+}
+
+func wrkFormat(L *lua.LState) int {
+	wrk := L.GetGlobal("wrk").(*lua.LTable)
+	method := L.OptString(1, wrk.RawGetString("method").String())
+	path := L.OptString(2, wrk.RawGetString("path").String())
+	headers := L.OptTable(3, L.NewTable())
+	body := L.OptString(4, "")
+
+	if b := wrk.RawGetString("body"); body == "" && L.Get(4) == lua.LNil && b != lua.LNil {
+		body = b.String()
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s HTTP/1.1\r\n", method, path)
+	fmt.Fprintf(&sb, "Host: %s\r\n", wrk.RawGetString("host").String())
+
+	merged := make(map[string]string)
+
+	if defaults, ok := wrk.RawGetString("headers").(*lua.LTable); ok {
+		defaults.ForEach(func(k, v lua.LValue) { merged[k.String()] = v.String() })
+	}
+	headers.ForEach(func(k, v lua.LValue) { merged[k.String()] = v.String() })
+
+	if body != "" {
+		merged["Content-Length"] = fmt.Sprint(len(body))
+	}
+	for k, v := range merged {
+		fmt.Fprintf(&sb, "%s: %s\r\n", k, v)
+	}
+	sb.WriteString("\r\n")
+	sb.WriteString(body)
+	L.Push(lua.LString(sb.String()))
+	return 1
+}
+
+func newWrkStats(L *lua.LState, values []float64) *lua.LTable {
+	sort.Float64s(values)
+	t := L.NewTable()
+	var mean, stdev float64
+
+	for _, v := range values {
+		mean += v
+	}
+	if len(values) > 0 {
+		mean /= float64(len(values))
+		L.SetField(t, "min", lua.LNumber(values[0]))
+		L.SetField(t, "max", lua.LNumber(values[len(values)-1]))
+	}
+	for _, v := range values {
+		stdev += (v - mean) * (v - mean)
+	}
+	if len(values) > 1 {
+		stdev = math.Sqrt(stdev / float64(len(values)-1))
+	}
+	L.SetField(t, "mean", lua.LNumber(mean))
+	L.SetField(t, "stdev", lua.LNumber(stdev))
+	L.SetField(t, "percentile", L.NewFunction(func(L *lua.LState) int {
+		p := float64(L.CheckNumber(2))
+
+		L.Push(lua.LNumber(percentile(values, p)))
+		return 1
+	}))
+	return t
+}
+
+func newWrkLatency(L *lua.LState, s *stats) *lua.LTable {
+	t := L.NewTable()
+	L.SetField(t, "min", lua.LNumber(s.DelayMin.Microseconds()))
+	L.SetField(t, "max", lua.LNumber(s.DelayMax.Microseconds()))
+	L.SetField(t, "mean", lua.LNumber(s.DelayAvg.Microseconds()))
+	L.SetField(t, "stdev", lua.LNumber(s.DelayStddev.Microseconds()))
+	L.SetField(t, "percentile", L.NewFunction(func(L *lua.LState) int {
+		p := float64(L.CheckNumber(2))
+
+		L.Push(lua.LNumber(s.Delays.percentile(p).Microseconds()))
+		return 1
+	}))
+	return t
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const selftestChunk = 64 << 10
+
+var selftestFill = func() []byte {
+	b := make([]byte, selftestChunk)
+
+	for i := range b {
+		b[i] = 'a' + byte(i%26)
+	}
+	return b
+}()
+
+// selftestServer is a target with known behavior: every response waits
+// latency plus up to jitter, fails with status at errorRate and carries size
+// bytes. Query parameters of the same names override the defaults per request.
+type selftestServer struct {
+	latency   time.Duration
+	jitter    time.Duration
+	errorRate float64
+	status    int
+	size      int
+}
+
+func selftestCommand(args []string) error {
+	fs := flag.NewFlagSet("selftest-server", flag.ExitOnError)
+	fs.Usage = func() { usage(fs, "selftest-server [flags]") }
+	listen := fs.String("listen", ":8099", "Address to listen on")
+	s := &selftestServer{}
+	fs.DurationVar(&s.latency, "latency", 0, "Fixed latency added to every response")
+	fs.DurationVar(&s.jitter, "jitter", 0, "Random extra latency, uniformly distributed up to this value")
+	fs.Float64Var(&s.errorRate, "error-rate", 0, "Fraction of responses that fail, 0 to 1")
+	fs.IntVar(&s.status, "error-status", http.StatusInternalServerError, "Status code of failed responses")
+	fs.IntVar(&s.size, "size", 2, "Response body size in bytes")
+	fs.Parse(args)
+
+	if s.errorRate < 0 || s.errorRate > 1 {
+		return errors.New("error-rate must be within [0, 1]")
+	}
+	ln, err := net.Listen("tcp", *listen)
+
+	if err != nil {
+		return err
+	}
+	slog.Info("selftest server listening", "url", fmt.Sprintf("http://%s/", ln.Addr()),
+		"endpoints", "/ (latency, jitter, error-rate, error-status, size), /stream (chunks, interval, size), /echo")
+
+	srv := &http.Server{
+		Handler:           s.mux(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return srv.Serve(ln)
+}
+
+func (s *selftestServer) mux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stream", s.stream)
+	mux.HandleFunc("/echo", s.echo)
+	mux.HandleFunc("/", s.serve)
+	return mux
+}
+
+// options applies the query parameters of r on top of the server defaults.
+func (s *selftestServer) options(r *http.Request) (selftestServer, error) {
+	o := *s
+	q := r.URL.Query()
+	var err error
+
+	for k, v := range q {
+		switch k {
+		case "latency":
+			o.latency, err = time.ParseDuration(v[0])
+		case "jitter":
+			o.jitter, err = time.ParseDuration(v[0])
+		case "error-rate":
+			o.errorRate, err = strconv.ParseFloat(v[0], 64)
+		case "error-status":
+			o.status, err = strconv.Atoi(v[0])
+		case "size":
+			o.size, err = strconv.Atoi(v[0])
+		}
+		if err != nil {
+			return o, fmt.Errorf("invalid %s: %w", k, err)
+		}
+	}
+	return o, nil
+}
+
+func (s *selftestServer) wait() {
+	d := s.latency
+
+	if s.jitter > 0 {
+		d += time.Duration(rand.Int63n(int64(s.jitter)))
+	}
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+func (s *selftestServer) serve(w http.ResponseWriter, r *http.Request) {
+	o, err := s.options(r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	o.wait()
+
+	if o.errorRate > 0 && rand.Float64() < o.errorRate {
+		http.Error(w, http.StatusText(o.status), o.status)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Content-Length", strconv.Itoa(o.size))
+	writeFill(w, o.size)
+}
+
+// stream sends the body in chunks spaced by interval, flushing each one, for
+// exercising TTFB and streaming measurements.
+func (s *selftestServer) stream(w http.ResponseWriter, r *http.Request) {
+	o, err := s.options(r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	chunks, interval := 10, 100*time.Millisecond
+
+	if v := r.URL.Query().Get("chunks"); v != "" {
+		if chunks, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "invalid chunks", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := r.URL.Query().Get("interval"); v != "" {
+		if interval, err = time.ParseDuration(v); err != nil {
+			http.Error(w, "invalid interval", http.StatusBadRequest)
+			return
+		}
+	}
+	o.wait()
+	w.Header().Set("Content-Type", "text/plain")
+	flusher, _ := w.(http.Flusher)
+
+	for i := 0; i < chunks; i++ {
+		if i > 0 {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+		if !writeFill(w, o.size) {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// echo describes the request it received in the layout of httpbin's
+// /anything, for -verify-echo.
+func (s *selftestServer) echo(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newEchoedRequest(r, body))
+}
+
+func writeFill(w http.ResponseWriter, n int) bool {
+	for n > 0 {
+		chunk := min(n, selftestChunk)
+
+		if _, err := w.Write(selftestFill[:chunk]); err != nil {
+			return false
+		}
+		n -= chunk
+	}
+	return true
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+// runSelftest drives a whole run against the selftest server and returns it
+// with its statistics merged, as for the report.
+func runSelftest(t *testing.T, s *selftestServer, query string, args ...string) *bench {
+	t.Helper()
+	srv := httptest.NewServer(s.mux())
+	defer srv.Close()
+
+	b := NewBench()
+
+	if err := b.ParseArgs(append(args, "-h", srv.URL+"/"+query)); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Run(); err != nil {
+		t.Fatal(err)
+	}
+	b.stats.merge()
+	b.mergeDetail()
+	return &b
+}
+
+func TestSelftestCounts(t *testing.T) {
+	b := runSelftest(t, &selftestServer{size: 100}, "", "-n", "200", "-c", "4")
+
+	if b.stats.RequestsTotal != 200 || b.stats.RequestsSuccess != 200 || b.stats.RequestsFail != 0 {
+		t.Fatalf("total %d, success %d, fail %d; want 200, 200, 0",
+			b.stats.RequestsTotal, b.stats.RequestsSuccess, b.stats.RequestsFail)
+	}
+	if n := b.classes.sketches[2].count(); n != 200 {
+		t.Errorf("2xx class has %d requests, want 200", n)
+	}
+}
+
+func TestSelftestStatusClasses(t *testing.T) {
+	s := &selftestServer{status: 500}
+	b := runSelftest(t, s, "?error-rate=1&error-status=503", "-n", "50", "-c", "2")
+
+	if b.stats.RequestsTotal != 50 || b.stats.RequestsSuccess != 0 || b.stats.RequestsFail != 0 {
+		t.Fatalf("total %d, success %d, fail %d; want 50, 0, 0",
+			b.stats.RequestsTotal, b.stats.RequestsSuccess, b.stats.RequestsFail)
+	}
+	for i, name := range statusClassNames {
+		want := uint64(0)
+
+		if name == "5xx" {
+			want = 50
+		}
+		if n := b.classes.sketches[i].count(); n != want {
+			t.Errorf("%s class has %d requests, want %d", name, n, want)
+		}
+	}
+}
+
+func TestSelftestMixedClasses(t *testing.T) {
+	b := runSelftest(t, &selftestServer{status: 404}, "?error-rate=0.5", "-n", "400", "-c", "4")
+
+	ok, miss := b.classes.sketches[2].count(), b.classes.sketches[4].count()
+
+	if ok+miss != 400 || uint64(b.stats.RequestsSuccess) != ok || b.stats.RequestsFail != 0 {
+		t.Fatalf("2xx %d, 4xx %d, success %d, fail %d; want the classes to add up to 400, 2xx to match success and no failures",
+			ok, miss, b.stats.RequestsSuccess, b.stats.RequestsFail)
+	}
+	if ok == 0 || miss == 0 {
+		t.Errorf("2xx %d, 4xx %d; want both classes at an error rate of 0.5", ok, miss)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const ratePoll = 10 * time.Millisecond
+
+// ratePacer spaces requests so the total rate follows rate(elapsed). When
+// workers fall behind the schedule it does not try to catch up with a burst.
+// A schedule with an end stops the run there.
+type ratePacer struct {
+	name  string
+	rate  func(elapsed time.Duration) float64
+	end   time.Duration
+	start time.Time
+
+	mu   sync.Mutex
+	next time.Time
+	late uint64
+	sent []uint32
+	last time.Time
+}
+
+func (p *ratePacer) begin(start time.Time) {
+	p.start, p.next = start, start
+}
+
+func (p *ratePacer) wait(ctx context.Context) bool {
+	_, ok := p.waitAt(ctx)
+	return ok
+}
+
+// waitAt is wait returning the time the send was scheduled at, for unsend.
+// It scans ahead for the next send while the rate is 0, but no further than
+// ratePoll past now, sleeping meanwhile, so that a schedule at 0 for long
+// does not spin.
+func (p *ratePacer) waitAt(ctx context.Context) (time.Time, bool) {
+	p.mu.Lock()
+
+	for {
+		if ctx.Err() != nil || p.end > 0 && p.next.Sub(p.start) >= p.end {
+			p.mu.Unlock()
+			return time.Time{}, false
+		}
+		now := time.Now()
+
+		if p.next.Before(now) {
+			if now.Sub(p.next) > ratePoll {
+				atomic.AddUint64(&p.late, 1)
+			}
+			p.next = now
+		}
+		if r := p.rate(p.next.Sub(p.start)); r > 0 {
+			at := p.next
+			p.next = p.next.Add(time.Duration(float64(time.Second) / r))
+			p.count(at, 1)
+			p.mu.Unlock()
+			return at, sleepCtx(ctx, time.Until(at))
+		}
+		p.next = p.next.Add(ratePoll)
+
+		if ahead := time.Until(p.next); ahead > ratePoll {
+			p.mu.Unlock()
+			ok := sleepCtx(ctx, ahead-ratePoll)
+			p.mu.Lock()
+
+			if !ok {
+				p.mu.Unlock()
+				return time.Time{}, false
+			}
+		}
+	}
+}
+
+// count tallies n requests sent at, by second. Call it with mu held.
+func (p *ratePacer) count(at time.Time, n int) {
+	slot := int(at.Sub(p.start) / time.Second)
+
+	for len(p.sent) <= slot {
+		p.sent = append(p.sent, 0)
+	}
+	if n < 0 && int(p.sent[slot]) < -n {
+		p.sent[slot] = 0
+	} else {
+		p.sent[slot] = uint32(int(p.sent[slot]) + n)
+	}
+	if at.After(p.last) {
+		p.last = at
+	}
+}
+
+// unsend takes back an arrival scheduled at by waitAt but not sent, such as
+// one dropped by the open model.
+func (p *ratePacer) unsend(at time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.count(at, -1)
+}
+
+// calibration tables the requested against the sent rate over at most
+// calibrationRows intervals and returns the share of the requested load
+// that was sent.
+func (p *ratePacer) calibration() (string, float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	length := p.last.Sub(p.start)
+
+	if length < time.Second {
+		return "", 1
+	}
+	step := max(time.Second, (length/calibrationRows + time.Second - 1).Truncate(time.Second))
+	var sb strings.Builder
+	var requested, sent float64
+	sb.WriteString("\t\t  interval   requested/s    sent/s      sent\n")
+
+	for from := time.Duration(0); from < length; from += step {
+		to := min(from+step, length)
+		var want, got float64
+
+		for t := from; t < to; t += ratePoll {
+			want += p.rate(t) * min(ratePoll, to-t).Seconds()
+		}
+		for slot := int(from / time.Second); slot < int((to+time.Second-1)/time.Second) && slot < len(p.sent); slot++ {
+			got += float64(p.sent[slot])
+		}
+		requested += want
+		sent += got
+		secs := (to - from).Seconds()
+		line := fmt.Sprintf("\t\t%9s %13.1f %9.1f", from.String(), want/secs, got/secs)
+
+		if want > 0 {
+			line += fmt.Sprintf(" %8.1f%%", 100*got/want)
+
+			if got < calibrationShortfall*want {
+				line += " <- behind"
+			}
+		}
+		sb.WriteString(line + "\n")
+	}
+	if requested == 0 {
+		return sb.String(), 1
+	}
+	return sb.String(), sent / requested
+}
+
+func (p *ratePacer) report() string {
+	return fmt.Sprintf(`
+		Load shape: %s
+		Requests sent behind schedule: %d
+	`,
+		p.name,
+		atomic.LoadUint64(&p.late),
+	)
+}
+
+func newConstantPacer(rate float64) *ratePacer {
+	return &ratePacer{
+		name: fmt.Sprintf("constant %g/s", rate),
+		rate: func(time.Duration) float64 { return rate },
+	}
+}
+
+func newShapePacer(spec string) (*ratePacer, error) {
+	kind, args, _ := strings.Cut(spec, ":")
+	var (
+		period   time.Duration
+		lo, hi   float64
+		hasRange bool
+	)
+	for _, arg := range strings.Split(args, ",") {
+		if arg == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(arg, "=")
+		var err error
+
+		switch k {
+		case "period":
+			period, err = time.ParseDuration(v)
+		case "min":
+			lo, err = strconv.ParseFloat(v, 64)
+		case "max":
+			hi, err = strconv.ParseFloat(v, 64)
+			hasRange = true
+		default:
+			return nil, fmt.Errorf("invalid shape option %q", k)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid shape option %s: %w", k, err)
+		}
+	}
+	if period <= 0 || !hasRange || hi <= 0 || hi < lo || lo < 0 {
+		return nil, fmt.Errorf("invalid shape %q, expected kind:period=5m,min=100,max=1000", spec)
+	}
+	var wave func(phase float64) float64
+
+	switch kind {
+	case "sine":
+		wave = func(phase float64) float64 { return (1 - math.Cos(2*math.Pi*phase)) / 2 }
+	case "square":
+		wave = func(phase float64) float64 { return math.Floor(2 * phase) }
+	case "sawtooth":
+		wave = func(phase float64) float64 { return phase }
+	default:
+		return nil, fmt.Errorf("unknown shape %q, expected sine, square or sawtooth", kind)
+	}
+	return &ratePacer{
+		name: spec,
+		rate: func(elapsed time.Duration) float64 {
+			phase := math.Mod(elapsed.Seconds(), period.Seconds()) / period.Seconds()
+			return lo + (hi-lo)*wave(phase)
+		},
+	}, nil
+}
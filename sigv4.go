@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+type sigV4 struct {
+	signer  *v4.Signer
+	creds   aws.CredentialsProvider
+	region  string
+	service string
+
+	errors uint32
+}
+
+func newSigV4(spec string) (*sigV4, error) {
+	region, service, ok := strings.Cut(spec, "/")
+
+	if !ok || region == "" || service == "" {
+		return nil, errors.New("expected region/service")
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(region))
+
+	if err != nil {
+		return nil, err
+	}
+	if _, err := cfg.Credentials.Retrieve(context.Background()); err != nil {
+		return nil, err
+	}
+	return &sigV4{
+		signer:  v4.NewSigner(),
+		creds:   cfg.Credentials,
+		region:  region,
+		service: service,
+	}, nil
+}
+
+func (s *sigV4) sign(req *http.Request) {
+	var body []byte
+
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	sum := sha256.Sum256(body)
+	creds, err := s.creds.Retrieve(req.Context())
+
+	if err == nil {
+		err = s.signer.SignHTTP(req.Context(), creds, req, hex.EncodeToString(sum[:]), s.service, s.region, time.Now())
+	}
+	if err != nil && atomic.AddUint32(&s.errors, 1) == 1 {
+		slog.Warn("aws-sigv4 signing failed", "err", err)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	sketchAccuracy = 0.01
+	sketchMin      = 100 * time.Nanosecond
+	sketchMax      = 2 * time.Hour
+)
+
+var (
+	sketchGamma    = (1 + sketchAccuracy) / (1 - sketchAccuracy)
+	sketchLogGamma = math.Log(sketchGamma)
+	sketchBins     = int(math.Ceil(math.Log(float64(sketchMax/sketchMin))/sketchLogGamma)) + 1
+)
+
+// sketch is a DDSketch over a fixed range of bins, so its size doesn't grow
+// with the number of samples. Quantiles are within 1% of the true value
+// between 100ns and 2h; samples outside that range are clamped.
+type sketch struct {
+	bins []uint64
+}
+
+func newSketch() sketch {
+	return sketch{bins: make([]uint64, sketchBins)}
+}
+
+func sketchKey(d time.Duration) int {
+	if d <= sketchMin {
+		return 0
+	}
+	k := int(math.Ceil(math.Log(float64(d)/float64(sketchMin)) / sketchLogGamma))
+	return min(k, sketchBins-1)
+}
+
+func sketchValue(k int) time.Duration {
+	if k == 0 {
+		return sketchMin
+	}
+	return time.Duration(2 * float64(sketchMin) * math.Pow(sketchGamma, float64(k)) / (1 + sketchGamma))
+}
+
+func (s *sketch) add(d time.Duration) {
+	atomic.AddUint64(&s.bins[sketchKey(d)], 1)
+}
+
+func (s *sketch) merge(o *sketch) {
+	for i := range s.bins {
+		s.bins[i] += atomic.LoadUint64(&o.bins[i])
+	}
+}
+
+func (s *sketch) count() uint64 {
+	var n uint64
+
+	for _, c := range s.bins {
+		n += c
+	}
+	return n
+}
+
+func (s *sketch) percentile(p float64) time.Duration {
+	total := s.count()
+
+	if total == 0 {
+		return 0
+	}
+	rank := max(uint64(math.Ceil(p/100*float64(total))), 1)
+	var seen uint64
+
+	for k, c := range s.bins {
+		seen += c
+
+		if seen >= rank {
+			return sketchValue(k)
+		}
+	}
+	return sketchValue(sketchBins - 1)
+}
+
+func (s *sketch) countAbove(d time.Duration) uint64 {
+	var n uint64
+
+	for k := sketchKey(d) + 1; k < len(s.bins); k++ {
+		n += s.bins[k]
+	}
+	return n
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// slowClient trickles every request onto the wire at a fixed byte rate, to see
+// how long the server keeps slow clients around and when it gives up on them.
+type slowClient struct {
+	rate uint
+
+	bytes     uint64
+	dropped   uint32
+	completed uint32
+	longest   int64
+}
+
+func (s *slowClient) wrap(conn net.Conn) net.Conn {
+	return &slowConn{Conn: conn, slow: s}
+}
+
+func (s *slowClient) report() string {
+	return fmt.Sprintf(`
+		Slow client rate: %d B/s
+		Slowly sent bytes: %d
+		Writes sent completely: %d
+		Connections dropped by the server while sending: %d
+		Longest send: %s
+	`,
+		s.rate,
+		atomic.LoadUint64(&s.bytes),
+		atomic.LoadUint32(&s.completed),
+		atomic.LoadUint32(&s.dropped),
+		time.Duration(atomic.LoadInt64(&s.longest)),
+	)
+}
+
+type slowConn struct {
+	net.Conn
+
+	slow *slowClient
+}
+
+// Write sends p in slices of a tenth of a second worth of bytes.
+func (c *slowConn) Write(p []byte) (int, error) {
+	chunk := max(int(c.slow.rate/10), 1)
+	pause := time.Duration(chunk) * time.Second / time.Duration(c.slow.rate)
+	start := time.Now()
+	written := 0
+
+	for written < len(p) {
+		n, err := c.Conn.Write(p[written:min(written+chunk, len(p))])
+		written += n
+		atomic.AddUint64(&c.slow.bytes, uint64(n))
+
+		if err != nil {
+			atomic.AddUint32(&c.slow.dropped, 1)
+			return written, err
+		}
+		if written < len(p) {
+			time.Sleep(pause)
+		}
+	}
+	elapsed := int64(time.Since(start))
+
+	if elapsed > atomic.LoadInt64(&c.slow.longest) {
+		atomic.StoreInt64(&c.slow.longest, elapsed)
+	}
+	atomic.AddUint32(&c.slow.completed, 1)
+	return written, nil
+}
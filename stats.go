@@ -0,0 +1,292 @@
+package main
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+type stats struct {
+	LaunchTime time.Time
+	Runtime    time.Duration
+
+	RequestsPerSecond     uint32
+	RequestsTotal         uint32
+	RequestsSuccess       uint32
+	RequestsFail          uint32
+	RequestsTimeout       uint32
+	RequestsServerTimeout uint32
+	RequestsNoFile        uint32
+	RequestsUnreachable   uint32
+	Retries               uint32
+
+	BytesSent    uint64
+	BytesWire    uint64
+	BytesDecoded uint64
+
+	ConnectionsIPv4 uint32
+	ConnectionsIPv6 uint32
+	ConnectionsOpen int64
+
+	DelayMin    time.Duration
+	DelayAvg    time.Duration
+	DelayMax    time.Duration
+	DelayStddev time.Duration
+	DelayCV     float64
+
+	JitterMin time.Duration
+	JitterAvg time.Duration
+	JitterMax time.Duration
+
+	TTFBMin time.Duration
+	TTFBAvg time.Duration
+	TTFBMax time.Duration
+
+	Delays sketch
+	TTFB   sketch
+
+	shards []*statsShard
+}
+
+// statsShard is written by a single worker. Fields are accessed atomically only
+// so that interim reports can read them while the worker is running.
+type statsShard struct {
+	worker uint
+
+	total         uint32
+	success       uint32
+	fail          uint32
+	timeout       uint32
+	serverTimeout uint32
+	noFile        uint32
+	unreachable   uint32
+	retries       uint32
+
+	bytesSent    uint64
+	bytesWire    uint64
+	bytesDecoded uint64
+
+	delays    uint64
+	delayMin  int64
+	delayMax  int64
+	delaySum  int64
+	delaySq   uint64
+	prevDelay int64
+
+	jitterMin int64
+	jitterMax int64
+	jitterSum int64
+
+	ttfbs   uint64
+	ttfbMin int64
+	ttfbMax int64
+	ttfbSum int64
+
+	sketch     sketch
+	ttfbSketch sketch
+
+	// The detail reports keep their own per worker as well, created on the
+	// first record, and mergeDetail folds them together for the report.
+	classes  *statusClasses
+	failures *failureLatency
+	timeline *timeline
+	warmSum  time.Duration
+	warmN    int
+}
+
+func (s *stats) init(workers uint) {
+	s.shards = make([]*statsShard, workers)
+
+	for i := range s.shards {
+		s.shards[i] = &statsShard{worker: uint(i), sketch: newSketch(), ttfbSketch: newSketch(), classes: newStatusClasses()}
+	}
+}
+
+func (s *stats) shard(worker uint) *statsShard {
+	return s.shards[worker]
+}
+
+func (sh *statsShard) addDelay(delay time.Duration) {
+	d := int64(delay)
+	n := atomic.LoadUint64(&sh.delays)
+
+	if n == 0 || d < atomic.LoadInt64(&sh.delayMin) {
+		atomic.StoreInt64(&sh.delayMin, d)
+	}
+	if d > atomic.LoadInt64(&sh.delayMax) {
+		atomic.StoreInt64(&sh.delayMax, d)
+	}
+	atomic.AddInt64(&sh.delaySum, d)
+	sq := math.Float64frombits(atomic.LoadUint64(&sh.delaySq)) + float64(d)*float64(d)
+	atomic.StoreUint64(&sh.delaySq, math.Float64bits(sq))
+
+	if n > 0 {
+		jitter := d - sh.prevDelay
+
+		if jitter < 0 {
+			jitter = -jitter
+		}
+		if n == 1 || jitter < atomic.LoadInt64(&sh.jitterMin) {
+			atomic.StoreInt64(&sh.jitterMin, jitter)
+		}
+		if jitter > atomic.LoadInt64(&sh.jitterMax) {
+			atomic.StoreInt64(&sh.jitterMax, jitter)
+		}
+		atomic.AddInt64(&sh.jitterSum, jitter)
+	}
+	sh.prevDelay = d
+	sh.sketch.add(delay)
+	atomic.AddUint64(&sh.delays, 1)
+}
+
+func (sh *statsShard) addTTFB(ttfb time.Duration) {
+	d := int64(ttfb)
+
+	if atomic.LoadUint64(&sh.ttfbs) == 0 || d < atomic.LoadInt64(&sh.ttfbMin) {
+		atomic.StoreInt64(&sh.ttfbMin, d)
+	}
+	if d > atomic.LoadInt64(&sh.ttfbMax) {
+		atomic.StoreInt64(&sh.ttfbMax, d)
+	}
+	atomic.AddInt64(&sh.ttfbSum, d)
+	sh.ttfbSketch.add(ttfb)
+	atomic.AddUint64(&sh.ttfbs, 1)
+}
+
+// mergeDetail folds the status classes, failures and timeline of the
+// workers into those of the run, which the reports read.
+func (b *bench) mergeDetail() {
+	b.classes = newStatusClasses()
+
+	if b.failures != nil {
+		b.failures = newFailureLatency()
+	}
+	if b.timeline != nil {
+		b.timeline.mu.Lock()
+		b.timeline.slots = nil
+		b.timeline.mu.Unlock()
+	}
+	for _, sh := range b.stats.shards {
+		b.classes.merge(sh.classes)
+
+		if sh.failures != nil && b.failures != nil {
+			b.failures.merge(sh.failures)
+		}
+		if sh.timeline != nil && b.timeline != nil {
+			b.timeline.merge(sh.timeline)
+		}
+	}
+}
+
+func (s *stats) merge() {
+	s.RequestsTotal, s.RequestsSuccess, s.RequestsFail, s.RequestsTimeout, s.RequestsNoFile, s.Retries = 0, 0, 0, 0, 0, 0
+	s.RequestsServerTimeout, s.RequestsUnreachable = 0, 0
+	s.BytesSent, s.BytesWire, s.BytesDecoded = 0, 0, 0
+	s.Delays = newSketch()
+	s.TTFB = newSketch()
+	s.mergeTTFB()
+
+	var (
+		delays, jitters uint64
+		sum, jitterSum  int64
+		sq              float64
+		first           = true
+	)
+	for _, sh := range s.shards {
+		s.RequestsTotal += atomic.LoadUint32(&sh.total)
+		s.RequestsSuccess += atomic.LoadUint32(&sh.success)
+		s.RequestsFail += atomic.LoadUint32(&sh.fail)
+		s.RequestsTimeout += atomic.LoadUint32(&sh.timeout)
+		s.RequestsServerTimeout += atomic.LoadUint32(&sh.serverTimeout)
+		s.RequestsNoFile += atomic.LoadUint32(&sh.noFile)
+		s.RequestsUnreachable += atomic.LoadUint32(&sh.unreachable)
+		s.Retries += atomic.LoadUint32(&sh.retries)
+		s.BytesSent += atomic.LoadUint64(&sh.bytesSent)
+		s.BytesWire += atomic.LoadUint64(&sh.bytesWire)
+		s.BytesDecoded += atomic.LoadUint64(&sh.bytesDecoded)
+		s.Delays.merge(&sh.sketch)
+
+		n := atomic.LoadUint64(&sh.delays)
+
+		if n == 0 {
+			continue
+		}
+		lo, hi := time.Duration(atomic.LoadInt64(&sh.delayMin)), time.Duration(atomic.LoadInt64(&sh.delayMax))
+		jmin, jmax := time.Duration(atomic.LoadInt64(&sh.jitterMin)), time.Duration(atomic.LoadInt64(&sh.jitterMax))
+
+		if first || lo < s.DelayMin {
+			s.DelayMin = lo
+		}
+		if first || hi > s.DelayMax {
+			s.DelayMax = hi
+		}
+		if n > 1 {
+			if jitters == 0 || jmin < s.JitterMin {
+				s.JitterMin = jmin
+			}
+			if jmax > s.JitterMax {
+				s.JitterMax = jmax
+			}
+			jitters += n - 1
+		}
+		first = false
+		delays += n
+		sum += atomic.LoadInt64(&sh.delaySum)
+		sq += math.Float64frombits(atomic.LoadUint64(&sh.delaySq))
+		jitterSum += atomic.LoadInt64(&sh.jitterSum)
+	}
+	if delays == 0 {
+		return
+	}
+	mean := float64(sum) / float64(delays)
+	variance := sq/float64(delays) - mean*mean
+
+	s.DelayAvg = time.Duration(mean)
+	s.DelayStddev = time.Duration(math.Sqrt(max(variance, 0)))
+
+	if mean > 0 {
+		s.DelayCV = float64(s.DelayStddev) / mean
+	}
+	if jitters > 0 {
+		s.JitterAvg = time.Duration(jitterSum / int64(jitters))
+	}
+}
+
+func (s *stats) mergeTTFB() {
+	var (
+		n   uint64
+		sum int64
+	)
+	for _, sh := range s.shards {
+		s.TTFB.merge(&sh.ttfbSketch)
+		c := atomic.LoadUint64(&sh.ttfbs)
+
+		if c == 0 {
+			continue
+		}
+		lo, hi := time.Duration(atomic.LoadInt64(&sh.ttfbMin)), time.Duration(atomic.LoadInt64(&sh.ttfbMax))
+
+		if n == 0 || lo < s.TTFBMin {
+			s.TTFBMin = lo
+		}
+		if hi > s.TTFBMax {
+			s.TTFBMax = hi
+		}
+		n += c
+		sum += atomic.LoadInt64(&sh.ttfbSum)
+	}
+	if n > 0 {
+		s.TTFBAvg = time.Duration(sum / int64(n))
+	}
+}
+
+func (s *stats) snapshot() (total uint32, delays, ttfb sketch) {
+	delays, ttfb = newSketch(), newSketch()
+
+	for _, sh := range s.shards {
+		total += atomic.LoadUint32(&sh.total)
+		delays.merge(&sh.sketch)
+		ttfb.merge(&sh.ttfbSketch)
+	}
+	return total, delays, ttfb
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var statusClassNames = [...]string{"error", "1xx", "2xx", "3xx", "4xx", "5xx"}
+
+// statusClasses keeps a latency sketch per status class, so that fast errors
+// don't hide in the aggregate percentiles.
+type statusClasses struct {
+	sketches [len(statusClassNames)]sketch
+}
+
+func newStatusClasses() *statusClasses {
+	c := &statusClasses{}
+
+	for i := range c.sketches {
+		c.sketches[i] = newSketch()
+	}
+	return c
+}
+
+func (c *statusClasses) add(status int, err error, delay time.Duration) {
+	i := 0
+
+	if err == nil && status >= 100 && status < 600 {
+		i = status / 100
+	}
+	c.sketches[i].add(delay)
+}
+
+func (c *statusClasses) merge(o *statusClasses) {
+	for i := range c.sketches {
+		c.sketches[i].merge(&o.sketches[i])
+	}
+}
+
+// report is empty unless responses fell into more than one class.
+func (c *statusClasses) report() string {
+	var sb strings.Builder
+	classes := 0
+
+	for i := range c.sketches {
+		s := &c.sketches[i]
+		n := s.count()
+
+		if n == 0 {
+			continue
+		}
+		classes++
+		fmt.Fprintf(&sb, "\t\t%-5s %8d %10s %10s %10s %10s\n", statusClassNames[i], n,
+			formatLatency(s.percentile(50)), formatLatency(s.percentile(90)), formatLatency(s.percentile(99)),
+			formatLatency(s.percentile(100)))
+	}
+	if classes < 2 {
+		return ""
+	}
+	return fmt.Sprintf("\n\t\tLatency by status class:\n\t\t%-5s %8s %10s %10s %10s %10s\n%s",
+		"class", "n", "p50", "p90", "p99", "max", sb.String())
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// streamStats keeps the time to first byte of streamed responses and the time
+// each took per MiB of its body, as a sketch of constant size; the throughput
+// of a response is the inverse of the latter.
+type streamStats struct {
+	ttfb   latencyStats
+	perMiB sketch
+}
+
+func newStreamStats() *streamStats {
+	return &streamStats{perMiB: newSketch()}
+}
+
+func (s *streamStats) add(start, first, end time.Time, n int64) {
+	if n == 0 {
+		return
+	}
+	s.ttfb.add(first.Sub(start))
+
+	const mib = 1 << 20
+
+	if d := end.Sub(first); d > 0 {
+		s.perMiB.add(time.Duration(float64(d) * mib / float64(n)))
+	}
+}
+
+// throughput is the pth percentile of the throughput per response in MiB/s,
+// the 100-pth one of the time per MiB.
+func (s *streamStats) throughput(p float64) float64 {
+	d := s.perMiB.percentile(100 - p)
+
+	if d == 0 {
+		return 0
+	}
+	return float64(time.Second) / float64(d)
+}
+
+func (s *streamStats) report() string {
+	return fmt.Sprintf(`
+		Time to first byte: %s
+		Throughput per response, MiB/s: min=%.2f p50=%.2f p90=%.2f p99=%.2f max=%.2f
+	`,
+		&s.ttfb,
+		s.throughput(0),
+		s.throughput(50),
+		s.throughput(90),
+		s.throughput(99),
+		s.throughput(100),
+	)
+}
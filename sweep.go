@@ -0,0 +1,229 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const sweepPause = 2 * time.Second
+
+// sweep reruns the command line once per value of a single run flag, through
+// the matrix, and tables the results against that value.
+type sweep struct {
+	param matrixParam
+	args  []string
+	table func([]matrixRun) string
+}
+
+func (s *sweep) run() error {
+	runs, err := runMatrix(matrixParams{s.param}, sweepPause, s.args)
+
+	if err != nil {
+		return err
+	}
+	fmt.Print(s.table(runs))
+	return matrixErr(runs)
+}
+
+func newBodySizeSweep(spec string, args []string, fs *flag.FlagSet) (*sweep, error) {
+	if rest, found := cutFlag(args, fs, "upload-size", "upload-file", "d", "data"); found {
+		return nil, errors.New("body-size-sweep generates the bodies and cannot be combined with -d or uploads")
+	} else {
+		args = rest
+	}
+	var sizes []string
+
+	for _, part := range strings.Split(spec, ",") {
+		n, err := parseByteSize(part)
+
+		if err != nil {
+			return nil, fmt.Errorf("body-size-sweep: %w", err)
+		}
+		if n == 0 {
+			return nil, errors.New("body-size-sweep: sizes must be positive")
+		}
+		sizes = append(sizes, strconv.FormatInt(n, 10))
+	}
+	args, _ = cutFlag(args, fs, "body-size-sweep", "o", "output", "summary-only")
+
+	return &sweep{
+		param: matrixParam{flag: "upload-size", values: sizes},
+		args:  args,
+		table: bodySizeTable,
+	}, nil
+}
+
+// bodySizeTable marks the sizes where p99 at least doubled from the size
+// before, the cliffs that point at buffer, serialization or MTU limits.
+func bodySizeTable(runs []matrixRun) string {
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Body size\tRequests\tRPS\tSent MB/s\tErrors\tP50\tP99\tP99 vs previous")
+	var prev time.Duration
+
+	for _, run := range runs {
+		size, _ := strconv.ParseInt(run.values[0], 10, 64)
+		fmt.Fprintf(w, "%s\t", formatBytes(size))
+		r := run.result
+
+		if r == nil {
+			fmt.Fprintf(w, "failed: %s\n", run.err)
+			prev = 0
+			continue
+		}
+		change := "-"
+
+		if prev > 0 {
+			change = fmt.Sprintf("%+.1f%%", 100*float64(r.Latency.P99Ns-prev)/float64(prev))
+
+			if r.Latency.P99Ns >= 2*prev {
+				change += " <- cliff"
+			}
+		}
+		prev = r.Latency.P99Ns
+		fmt.Fprintf(w, "%d\t%.1f\t%.2f\t%.2f%%\t%s\t%s\t%s\n", r.Requests.Total, r.RPS,
+			r.RPS*float64(size)/(1<<20), r.errorRate(), formatLatency(r.Latency.P50Ns), formatLatency(r.Latency.P99Ns), change)
+	}
+	w.Flush()
+	return sb.String()
+}
+
+// expandLevels expands a list such as 1,2,4,...,512, continuing the ratio of
+// the two values before the ellipsis up to the value after it.
+func expandLevels(spec string) ([]uint64, error) {
+	parts := strings.Split(spec, ",")
+	var levels []uint64
+
+	for i, part := range parts {
+		if part == "..." {
+			if len(levels) < 2 || i+1 != len(parts)-1 {
+				return nil, fmt.Errorf("invalid %q: ... needs two values before it and one after", spec)
+			}
+			a, b := levels[len(levels)-2], levels[len(levels)-1]
+
+			if b <= a {
+				return nil, fmt.Errorf("invalid %q: values before ... must increase", spec)
+			}
+			end, err := strconv.ParseUint(parts[i+1], 10, 64)
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid level %q", parts[i+1])
+			}
+			for next := b; ; {
+				if b%a == 0 {
+					next *= b / a
+				} else {
+					next += b - a
+				}
+				if next >= end {
+					break
+				}
+				levels = append(levels, next)
+			}
+			continue
+		}
+		n, err := strconv.ParseUint(part, 10, 64)
+
+		if err != nil || n == 0 {
+			return nil, fmt.Errorf("invalid level %q, expected a positive number", part)
+		}
+		levels = append(levels, n)
+	}
+	return levels, nil
+}
+
+func newConcurrencySweep(spec string, args []string, fs *flag.FlagSet) (*sweep, error) {
+	levels, err := expandLevels(spec)
+
+	if err != nil {
+		return nil, fmt.Errorf("concurrency-sweep: %w", err)
+	}
+	values := make([]string, len(levels))
+
+	for i, c := range levels {
+		values[i] = strconv.FormatUint(c, 10)
+	}
+	args, _ = cutFlag(args, fs, "concurrency-sweep", "c", "concurrency", "o", "output", "summary-only")
+
+	return &sweep{
+		param: matrixParam{flag: "c", values: values},
+		args:  args,
+		table: concurrencyTable,
+	}, nil
+}
+
+// kneeGain is the share of linear scaling below which added concurrency is
+// considered not to raise throughput anymore.
+const kneeGain = 0.1
+
+// knee returns the index of the last level before throughput stopped
+// scaling, or -1 when it scaled all the way.
+func knee(levels []float64, runs []matrixRun) int {
+	for i := 1; i < len(runs); i++ {
+		prev, cur := runs[i-1].result, runs[i].result
+
+		if prev == nil || cur == nil || prev.RPS == 0 {
+			continue
+		}
+		gain := (cur.RPS - prev.RPS) / prev.RPS
+		linear := (levels[i] - levels[i-1]) / levels[i-1]
+
+		if gain < kneeGain*linear {
+			return i - 1
+		}
+	}
+	return -1
+}
+
+func concurrencyTable(runs []matrixRun) string {
+	levels := make([]float64, len(runs))
+	var maxRPS, maxP99 float64
+
+	for i, run := range runs {
+		levels[i], _ = strconv.ParseFloat(run.values[0], 64)
+
+		if r := run.result; r != nil {
+			maxRPS = max(maxRPS, r.RPS)
+			maxP99 = max(maxP99, float64(r.Latency.P99Ns))
+		}
+	}
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Concurrency\tRPS\t\tP99\t\tErrors")
+
+	for _, run := range runs {
+		r := run.result
+
+		if r == nil {
+			fmt.Fprintf(w, "%s\tfailed: %s\n", run.values[0], run.err)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%.1f\t%s\t%s\t%s\t%.2f%%\n", run.values[0], r.RPS, bar(r.RPS, maxRPS),
+			formatLatency(r.Latency.P99Ns), bar(float64(r.Latency.P99Ns), maxP99), r.errorRate())
+	}
+	w.Flush()
+
+	if k := knee(levels, runs); k >= 0 {
+		r := runs[k].result
+		fmt.Fprintf(&sb, "\nThroughput stops scaling at concurrency %s: %.1f requests per second at p99 %s\n",
+			runs[k].values[0], r.RPS, formatLatency(r.Latency.P99Ns))
+	} else {
+		sb.WriteString("\nThroughput kept scaling up to the highest concurrency\n")
+	}
+	return sb.String()
+}
+
+const barWidth = 30
+
+func bar(v, full float64) string {
+	if full <= 0 {
+		return ""
+	}
+	return strings.Repeat("#", int(math.Round(v/full*barWidth)))
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+// headerTemplates renders header values containing {{...}} on every request,
+// e.g. -H "X-Request-ID: {{uuid}}".
+type headerTemplates struct {
+	keys  map[string][]*template.Template
+	seq   uint64
+	funcs template.FuncMap
+}
+
+func newHeaderTemplates(h http.Header) (*headerTemplates, error) {
+	t := &headerTemplates{keys: make(map[string][]*template.Template)}
+	t.funcs = template.FuncMap{
+		"uuid":    newUUID,
+		"seq":     func() uint64 { return atomic.AddUint64(&t.seq, 1) },
+		"now":     func() string { return time.Now().UTC().Format(time.RFC3339Nano) },
+		"unix":    func() int64 { return time.Now().Unix() },
+		"unixms":  func() int64 { return time.Now().UnixMilli() },
+		"randInt": randInt,
+		"randHex": randHex,
+	}
+	for k, values := range h {
+		if !hasTemplate(values) {
+			continue
+		}
+		for _, v := range values {
+			tmpl, err := template.New(k).Funcs(t.funcs).Parse(v)
+
+			if err == nil {
+				err = tmpl.Execute(io.Discard, nil)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("header %s: %w", k, err)
+			}
+			t.keys[k] = append(t.keys[k], tmpl)
+		}
+	}
+	if len(t.keys) == 0 {
+		return nil, nil
+	}
+	t.seq = 0
+	return t, nil
+}
+
+func hasTemplate(values []string) bool {
+	for _, v := range values {
+		if strings.Contains(v, "{{") {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *headerTemplates) render(req *http.Request) {
+	var sb strings.Builder
+
+	for k, tmpls := range t.keys {
+		values := make([]string, len(tmpls))
+
+		for i, tmpl := range tmpls {
+			sb.Reset()
+			tmpl.Execute(&sb, nil)
+			values[i] = sb.String()
+		}
+		req.Header[k] = values
+	}
+}
+
+func newUUID() string {
+	var u [16]byte
+	rand.Read(u[:])
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
+
+func randInt(n int64) (string, error) {
+	if n <= 0 {
+		return "", fmt.Errorf("randInt: %d is not positive", n)
+	}
+	v, err := rand.Int(rand.Reader, big.NewInt(n))
+
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(v.Int64(), 10), nil
+}
+
+func randHex(n int) (string, error) {
+	if n <= 0 {
+		return "", fmt.Errorf("randHex: %d is not positive", n)
+	}
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	timelineSlot    = time.Second
+	timelineMin     = 10 * time.Microsecond
+	timelineGrowth  = 1.1
+	timelineBuckets = 170
+)
+
+// timeline keeps a coarse latency histogram for every second of the run so
+// the report can look at how latency changed over time.
+type timeline struct {
+	start time.Time
+
+	mu    sync.Mutex
+	slots [][timelineBuckets]uint32
+}
+
+func timelineBucket(d time.Duration) int {
+	if d <= timelineMin {
+		return 0
+	}
+	k := int(math.Ceil(math.Log(float64(d)/float64(timelineMin)) / math.Log(timelineGrowth)))
+	return min(k, timelineBuckets-1)
+}
+
+func timelineValue(k int) time.Duration {
+	return time.Duration(float64(timelineMin) * math.Pow(timelineGrowth, float64(k)))
+}
+
+func (t *timeline) add(at time.Time, d time.Duration) {
+	slot := int(at.Sub(t.start) / timelineSlot)
+
+	if slot < 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for len(t.slots) <= slot {
+		t.slots = append(t.slots, [timelineBuckets]uint32{})
+	}
+	t.slots[slot][timelineBucket(d)]++
+}
+
+func (t *timeline) merge(o *timeline) {
+	slots := o.snapshot()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for len(t.slots) < len(slots) {
+		t.slots = append(t.slots, [timelineBuckets]uint32{})
+	}
+	for i := range slots {
+		for k, c := range slots[i] {
+			t.slots[i][k] += c
+		}
+	}
+}
+
+func (t *timeline) snapshot() [][timelineBuckets]uint32 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([][timelineBuckets]uint32(nil), t.slots...)
+}
+
+func slotCount(slot *[timelineBuckets]uint32) uint64 {
+	var n uint64
+
+	for _, c := range slot {
+		n += uint64(c)
+	}
+	return n
+}
+
+func slotPercentile(slot *[timelineBuckets]uint32, p float64) time.Duration {
+	total := slotCount(slot)
+
+	if total == 0 {
+		return 0
+	}
+	rank := max(uint64(math.Ceil(p/100*float64(total))), 1)
+	var seen uint64
+
+	for k, c := range slot {
+		seen += uint64(c)
+
+		if seen >= rank {
+			return timelineValue(k)
+		}
+	}
+	return timelineValue(timelineBuckets - 1)
+}
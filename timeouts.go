@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// clientTimeout reports whether err is bench giving up on the request, as
+// opposed to the server answering that it timed out.
+func clientTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+func serverTimeout(status int) bool {
+	return status == http.StatusGatewayTimeout || status == http.StatusRequestTimeout
+}
+
+// timeoutStats splits timeouts by the side that enforced them.
+type timeoutStats struct {
+	client latencyStats
+	server latencyStats
+}
+
+func (t *timeoutStats) add(status int, err error, delay time.Duration) {
+	switch {
+	case err != nil && clientTimeout(err):
+		t.client.add(delay)
+	case err == nil && serverTimeout(status):
+		t.server.add(delay)
+	}
+}
+
+func (t *timeoutStats) report() string {
+	return fmt.Sprintf(`
+		Client timeouts (deadline exceeded): %s
+		Server timeouts (408/504): %s
+	`,
+		&t.client,
+		&t.server,
+	)
+}
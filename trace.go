@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+)
+
+type requestTrace struct {
+	wroteHeaders time.Time
+	got100       time.Time
+	conn         net.Conn
+
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+}
+
+func (b *bench) tracing() bool {
+	return b.expectContinue != nil || b.perConn != nil || b.segments != nil || b.phases != nil
+}
+
+func (t *requestTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.conn = info.Conn
+		},
+		WroteHeaders: func() {
+			t.wroteHeaders = time.Now()
+		},
+		Got100Continue: func() {
+			t.got100 = time.Now()
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.dnsDone = time.Now()
+		},
+		ConnectStart: func(string, string) {
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(string, string, error) {
+			t.connectDone = time.Now()
+		},
+		TLSHandshakeStart: func() {
+			t.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.tlsDone = time.Now()
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.wroteRequest = time.Now()
+		},
+		GotFirstResponseByte: func() {
+			t.firstByte = time.Now()
+		},
+	}
+}
+
+func (b *bench) recordTrace(t *requestTrace) {
+	if b.expectContinue != nil {
+		b.expectContinue.add(t)
+	}
+}
+
+func (b *bench) recordSplit(t *requestTrace, resp *http.Response, err error, delay time.Duration) {
+	if b.perConn != nil && t.conn != nil {
+		b.perConn.add(t.conn.LocalAddr().String(), err, delay)
+	}
+	if b.segments != nil {
+		b.segments.add(resp, t.conn, err, delay)
+	}
+	if b.phases != nil && err == nil {
+		b.phases.add(t, delay)
+	}
+}
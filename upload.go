@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type upload struct {
+	size    int64
+	file    string
+	chunked bool
+
+	mu         sync.Mutex
+	throughput []float64
+}
+
+type uploadBody struct {
+	r    io.Reader
+	c    io.Closer
+	n    int64
+	done time.Time
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func newUpload(size int64, file string, chunked bool) (*upload, error) {
+	if file != "" {
+		info, err := os.Stat(file)
+
+		if err != nil {
+			return nil, err
+		}
+		size = info.Size()
+	} else if size <= 0 {
+		return nil, errors.New("upload size must be positive")
+	}
+	return &upload{size: size, file: file, chunked: chunked}, nil
+}
+
+func (u *upload) body() (*uploadBody, int64, error) {
+	length := u.size
+
+	if u.chunked {
+		length = 0
+	}
+	if u.file == "" {
+		return &uploadBody{r: io.LimitReader(zeroReader{}, u.size)}, length, nil
+	}
+	f, err := os.Open(u.file)
+
+	if err != nil {
+		return nil, 0, err
+	}
+	return &uploadBody{r: f, c: f}, length, nil
+}
+
+func (b *uploadBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.n += int64(n)
+
+	if err == io.EOF {
+		b.done = time.Now()
+	}
+	return n, err
+}
+
+func (b *uploadBody) Close() error {
+	if b.c != nil {
+		return b.c.Close()
+	}
+	return nil
+}
+
+func (u *upload) add(start time.Time, body *uploadBody, sent *uint64) {
+	atomic.AddUint64(sent, uint64(body.n))
+
+	if body.done.IsZero() {
+		return
+	}
+	if d := body.done.Sub(start); d > 0 {
+		u.mu.Lock()
+		u.throughput = append(u.throughput, float64(body.n)/d.Seconds())
+		u.mu.Unlock()
+	}
+}
+
+func (u *upload) report() string {
+	u.mu.Lock()
+	tp := append([]float64(nil), u.throughput...)
+	u.mu.Unlock()
+	sort.Float64s(tp)
+
+	const mib = 1 << 20
+
+	return fmt.Sprintf(`
+		Uploads completed: %d of %d bytes (chunked: %t)
+		Upload throughput, MiB/s: min=%.2f p50=%.2f p90=%.2f p99=%.2f max=%.2f
+	`,
+		len(tp),
+		u.size,
+		u.chunked,
+		percentile(tp, 0)/mib,
+		percentile(tp, 50)/mib,
+		percentile(tp, 90)/mib,
+		percentile(tp, 99)/mib,
+		percentile(tp, 100)/mib,
+	)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+var uaProfiles = map[string]http.Header{
+	"chrome": {
+		"User-Agent":      {"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36"},
+		"Accept":          {"text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8"},
+		"Accept-Language": {"en-US,en;q=0.9"},
+	},
+	"mobile": {
+		"User-Agent":      {"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1"},
+		"Accept":          {"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+		"Accept-Language": {"en-US,en;q=0.9"},
+	},
+	"bot": {
+		"User-Agent": {"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"},
+		"Accept":     {"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+	},
+}
+
+// userAgents emulates clients by their User-Agent and the headers that usually
+// come with it. Headers given explicitly with -H are never replaced.
+type userAgents struct {
+	profiles []http.Header
+	agents   []string
+	fixed    http.Header
+	seq      uint64
+}
+
+func newUserAgents(profiles, agent, file string) (*userAgents, error) {
+	u := &userAgents{}
+
+	if profiles != "" {
+		for _, name := range strings.Split(profiles, ",") {
+			p, ok := uaProfiles[strings.TrimSpace(name)]
+
+			if !ok {
+				return nil, fmt.Errorf("unknown ua-profile %q, expected %s", name, strings.Join(uaProfileNames(), ", "))
+			}
+			u.profiles = append(u.profiles, p)
+		}
+	}
+	switch {
+	case agent != "" && file != "":
+		return nil, errors.New("only one of -user-agent and -user-agent-file can be used")
+	case agent != "":
+		u.agents = []string{agent}
+	case file != "":
+		data, err := os.ReadFile(file)
+
+		if err != nil {
+			return nil, fmt.Errorf("user-agent-file: %w", err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				u.agents = append(u.agents, line)
+			}
+		}
+		if len(u.agents) == 0 {
+			return nil, fmt.Errorf("user-agent-file %s has no user agents", file)
+		}
+	}
+	if len(u.profiles) == 0 && len(u.agents) == 0 {
+		return nil, nil
+	}
+	return u, nil
+}
+
+func uaProfileNames() []string {
+	names := make([]string, 0, len(uaProfiles))
+
+	for name := range uaProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// install sets the headers once when there is nothing to rotate, so that any
+// engine can send them, and registers a rotating hook otherwise.
+func (u *userAgents) install(b *bench) {
+	if b.header == nil {
+		b.header = make(http.Header)
+	}
+	u.fixed = b.header.Clone()
+
+	if len(u.profiles) <= 1 && len(u.agents) <= 1 {
+		u.set(b.header, 0)
+		return
+	}
+	b.onRequest(func(req *http.Request) {
+		u.set(req.Header, atomic.AddUint64(&u.seq, 1)-1)
+	})
+}
+
+func (u *userAgents) set(h http.Header, i uint64) {
+	if len(u.profiles) > 0 {
+		for k, v := range u.profiles[i%uint64(len(u.profiles))] {
+			if _, ok := u.fixed[k]; !ok {
+				h[k] = v
+			}
+		}
+	}
+	if _, ok := u.fixed["User-Agent"]; len(u.agents) > 0 && !ok {
+		h.Set("User-Agent", u.agents[i%uint64(len(u.agents))])
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// flagRequires lists the flags that only take effect along with one of
+// others. Given alone they do nothing, which is usually a typo in the other.
+var flagRequires = map[string][]string{
+	"h2-conns":          {"h2"},
+	"h2-max-streams":    {"h2"},
+	"h2-max-frame-size": {"h2"},
+	"ready-url":         {"wait-ready"},
+	"ready-status":      {"wait-ready"},
+	"chunked":           {"upload-size", "upload-file", "body-size-sweep"},
+	"profile-scale":     {"profile"},
+	"client-id":         {"oauth2-token-url"},
+	"client-secret":     {"oauth2-token-url"},
+	"scope":             {"oauth2-token-url"},
+	"k8s-image":         {"k8s-workers"},
+	"k8s-namespace":     {"k8s-workers"},
+	"k8s-api":           {"k8s-workers"},
+	"k8s-timeout":       {"k8s-workers"},
+	"k8s-heartbeat":     {"k8s-workers"},
+}
+
+// validate rejects flag combinations that would not run the load asked for,
+// saying what to change, once the flags have taken effect.
+func (b *bench) validate(fs *flag.FlagSet, rate float64) error {
+	set := make(map[string]bool)
+
+	fs.Visit(func(f *flag.Flag) {
+		if short, ok := longFlags[f.Name]; ok {
+			set[short] = true
+		} else {
+			set[f.Name] = true
+		}
+	})
+	names := make([]string, 0, len(flagRequires))
+
+	for name := range flagRequires {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if need := flagRequires[name]; set[name] && !slices.ContainsFunc(need, func(n string) bool { return set[n] }) {
+			return fmt.Errorf("%s requires -%s", name, strings.Join(need, " or -"))
+		}
+	}
+	if b.requests == 0 {
+		return errors.New("requests must be at least 1, set -n; to run for a time instead, set --duration")
+	}
+	if !b.open && b.scenarios == nil && b.concurrency > b.requests {
+		return fmt.Errorf("-c %d is more than the %d requests of -n, so %d workers would send nothing; lower -c or raise -n",
+			b.concurrency, b.requests, b.concurrency-b.requests)
+	}
+	for _, sc := range b.scenarios {
+		c, n := b.concurrency, b.requests
+
+		if sc.Concurrency > 0 {
+			c = sc.Concurrency
+		}
+		if sc.Requests > 0 {
+			n = sc.Requests
+		}
+		if !b.open && c > n {
+			return fmt.Errorf("scenario %q: concurrency %d is more than its %d requests; lower its concurrency or raise its requests", sc.Name, c, n)
+		}
+		if b.open && sc.Rate <= 0 && sc.Shape == "" && sc.Burst == "" {
+			return fmt.Errorf("scenario %q: the open model needs an arrival rate; set its rate, shape or burst", sc.Name)
+		}
+	}
+	if b.data != nil && b.method == http.MethodGet && !set["m"] && b.mix == nil {
+		return errors.New("-d sends a body, which GET requests do not carry; set -m POST, or -m GET to send it anyway")
+	}
+	if secs := float64(b.requests) / rate; rate > 0 && b.maxDuration == 0 && secs > time.Hour.Seconds() {
+		slog.Warn("at this rate the run takes long; bound it with -max-duration or lower -n",
+			"rate", rate, "requests", b.requests, "takes", (time.Duration(secs) * time.Second).String())
+	}
+	return nil
+}
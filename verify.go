@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"sync/atomic"
+)
+
+var errHashMismatch = errors.New("response body hash mismatch")
+
+type hashVerifier struct {
+	newHash func() hash.Hash
+
+	first    bool
+	expected atomic.Pointer[[]byte]
+
+	mismatches uint32
+}
+
+func newHashVerifier(spec string) (*hashVerifier, error) {
+	alg, want, ok := strings.Cut(spec, ":")
+
+	if !ok {
+		alg, want = "sha256", spec
+	}
+	v := &hashVerifier{}
+
+	switch alg {
+	case "md5":
+		v.newHash = md5.New
+	case "sha1":
+		v.newHash = sha1.New
+	case "sha256":
+		v.newHash = sha256.New
+	case "sha512":
+		v.newHash = sha512.New
+	default:
+		return nil, fmt.Errorf("unsupported hash %q", alg)
+	}
+	if want == "first" {
+		v.first = true
+		return v, nil
+	}
+	expected, err := hex.DecodeString(want)
+
+	if err != nil || len(expected) != v.newHash().Size() {
+		return nil, fmt.Errorf("invalid %s digest %q", alg, want)
+	}
+	v.expected.Store(&expected)
+	return v, nil
+}
+
+// copy hashes the body of a response with status and compares it with the
+// expected digest. With first, that is the digest of the first 2xx response,
+// and only 2xx responses are checked against it.
+func (v *hashVerifier) copy(r io.Reader, status int) (int64, error) {
+	h := v.newHash()
+	n, err := io.Copy(h, r)
+
+	if err != nil {
+		return n, err
+	}
+	if v.first && (status < 200 || status >= 300) {
+		return n, nil
+	}
+	sum := h.Sum(nil)
+
+	if v.first {
+		v.expected.CompareAndSwap(nil, &sum)
+	}
+	expected := v.expected.Load()
+
+	if !bytes.Equal(sum, *expected) {
+		atomic.AddUint32(&v.mismatches, 1)
+		return n, errHashMismatch
+	}
+	return n, nil
+}
+
+func (v *hashVerifier) report() string {
+	var expected []byte
+
+	if p := v.expected.Load(); p != nil {
+		expected = *p
+	}
+	return fmt.Sprintf(`
+		Expected body hash: %x
+		Hash mismatches: %d
+	`,
+		expected,
+		atomic.LoadUint32(&v.mismatches),
+	)
+}
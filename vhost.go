@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// vhostRotator spreads requests round-robin over a list of virtual hosts sent
+// in the Host header and, with sni, as the TLS server name.
+type vhostRotator struct {
+	hosts []string
+	sni   bool
+	seq   uint64
+	stats *keyedStats
+}
+
+func newVhostRotator(list string, sni bool) (*vhostRotator, error) {
+	v := &vhostRotator{sni: sni, stats: newKeyedStats()}
+
+	for _, h := range strings.Split(list, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			v.hosts = append(v.hosts, h)
+		}
+	}
+	if len(v.hosts) == 0 {
+		return nil, errors.New("vhosts: empty host list")
+	}
+	return v, nil
+}
+
+func (v *vhostRotator) rotate(req *http.Request) {
+	req.Host = v.hosts[(atomic.AddUint64(&v.seq, 1)-1)%uint64(len(v.hosts))]
+}
+
+func (v *vhostRotator) add(host string, success bool, err error, delay time.Duration) {
+	v.stats.addStatus(host, success, err, delay)
+}
+
+func (v *vhostRotator) report() string {
+	return v.stats.report("Per-vhost")
+}
+
+// wrap returns t itself unless SNI rotation is on, in which case every virtual
+// host gets its own clone of t, and thus its own connection pool.
+func (v *vhostRotator) wrap(t *http.Transport) http.RoundTripper {
+	if !v.sni {
+		return t
+	}
+	return &sniTransport{base: t, byHost: make(map[string]*http.Transport)}
+}
+
+type sniTransport struct {
+	base *http.Transport
+
+	mu     sync.Mutex
+	byHost map[string]*http.Transport
+}
+
+func (t *sniTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.Host
+
+	if host == "" {
+		return t.base.RoundTrip(req)
+	}
+	t.mu.Lock()
+	rt, ok := t.byHost[host]
+
+	if !ok {
+		rt = t.base.Clone()
+
+		if rt.TLSClientConfig == nil {
+			rt.TLSClientConfig = &tls.Config{}
+		}
+		name, _, err := net.SplitHostPort(host)
+
+		if err != nil {
+			name = host
+		}
+		rt.TLSClientConfig.ServerName = name
+		t.byHost[host] = rt
+	}
+	t.mu.Unlock()
+	return rt.RoundTrip(req)
+}
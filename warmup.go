@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	warmupWindow    = 100
+	warmupWindows   = 5
+	warmupThreshold = 0.05
+	warmupMax       = time.Minute
+	// warmupBatch samples are summed by each worker before they are added,
+	// so that the workers meet once per batch rather than per request.
+	warmupBatch = 10
+)
+
+// warmup discards results until latency settles: the mean of each window of
+// warmupWindow requests must stay within warmupThreshold (as a coefficient of
+// variation) over the last warmupWindows windows.
+type warmup struct {
+	start time.Time
+	done  uint32
+	end   int64
+
+	mu       sync.Mutex
+	requests uint64
+	sum      time.Duration
+	n        int
+	means    []float64
+	stable   bool
+}
+
+func newWarmup(start time.Time) *warmup {
+	return &warmup{start: start}
+}
+
+func (w *warmup) finished() bool {
+	return atomic.LoadUint32(&w.done) == 1
+}
+
+// warm adds a sample of the worker to its batch, and the batch once full, and
+// returns true once warm-up is over and the sample should be measured.
+func (sh *statsShard) warm(w *warmup, delay time.Duration) bool {
+	sh.warmSum += delay
+	sh.warmN++
+
+	if sh.warmN < warmupBatch {
+		return false
+	}
+	sum, n := sh.warmSum, sh.warmN
+	sh.warmSum, sh.warmN = 0, 0
+	return w.add(sum, n)
+}
+
+// add takes a batch of n samples that sum to sum, and returns true once
+// warm-up is over.
+func (w *warmup) add(sum time.Duration, n int) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.finished() {
+		return true
+	}
+	w.requests += uint64(n)
+	w.sum += sum
+	w.n += n
+
+	if w.n >= warmupWindow {
+		w.means = append(w.means, float64(w.sum)/float64(w.n))
+		w.sum, w.n = 0, 0
+
+		if len(w.means) > warmupWindows {
+			w.means = w.means[1:]
+		}
+		w.stable = len(w.means) == warmupWindows && cv(w.means) < warmupThreshold
+	}
+	if w.stable || time.Since(w.start) > warmupMax {
+		atomic.StoreInt64(&w.end, time.Now().UnixNano())
+		atomic.StoreUint32(&w.done, 1)
+		setPhase("load")
+		slog.Debug("warm-up finished", "requests", w.requests, "stable", w.stable)
+	}
+	return false
+}
+
+func (w *warmup) measureStart() time.Time {
+	if !w.finished() {
+		return time.Now()
+	}
+	return time.Unix(0, atomic.LoadInt64(&w.end))
+}
+
+func (w *warmup) report() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	status := "latency stabilized"
+
+	if !w.finished() {
+		status = "run ended before latency stabilized"
+	} else if !w.stable {
+		status = fmt.Sprintf("gave up after %s, latency never stabilized", warmupMax)
+	}
+	return fmt.Sprintf(`
+		Warm-up: %s (%s)
+		Warm-up requests excluded: %d
+	`,
+		w.measureStart().Sub(w.start).Round(time.Millisecond),
+		status,
+		w.requests,
+	)
+}
+
+func cv(values []float64) float64 {
+	var mean, sq float64
+
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+
+	for _, v := range values {
+		sq += (v - mean) * (v - mean)
+	}
+	if mean == 0 {
+		return 0
+	}
+	return math.Sqrt(sq/float64(len(values))) / mean
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+func (b *bench) workerReport() string {
+	var (
+		sb             strings.Builder
+		slowest        int
+		slowAvg        time.Duration
+		minRPS, maxRPS float64
+	)
+	sb.WriteString("\n\t\tPer-worker:\n")
+
+	for i, sh := range b.stats.shards {
+		n := atomic.LoadUint64(&sh.delays)
+		rps := float64(n) / b.stats.Runtime.Seconds()
+		var avg time.Duration
+
+		if n > 0 {
+			avg = time.Duration(atomic.LoadInt64(&sh.delaySum) / int64(n))
+		}
+		if i == 0 || rps < minRPS {
+			minRPS = rps
+		}
+		if rps > maxRPS {
+			maxRPS = rps
+		}
+		if avg > slowAvg {
+			slowest, slowAvg = i, avg
+		}
+		fmt.Fprintf(&sb, "\t\tWorker %d: requests=%d fail=%d rps=%.0f avg=%s p50=%s p99=%s ttfb-p50=%s\n",
+			i, n, atomic.LoadUint32(&sh.fail), rps, showLatency(avg), showLatency(sh.sketch.percentile(50)),
+			showLatency(sh.sketch.percentile(99)), showLatency(sh.ttfbSketch.percentile(50)))
+	}
+	if minRPS > 0 {
+		fmt.Fprintf(&sb, "\t\tWorker RPS spread: %.2fx (max/min)\n", maxRPS/minRPS)
+	}
+	if b.stats.DelayAvg > 0 {
+		fmt.Fprintf(&sb, "\t\tSlowest worker: %d (avg %s, %.2fx overall)\n",
+			slowest, slowAvg, float64(slowAvg)/float64(b.stats.DelayAvg))
+	}
+	return sb.String()
+}